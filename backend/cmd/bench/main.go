@@ -0,0 +1,252 @@
+// Command bench drives a single engine with synthetic order flow and reports throughput, latency
+// percentiles per operation and allocations. It runs without Postgres or TigerBeetle, so the
+// numbers are the engine's own and can be compared across engine changes.
+//
+// New orders arrive as a Poisson process at -rate operations a second, or back to back when
+// -rate is 0. Bids are priced around -mid minus -spread and asks around -mid plus -spread, spread
+// by -width ticks, so the two sides overlap and a share of the flow trades. Latency is taken from
+// when an operation was due, so a book that falls behind the arrival rate shows it. With -check
+// the book invariants are checked after every operation, which makes it a randomized test of the
+// engine; the checks are not timed but still slow the run down and add to the allocations.
+//
+//	go run ./cmd/bench -ops 1000000 -cancel 0.4 -fak 0.2 -dist normal -width 20
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"runtime"
+	"slices"
+	"time"
+
+	"github.com/Yusufzhafir/go-orderbook/backend/internal/engine"
+	"github.com/Yusufzhafir/go-orderbook/backend/pkg/model"
+)
+
+const (
+	OP_ADD_GTC = "add_gtc"
+	OP_ADD_FAK = "add_fak"
+	OP_CANCEL  = "cancel"
+)
+
+const (
+	DIST_NORMAL  = "normal"
+	DIST_UNIFORM = "uniform"
+)
+
+type benchConfig struct {
+	ops    int
+	seed   int
+	rate   float64
+	mid    model.Price
+	spread model.Price
+	width  float64
+	dist   string
+	cancel float64
+	fak    float64
+	maxQty int
+	policy string
+	warmup int
+	check  bool
+}
+
+// flow generates the synthetic orders and keeps track of which ones may still rest on the book.
+type flow struct {
+	config  benchConfig
+	rand    *rand.Rand
+	nextID  model.OrderId
+	resting []model.OrderId
+}
+
+func (f *flow) price(side model.Side) model.Price {
+	var offset float64
+	switch f.config.dist {
+	case DIST_UNIFORM:
+		offset = (f.rand.Float64()*2 - 1) * f.config.width
+	default:
+		offset = f.rand.NormFloat64() * f.config.width
+	}
+	center := float64(f.config.mid - f.config.spread)
+	if side == model.ASK {
+		center = float64(f.config.mid + f.config.spread)
+	}
+	return model.Price(max(1, math.Round(center+offset)))
+}
+
+func (f *flow) order(orderType model.OrderType) model.Order {
+	f.nextID++
+	side := model.BID
+	if f.rand.Intn(2) == 1 {
+		side = model.ASK
+	}
+	quantity := model.Quantity(1 + f.rand.Intn(f.config.maxQty))
+	return model.NewOrder(f.nextID, side, f.price(side), quantity, orderType)
+}
+
+// cancelTarget picks an order to cancel among the ones that still rest, dropping those that
+// traded away since they were placed. ok is false when nothing rests.
+func (f *flow) cancelTarget(book engine.OrderBookEngine) (model.OrderId, bool) {
+	for len(f.resting) > 0 {
+		i := f.rand.Intn(len(f.resting))
+		id := f.resting[i]
+		f.resting[i] = f.resting[len(f.resting)-1]
+		f.resting = f.resting[:len(f.resting)-1]
+		if _, ok := book.GetOrder(id); ok {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+// result collects the latencies of one kind of operation.
+type result struct {
+	latencies []time.Duration
+	rejected  int
+}
+
+func (r *result) percentile(p float64) time.Duration {
+	if len(r.latencies) == 0 {
+		return 0
+	}
+	return r.latencies[min(len(r.latencies)-1, int(math.Ceil(p*float64(len(r.latencies))))-1)]
+}
+
+func main() {
+	var config benchConfig
+	var mid, spread int
+	flag.IntVar(&config.ops, "ops", 1_000_000, "operations to time")
+	flag.IntVar(&config.warmup, "warmup", 10_000, "untimed GTC orders placed before the run")
+	flag.IntVar(&config.seed, "seed", 1, "seed of the order flow, the same seed replays the same flow")
+	flag.Float64Var(&config.rate, "rate", 0, "mean operations a second, 0 sends them back to back")
+	flag.IntVar(&mid, "mid", 10_000, "mid price in ticks")
+	flag.IntVar(&spread, "spread", 2, "ticks bids are centered below and asks above the mid")
+	flag.Float64Var(&config.width, "width", 20, "standard deviation, or half range for uniform, of prices in ticks")
+	flag.StringVar(&config.dist, "dist", DIST_NORMAL, "price distribution around the mid: normal or uniform")
+	flag.Float64Var(&config.cancel, "cancel", 0.1, "share of operations that cancel a resting order")
+	flag.Float64Var(&config.fak, "fak", 0.2, "share of new orders that are fill and kill instead of GTC")
+	flag.IntVar(&config.maxQty, "max-qty", 100, "largest order quantity, quantities are uniform from 1")
+	flag.StringVar(&config.policy, "policy", engine.MATCHING_FIFO, "matching policy of the book")
+	flag.BoolVar(&config.check, "check", false, "check the book invariants after every operation, untimed, and stop at the first violation")
+	flag.Parse()
+	config.mid, config.spread = model.Price(mid), model.Price(spread)
+
+	switch {
+	case config.ops <= 0 || config.warmup < 0 || config.maxQty <= 0:
+		log.Fatal("-ops and -max-qty must be positive and -warmup not negative")
+	case config.cancel < 0 || config.cancel > 1 || config.fak < 0 || config.fak > 1:
+		log.Fatal("-cancel and -fak must be between 0 and 1")
+	case config.dist != DIST_NORMAL && config.dist != DIST_UNIFORM:
+		log.Fatalf("unknown distribution %q", config.dist)
+	case config.spread >= config.mid:
+		log.Fatal("-spread must be below -mid")
+	}
+	policy, err := engine.MatchingPolicyByName(config.policy)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	book := engine.NewOrderBookEngine(engine.OrderBookEngineOpts{Ticker: "BENCH", MatchingPolicy: policy})
+	book.Initialize()
+	f := &flow{config: config, rand: rand.New(rand.NewSource(int64(config.seed)))}
+	for i := 0; i < config.warmup; i++ {
+		order := f.order(model.ORDER_GOOD_TILL_CANCEL)
+		if _, err := book.AddOrder(order); err != nil {
+			log.Fatalf("warming up: %v", err)
+		}
+		f.resting = append(f.resting, order.GetId())
+	}
+
+	results := map[string]*result{OP_ADD_GTC: {}, OP_ADD_FAK: {}, OP_CANCEL: {}}
+	for _, r := range results {
+		r.latencies = make([]time.Duration, 0, config.ops)
+	}
+	trades, events := 0, 0
+
+	runtime.GC()
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	due := start
+	for i := 0; i < config.ops; i++ {
+		op, orderType := OP_ADD_GTC, model.ORDER_GOOD_TILL_CANCEL
+		if f.rand.Float64() < config.cancel {
+			op = OP_CANCEL
+		} else if f.rand.Float64() < config.fak {
+			op, orderType = OP_ADD_FAK, model.ORDER_IMMEDIATE_OR_CANCEL
+		}
+		// pick the order or the cancel target before the clock starts, only the engine is timed
+		var order model.Order
+		var target model.OrderId
+		if op == OP_CANCEL {
+			id, ok := f.cancelTarget(book)
+			if !ok {
+				continue
+			}
+			target = id
+		} else {
+			order = f.order(orderType)
+		}
+
+		if config.rate > 0 {
+			due = due.Add(time.Duration(f.rand.ExpFloat64() / config.rate * float64(time.Second)))
+			// spin rather than sleep, sleeps are far coarser than the gaps between arrivals
+			for time.Now().Before(due) {
+			}
+		} else {
+			due = time.Now()
+		}
+		var emitted []model.Event
+		var opErr error
+		if op == OP_CANCEL {
+			opErr = book.CancelOrder(target)
+		} else {
+			emitted, opErr = book.AddOrder(order)
+		}
+		elapsed := time.Since(due)
+
+		r := results[op]
+		r.latencies = append(r.latencies, elapsed)
+		if opErr != nil {
+			r.rejected++
+		}
+		events += len(emitted)
+		trades += len(model.TradesOf(emitted))
+		if orderType == model.ORDER_GOOD_TILL_CANCEL && op != OP_CANCEL {
+			f.resting = append(f.resting, order.GetId())
+		}
+		if config.check {
+			if err := errors.Join(book.CheckInvariants(), engine.CheckEvents(emitted)); err != nil {
+				log.Fatalf("seed %d, operation %d (%s): %v", config.seed, i, op, err)
+			}
+		}
+	}
+	duration := time.Since(start)
+	runtime.ReadMemStats(&after)
+
+	timed := 0
+	for _, r := range results {
+		timed += len(r.latencies)
+		slices.Sort(r.latencies)
+	}
+
+	fmt.Printf("seed %d, %d ops in %v: %.0f ops/s, %d trades, %d events, %d price levels left\n",
+		config.seed, timed, duration.Round(time.Millisecond), float64(timed)/duration.Seconds(), trades, events, book.OrderSize())
+	fmt.Printf("%.1f allocs/op, %.0f B/op, %d GCs\n\n",
+		float64(after.Mallocs-before.Mallocs)/float64(timed),
+		float64(after.TotalAlloc-before.TotalAlloc)/float64(timed),
+		after.NumGC-before.NumGC)
+
+	fmt.Printf("%-8s %10s %8s %10s %10s %10s %10s\n", "op", "count", "rejected", "p50", "p99", "p999", "max")
+	for _, op := range []string{OP_ADD_GTC, OP_ADD_FAK, OP_CANCEL} {
+		r := results[op]
+		if len(r.latencies) == 0 {
+			continue
+		}
+		fmt.Printf("%-8s %10d %8d %10v %10v %10v %10v\n", op, len(r.latencies), r.rejected,
+			r.percentile(0.50), r.percentile(0.99), r.percentile(0.999), r.latencies[len(r.latencies)-1])
+	}
+}
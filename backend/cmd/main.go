@@ -10,6 +10,7 @@ import (
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -22,6 +23,7 @@ import (
 	"github.com/Yusufzhafir/go-orderbook/backend/internal/usecase/user"
 	"github.com/Yusufzhafir/go-orderbook/backend/internal/websocket"
 	"github.com/Yusufzhafir/go-orderbook/backend/pkg/model"
+	"github.com/Yusufzhafir/go-orderbook/backend/pkg/snowflake"
 	"github.com/jmoiron/sqlx"
 	"github.com/joho/godotenv"
 	tb "github.com/tigerbeetle/tigerbeetle-go"
@@ -88,6 +90,49 @@ func main() {
 	dbPort := os.Getenv("DB_PORT")
 	dbName := os.Getenv("DB_NAME")
 	jwtSecret := os.Getenv("JWT_SECRET")
+	// DAY orders expire at this offset from UTC midnight, e.g. "21h" (defaults to midnight)
+	sessionClose, err := time.ParseDuration(os.Getenv("SESSION_CLOSE"))
+	if err != nil {
+		sessionClose = 0
+	}
+	// order books are snapshotted to SNAPSHOT_DIR every SNAPSHOT_INTERVAL and restored from it at startup
+	snapshotDir := os.Getenv("SNAPSHOT_DIR")
+	if snapshotDir == "" {
+		snapshotDir = "snapshots"
+	}
+	// engine commands are journaled to JOURNAL_DIR and replayed on top of the snapshots at startup
+	journalDir := os.Getenv("JOURNAL_DIR")
+	if journalDir == "" {
+		journalDir = "journal"
+	}
+	snapshotInterval, err := time.ParseDuration(os.Getenv("SNAPSHOT_INTERVAL"))
+	if err != nil || snapshotInterval <= 0 {
+		snapshotInterval = 30 * time.Second
+	}
+	// keys the anonymised order tokens of the L3 book view, tokens change on every restart without it
+	l3TokenKey := os.Getenv("L3_TOKEN_KEY")
+	// users allowed to run the trading day, e.g. "1,2"
+	adminUserIDs := make(map[int64]struct{})
+	for _, field := range strings.Split(os.Getenv("ADMIN_USER_IDS"), ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			logger.Fatalf("invalid ADMIN_USER_IDS entry %q: %v", field, err)
+		}
+		adminUserIDs[id] = struct{}{}
+	}
+	// order and trade IDs carry NODE_ID, every process writing to the same database needs its own
+	nodeID, err := strconv.ParseUint(os.Getenv("NODE_ID"), 10, 16)
+	if err != nil {
+		nodeID = 0
+	}
+	ids, err := snowflake.NewGenerator(snowflake.GeneratorOpts{Node: uint16(nodeID)})
+	if err != nil {
+		logger.Fatalf("invalid NODE_ID: %v", err)
+	}
 
 	// construct DSN
 	pgInfo := fmt.Sprintf(
@@ -115,9 +160,32 @@ func main() {
 		Db:            db,
 		LedgerRepo:    &userLedgerRepo,
 		OrderRepo:     &orderRepository,
+		UserRepo:      &userRepo,
+		SessionClose:  sessionClose,
+		JournalDir:    journalDir,
+		TokenKey:      []byte(l3TokenKey),
+		IDs:           ids,
 	}
 
 	orderUseCase := order.NewOrderUseCase(rootCtx, usecaseOpts)
+	orderUseCase.RegisterEventHandler(func(event model.Event) {
+		hub.PublishEvent(event)
+	})
+	// recovery already emits book level changes, the writer has to be draining them
+	go orderUseCase.RunEventWriter(rootCtx)
+	go orderUseCase.RunEscrowReleaser(rootCtx)
+	if err := orderUseCase.RestoreSnapshots(rootCtx, snapshotDir); err != nil {
+		logger.Fatalf("restoring order book snapshots: %v", err)
+	}
+	if err := orderUseCase.ReplayJournals(rootCtx); err != nil {
+		logger.Fatalf("replaying engine journals: %v", err)
+	}
+	if err := orderUseCase.RestoreTickerStatuses(rootCtx); err != nil {
+		logger.Fatalf("restoring ticker statuses: %v", err)
+	}
+	if err := orderUseCase.RebuildFromActiveOrders(rootCtx); err != nil {
+		logger.Fatalf("rebuilding order books from active orders: %v", err)
+	}
 	userUsecase := user.NewUserUseCase(userUseCaseOpts)
 	tokenMaker := middleware.NewJWTMaker(jwtSecret)
 	//bind router
@@ -126,6 +194,7 @@ func main() {
 		OrderUseCase: &orderUseCase,
 		TokenMaker:   tokenMaker,
 		UserUseCase:  &userUsecase,
+		AdminUserIDs: adminUserIDs,
 	}
 	router.BindRouter(bindRouterOpts)
 	logger.Println("finished binding router")
@@ -142,6 +211,22 @@ func main() {
 		hub.PublishTrade(mapToWsTrade(tr))
 	})
 
+	orderUseCase.RegisterAuctionHandler(func(indication model.AuctionIndication) {
+		hub.PublishAuction(indication)
+	})
+
+	orderUseCase.RegisterHaltHandler(func(halt model.Halt) {
+		hub.PublishHalt(halt)
+	})
+
+	orderUseCase.RegisterStatusHandler(func(change model.TickerStatusChange) {
+		hub.PublishStatus(change)
+	})
+
+	go orderUseCase.RunExpiryScheduler(rootCtx, time.Second)
+	go orderUseCase.RunSnapshotter(rootCtx, snapshotDir, snapshotInterval)
+	go orderUseCase.RunAuctionPublisher(rootCtx, time.Second)
+
 	// Start server in background.
 	go func() {
 		logger.Printf("HTTP server listening on %s", server.Addr)
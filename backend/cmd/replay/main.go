@@ -0,0 +1,70 @@
+// Command replay rebuilds a ticker's book offline from its snapshot and journal and prints the
+// trades the journaled commands produced along with the final depth, for looking into incidents.
+//
+//	go run ./cmd/replay -ticker BBCA -journal journal/BBCA.journal -snapshot snapshots/BBCA.snap
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/Yusufzhafir/go-orderbook/backend/internal/engine"
+)
+
+func main() {
+	ticker := flag.String("ticker", "", "ticker the journal belongs to")
+	journalPath := flag.String("journal", "", "journal file to replay")
+	snapshotPath := flag.String("snapshot", "", "optional snapshot to start from")
+	policyName := flag.String("policy", engine.MATCHING_FIFO, "matching policy of the ticker")
+	flag.Parse()
+	if *ticker == "" || *journalPath == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	policy, err := engine.MatchingPolicyByName(*policyName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	book := engine.NewOrderBookEngine(engine.OrderBookEngineOpts{Ticker: *ticker, MatchingPolicy: policy})
+	book.Initialize()
+
+	if *snapshotPath != "" {
+		data, err := os.ReadFile(*snapshotPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := book.Restore(data); err != nil {
+			log.Fatalf("restoring snapshot: %v", err)
+		}
+		fmt.Printf("snapshot at sequence %d\n", book.Sequence())
+	}
+
+	commands := make([]engine.JournalEntry, 0)
+	err = engine.ReadJournal(*journalPath, func(command engine.JournalEntry) error {
+		commands = append(commands, command)
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("reading journal: %v", err)
+	}
+
+	trades, err := book.Replay(commands)
+	for _, trade := range trades {
+		fmt.Printf("trade maker=%d taker=%d buy=%d sell=%d side=%d price=%d qty=%d\n", trade.MakerID, trade.TakerID, trade.BuyOrderID, trade.SellOrderID, trade.Side, trade.Price, trade.Quantity)
+	}
+	if err != nil {
+		log.Fatalf("replay stopped at sequence %d: %v", book.Sequence(), err)
+	}
+
+	depth := book.GetOrderInfos()
+	fmt.Printf("replayed to sequence %d, %d trades\n", book.Sequence(), len(trades))
+	for _, level := range depth.Asks {
+		fmt.Printf("ask %d x %d (%d orders)\n", level.Price, level.Volume, level.OrderCount)
+	}
+	for _, level := range depth.Bids {
+		fmt.Printf("bid %d x %d (%d orders)\n", level.Price, level.Volume, level.OrderCount)
+	}
+}
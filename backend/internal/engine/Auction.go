@@ -0,0 +1,230 @@
+package engine
+
+import (
+	"fmt"
+	"slices"
+
+	orderbookModel "github.com/Yusufzhafir/go-orderbook/backend/internal/engine/model"
+	"github.com/Yusufzhafir/go-orderbook/backend/pkg/model"
+	"github.com/google/btree"
+)
+
+func (o *orderBookEngineImpl) GetTradingPhase() model.TradingPhase {
+	return o.phase
+}
+
+// SetTradingPhase moves the book to phase. Leaving an auction for continuous trading or the
+// close uncrosses the book at a single price and returns the events, trades included; stops only
+// wake up when continuous trading starts.
+func (o *orderBookEngineImpl) SetTradingPhase(phase model.TradingPhase) ([]model.Event, error) {
+	if phase > model.PHASE_CLOSED {
+		return nil, fmt.Errorf("unknown trading phase %d", phase)
+	}
+	if err := o.record(JournalEntry{Command: JOURNAL_PHASE, Phase: phase}); err != nil {
+		return nil, err
+	}
+	o.setTradingPhase(phase)
+	return o.flushEvents(), nil
+}
+
+func (o *orderBookEngineImpl) setTradingPhase(phase model.TradingPhase) []*model.Trade {
+	trades := make([]*model.Trade, 0)
+	if o.phase.IsAuction() && !phase.IsAuction() {
+		trades = o.uncross()
+	}
+	o.phase = phase
+	// the auction price is the reference the price bands are measured from
+	o.setReferencePrices(trades, true)
+	if phase == model.PHASE_CONTINUOUS {
+		return append(trades, o.releaseStops(trades)...)
+	}
+	return trades
+}
+
+// GetAuctionIndication is what uncrossing would do right now, nil outside an auction.
+func (o *orderBookEngineImpl) GetAuctionIndication() *model.AuctionIndication {
+	if !o.phase.IsAuction() {
+		return nil
+	}
+	indication := o.indicate()
+	indication.Ticker = o.ticker
+	indication.Phase = o.phase
+	return &indication
+}
+
+// auctionLevel is the price and full volume of a level, hidden iceberg reserve included.
+type auctionLevel struct {
+	price  model.Price
+	volume model.Quantity
+}
+
+// indicate finds the uncrossing price among the limit prices of the crossed part of the book:
+//  1. the price that executes the most volume,
+//  2. then the one that leaves the smallest imbalance,
+//  3. then, when every remaining price leaves a surplus on the same side, the highest price for
+//     a buy surplus and the lowest for a sell surplus,
+//  4. then the price closest to the reference price, the last trade or, before the first trade,
+//     the middle of the remaining prices. An even split goes to the lower price.
+//
+// For example bids 10@102 and 10@100 against asks 5@99 and 10@101 execute 10 at 101: 101 and
+// 102 both execute 10 and leave 5 unsold, and a sell surplus takes the lower price.
+func (o *orderBookEngineImpl) indicate() model.AuctionIndication {
+	if !o.crossed() {
+		return model.AuctionIndication{}
+	}
+	bestBid := o.bids.Min().(*orderbookModel.BidPriceLevel).Price
+	bestAsk := o.asks.Min().(*orderbookModel.AskPriceLevel).Price
+
+	// bids that could trade, ascending, and asks that could trade, ascending
+	bids := make([]auctionLevel, 0)
+	o.bids.Ascend(func(item btree.Item) bool {
+		level := item.(*orderbookModel.BidPriceLevel)
+		if level.Price < bestAsk {
+			return false
+		}
+		bids = append(bids, auctionLevel{level.Price, level.TotalVolume})
+		return true
+	})
+	slices.Reverse(bids)
+	asks := make([]auctionLevel, 0)
+	o.asks.Ascend(func(item btree.Item) bool {
+		level := item.(*orderbookModel.AskPriceLevel)
+		if level.Price > bestBid {
+			return false
+		}
+		asks = append(asks, auctionLevel{level.Price, level.TotalVolume})
+		return true
+	})
+
+	var demand model.Quantity
+	for _, level := range bids {
+		demand += level.volume
+	}
+	type candidate struct {
+		price            model.Price
+		demand, supply   model.Quantity
+		volume, leftover model.Quantity
+	}
+	candidates := make([]candidate, 0, len(bids)+len(asks))
+	var supply model.Quantity
+	b, a := 0, 0
+	for b < len(bids) || a < len(asks) {
+		price := model.Price(0)
+		switch {
+		case b == len(bids):
+			price = asks[a].price
+		case a == len(asks):
+			price = bids[b].price
+		default:
+			price = min(bids[b].price, asks[a].price)
+		}
+		// demand at price counts bids at or above it, supply asks at or below it
+		for b < len(bids) && bids[b].price < price {
+			demand -= bids[b].volume
+			b++
+		}
+		for a < len(asks) && asks[a].price <= price {
+			supply += asks[a].volume
+			a++
+		}
+		volume := min(demand, supply)
+		candidates = append(candidates, candidate{price, demand, supply, volume, max(demand, supply) - volume})
+		if b < len(bids) && bids[b].price == price {
+			demand -= bids[b].volume
+			b++
+		}
+	}
+
+	best := candidates[:0:0]
+	for _, c := range candidates {
+		switch {
+		case len(best) == 0 || c.volume > best[0].volume || (c.volume == best[0].volume && c.leftover < best[0].leftover):
+			best = append(best[:0], c)
+		case c.volume == best[0].volume && c.leftover == best[0].leftover:
+			best = append(best, c)
+		}
+	}
+
+	chosen := best[0]
+	buySurplus, sellSurplus := true, true
+	for _, c := range best {
+		buySurplus = buySurplus && c.demand > c.supply
+		sellSurplus = sellSurplus && c.supply > c.demand
+	}
+	switch {
+	case buySurplus:
+		chosen = best[len(best)-1]
+	case sellSurplus:
+		chosen = best[0]
+	default:
+		reference := o.lastTradePrice
+		if reference == 0 {
+			reference = best[0].price + (best[len(best)-1].price-best[0].price)/2
+		}
+		distance := func(price model.Price) model.Price {
+			if price > reference {
+				return price - reference
+			}
+			return reference - price
+		}
+		for _, c := range best {
+			if distance(c.price) < distance(chosen.price) {
+				chosen = c
+			}
+		}
+	}
+
+	indication := model.AuctionIndication{
+		Price:     chosen.price,
+		Volume:    chosen.volume,
+		Imbalance: chosen.leftover,
+	}
+	if chosen.supply > chosen.demand {
+		indication.ImbalanceSide = model.ASK
+	}
+	return indication
+}
+
+// crossed reports whether the best bid reaches the best ask, which only happens in auctions.
+func (o *orderBookEngineImpl) crossed() bool {
+	if o.bids.Len() == 0 || o.asks.Len() == 0 {
+		return false
+	}
+	return o.bids.Min().(*orderbookModel.BidPriceLevel).Price >= o.asks.Min().(*orderbookModel.AskPriceLevel).Price
+}
+
+// uncross executes the auction at its indicative price. Orders trade in price then time
+// priority, icebergs a slice at a time like in continuous trading; self-trade prevention and
+// the matching policy do not apply. Of the two orders in a trade, the one that entered the
+// book later is the taker, a tie goes to the bid.
+func (o *orderBookEngineImpl) uncross() []*model.Trade {
+	indication := o.indicate()
+	trades := make([]*model.Trade, 0)
+	for left := indication.Volume; left > 0; {
+		bidLevel := &o.bids.Min().(*orderbookModel.BidPriceLevel).PriceLevel
+		askLevel := &o.asks.Min().(*orderbookModel.AskPriceLevel).PriceLevel
+		bid, ask := bidLevel.Orders.Front(), askLevel.Orders.Front()
+
+		quantity := min(left, bid.GetDisplayedQuantity(), ask.GetDisplayedQuantity())
+		bid.FillAt(quantity, indication.Price)
+		ask.FillAt(quantity, indication.Price)
+		bidLevel.TotalVolume -= quantity
+		askLevel.TotalVolume -= quantity
+		left -= quantity
+
+		maker, taker := ask, bid
+		if ask.GetEnteredAt().After(bid.GetEnteredAt()) {
+			maker, taker = bid, ask
+		}
+		trade := o.newTrade(maker, taker, indication.Price, quantity)
+		trades = append(trades, trade)
+		o.emitTrade(trade)
+		o.emitFill(ask, trade.Price, quantity)
+		o.emitFill(bid, trade.Price, quantity)
+		o.touch(model.BID, bidLevel.Price)
+		o.touch(model.ASK, askLevel.Price)
+		o.tidyLevel(bidLevel, []Allocation{{Order: bid, Quantity: quantity}})
+		o.tidyLevel(askLevel, []Allocation{{Order: ask, Quantity: quantity}})
+	}
+	return trades
+}
@@ -0,0 +1,181 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Yusufzhafir/go-orderbook/backend/pkg/clock"
+	"github.com/Yusufzhafir/go-orderbook/backend/pkg/model"
+)
+
+// auctionOrder is one limit order collected during an auction.
+type auctionOrder struct {
+	price    model.Price
+	quantity model.Quantity
+}
+
+func TestAuctionUncross(t *testing.T) {
+	tests := []struct {
+		name      string
+		reference model.Price // last trade before the auction, 0 for none
+		bids      []auctionOrder
+		asks      []auctionOrder
+		want      model.AuctionIndication
+	}{
+		{
+			name: "the price that executes the most volume",
+			bids: []auctionOrder{{101, 10}},
+			asks: []auctionOrder{{99, 3}, {100, 5}, {101, 4}},
+			want: model.AuctionIndication{Price: 101, Volume: 10, Imbalance: 2, ImbalanceSide: model.ASK},
+		},
+		{
+			name: "equal volume goes to the smallest imbalance",
+			bids: []auctionOrder{{102, 10}, {100, 5}},
+			asks: []auctionOrder{{99, 10}},
+			want: model.AuctionIndication{Price: 102, Volume: 10, Imbalance: 0},
+		},
+		{
+			name: "a buy surplus takes the highest price",
+			bids: []auctionOrder{{103, 20}},
+			asks: []auctionOrder{{100, 5}, {101, 5}},
+			want: model.AuctionIndication{Price: 103, Volume: 10, Imbalance: 10, ImbalanceSide: model.BID},
+		},
+		{
+			name: "a sell surplus takes the lowest price",
+			bids: []auctionOrder{{102, 10}, {100, 10}},
+			asks: []auctionOrder{{99, 5}, {101, 10}},
+			want: model.AuctionIndication{Price: 101, Volume: 10, Imbalance: 5, ImbalanceSide: model.ASK},
+		},
+		{
+			name:      "no surplus takes the price closest to the last trade",
+			reference: 104,
+			bids:      []auctionOrder{{105, 10}},
+			asks:      []auctionOrder{{100, 10}},
+			want:      model.AuctionIndication{Price: 105, Volume: 10},
+		},
+		{
+			name:      "a last trade below every price takes the lowest",
+			reference: 90,
+			bids:      []auctionOrder{{105, 10}},
+			asks:      []auctionOrder{{100, 10}},
+			want:      model.AuctionIndication{Price: 100, Volume: 10},
+		},
+		{
+			name: "no last trade takes the price closest to the middle",
+			bids: []auctionOrder{{105, 10}},
+			asks: []auctionOrder{{100, 10}},
+			want: model.AuctionIndication{Price: 100, Volume: 10},
+		},
+		{
+			name: "an even split around the middle goes to the lower price",
+			bids: []auctionOrder{{104, 10}},
+			asks: []auctionOrder{{100, 10}},
+			want: model.AuctionIndication{Price: 100, Volume: 10},
+		},
+		{
+			name: "a book that does not cross has nothing to uncross",
+			bids: []auctionOrder{{99, 10}},
+			asks: []auctionOrder{{100, 10}},
+			want: model.AuctionIndication{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			book := newTestBook(t, "AUC")
+			if test.reference > 0 {
+				mustAdd(t, book, model.NewOrder(100, model.ASK, test.reference, 1, model.ORDER_GOOD_TILL_CANCEL))
+				mustAdd(t, book, model.NewOrder(101, model.BID, test.reference, 1, model.ORDER_IMMEDIATE_OR_CANCEL))
+			}
+			if _, err := book.SetTradingPhase(model.PHASE_OPENING_AUCTION); err != nil {
+				t.Fatal(err)
+			}
+			for i, order := range test.bids {
+				mustAdd(t, book, model.NewOrder(model.OrderId(1+i), model.BID, order.price, order.quantity, model.ORDER_GOOD_TILL_CANCEL))
+			}
+			for i, order := range test.asks {
+				mustAdd(t, book, model.NewOrder(model.OrderId(50+i), model.ASK, order.price, order.quantity, model.ORDER_GOOD_TILL_CANCEL))
+			}
+
+			want := test.want
+			want.Ticker, want.Phase = "AUC", model.PHASE_OPENING_AUCTION
+			if got := book.GetAuctionIndication(); got == nil || *got != want {
+				t.Fatalf("indication %+v, want %+v", got, want)
+			}
+
+			events, err := book.SetTradingPhase(model.PHASE_CONTINUOUS)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var volume model.Quantity
+			for _, trade := range tradesIn(events) {
+				if trade.Price != test.want.Price {
+					t.Errorf("trade %+v away from the uncrossing price %d", trade, test.want.Price)
+				}
+				volume += trade.Quantity
+			}
+			if volume != test.want.Volume {
+				t.Errorf("uncrossing traded %d, want %d", volume, test.want.Volume)
+			}
+			if book.GetAuctionIndication() != nil {
+				t.Error("continuous trading still reports an indication")
+			}
+			if err := book.CheckInvariants(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// TestAuctionTakerIsTheLaterOrder checks the roles uncrossing hands out: the order that entered
+// the book later takes, and a tie goes to the bid.
+func TestAuctionTakerIsTheLaterOrder(t *testing.T) {
+	tests := []struct {
+		name      string
+		bidFirst  bool
+		sameTime  bool
+		wantTaker model.OrderId
+	}{
+		{name: "bid entered first", bidFirst: true, wantTaker: 2},
+		{name: "ask entered first", wantTaker: 1},
+		{name: "both entered together", bidFirst: true, sameTime: true, wantTaker: 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			now := clock.NewManual(time.Date(2025, 1, 2, 8, 0, 0, 0, time.UTC))
+			book := NewOrderBookEngine(OrderBookEngineOpts{Ticker: "AUC", Clock: now})
+			book.Initialize()
+			if _, err := book.SetTradingPhase(model.PHASE_OPENING_AUCTION); err != nil {
+				t.Fatal(err)
+			}
+			bid := model.NewOrder(1, model.BID, 100, 5, model.ORDER_GOOD_TILL_CANCEL)
+			ask := model.NewOrder(2, model.ASK, 100, 5, model.ORDER_GOOD_TILL_CANCEL)
+			first, second := ask, bid
+			if test.bidFirst {
+				first, second = bid, ask
+			}
+			mustAdd(t, book, first)
+			if !test.sameTime {
+				now.Advance(time.Second)
+			}
+			mustAdd(t, book, second)
+
+			events, err := book.SetTradingPhase(model.PHASE_CONTINUOUS)
+			if err != nil {
+				t.Fatal(err)
+			}
+			trades := tradesIn(events)
+			if len(trades) != 1 {
+				t.Fatalf("uncrossing printed %v", trades)
+			}
+			wantSide := model.BID
+			if test.wantTaker == ask.GetId() {
+				wantSide = model.ASK
+			}
+			if trades[0].TakerID != test.wantTaker || trades[0].Side != wantSide {
+				t.Errorf("trade %+v, want order %d as the taker", trades[0], test.wantTaker)
+			}
+		})
+	}
+}
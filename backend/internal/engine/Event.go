@@ -0,0 +1,135 @@
+package engine
+
+import (
+	orderbookModel "github.com/Yusufzhafir/go-orderbook/backend/internal/engine/model"
+	"github.com/Yusufzhafir/go-orderbook/backend/pkg/model"
+)
+
+// EventHandler is given the events of every command the engine applies, in sequence order,
+// once the command is done. It runs on the goroutine that owns the engine.
+type EventHandler func(events []model.Event)
+
+// levelKey names a price level of one side of the book.
+type levelKey struct {
+	side  model.Side
+	price model.Price
+}
+
+func (o *orderBookEngineImpl) RegisterEventHandler(handler EventHandler) {
+	o.eventHandler = handler
+}
+
+// EventSequence is the sequence of the last event the engine emitted.
+func (o *orderBookEngineImpl) EventSequence() uint64 {
+	return o.eventSequence
+}
+
+// emit gives event the next event sequence of the ticker and queues it with the command
+// being applied.
+func (o *orderBookEngineImpl) emit(event model.Event) {
+	o.eventSequence++
+	event.Ticker, event.Sequence, event.Time = o.ticker, o.eventSequence, o.now
+	o.pending = append(o.pending, event)
+}
+
+func (o *orderBookEngineImpl) emitOrder(eventType model.EventType, order *model.Order, reason string) {
+	o.emit(model.Event{
+		Type:      eventType,
+		OrderID:   order.GetId(),
+		Owner:     order.GetOwner(),
+		Side:      order.GetSide(),
+		Price:     order.GetPrice(),
+		Quantity:  order.GetInitialQuantity(),
+		Remaining: order.GetRemainingQuantity(),
+		Reason:    reason,
+	})
+}
+
+// emitFill reports that order traded quantity at price.
+func (o *orderBookEngineImpl) emitFill(order *model.Order, price model.Price, quantity model.Quantity) {
+	eventType := model.EVENT_ORDER_PARTIALLY_FILLED
+	if order.IsFilled() {
+		eventType = model.EVENT_ORDER_FILLED
+	}
+	o.emit(model.Event{
+		Type:      eventType,
+		OrderID:   order.GetId(),
+		Owner:     order.GetOwner(),
+		Side:      order.GetSide(),
+		Price:     price,
+		Quantity:  quantity,
+		Remaining: order.GetRemainingQuantity(),
+	})
+}
+
+// emitReduced reports that quantity was taken off order without trading.
+func (o *orderBookEngineImpl) emitReduced(order *model.Order, quantity model.Quantity) {
+	o.emit(model.Event{
+		Type:      model.EVENT_ORDER_REDUCED,
+		OrderID:   order.GetId(),
+		Owner:     order.GetOwner(),
+		Side:      order.GetSide(),
+		Price:     order.GetPrice(),
+		Quantity:  quantity,
+		Remaining: order.GetRemainingQuantity(),
+	})
+}
+
+func (o *orderBookEngineImpl) emitTrade(trade *model.Trade) {
+	o.emit(model.Event{
+		Type:     model.EVENT_TRADE,
+		Side:     trade.Side,
+		Price:    trade.Price,
+		Quantity: trade.Quantity,
+		Trade:    trade,
+	})
+}
+
+// touch marks the level at price on side as changed by the command being applied.
+func (o *orderBookEngineImpl) touch(side model.Side, price model.Price) {
+	key := levelKey{side, price}
+	if _, ok := o.touchedSet[key]; ok {
+		return
+	}
+	o.touchedSet[key] = struct{}{}
+	o.touched = append(o.touched, key)
+}
+
+// levelAt returns the level at price on side, nil when nothing rests there.
+func (o *orderBookEngineImpl) levelAt(side model.Side, price model.Price) *orderbookModel.PriceLevel {
+	if side == model.BID {
+		if level, ok := o.bids.Get(orderbookModel.NewBidPriceLevel(price)).(*orderbookModel.BidPriceLevel); ok {
+			return &level.PriceLevel
+		}
+		return nil
+	}
+	if level, ok := o.asks.Get(orderbookModel.NewAskPriceLevel(price)).(*orderbookModel.AskPriceLevel); ok {
+		return &level.PriceLevel
+	}
+	return nil
+}
+
+// flushEvents ends the command being applied. It journals the ids of the trades the command
+// printed, then emits a BOOK_LEVEL_CHANGED for every level the command touched, in the order
+// they were first touched, with the level as it is now; a level that emptied reports no
+// volume. The command's events go to the event handler and are returned.
+func (o *orderBookEngineImpl) flushEvents() []model.Event {
+	o.journalTradeIDs()
+	for _, key := range o.touched {
+		event := model.Event{Type: model.EVENT_BOOK_LEVEL_CHANGED, Side: key.side, Price: key.price}
+		if level := o.levelAt(key.side, key.price); level != nil {
+			event.Quantity = level.DisplayedVolume()
+			event.Orders = level.Orders.Len()
+		}
+		o.emit(event)
+	}
+	events := o.pending
+	o.pending = nil
+	o.touched = o.touched[:0]
+	clear(o.touchedSet)
+	o.checkCommand(events)
+	if len(events) > 0 && o.eventHandler != nil {
+		o.eventHandler(events)
+	}
+	return events
+}
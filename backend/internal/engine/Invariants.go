@@ -0,0 +1,200 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+
+	orderbookModel "github.com/Yusufzhafir/go-orderbook/backend/internal/engine/model"
+	"github.com/Yusufzhafir/go-orderbook/backend/pkg/model"
+	"github.com/google/btree"
+)
+
+// CheckInvariants verifies the book is consistent and returns every violation it finds, nil
+// when there are none:
+//   - outside an auction the best bid is below the best ask
+//   - no level is empty, and a level's volumes are the sums of its orders' quantities
+//   - every resting order sits at its own price and side, in the level it points back to
+//   - every order in the lookup is on the book or the trigger book exactly once, and nothing
+//     is on either without being in the lookup
+//   - no order has more open than it was placed with, or shows more than it has open
+func (o *orderBookEngineImpl) CheckInvariants() error {
+	var errs []error
+	seen := make(map[model.OrderId]int, len(o.orders))
+
+	checkLevel := func(side model.Side, level *orderbookModel.PriceLevel) {
+		if level.Orders.Len() == 0 {
+			errs = append(errs, fmt.Errorf("%s level %d is empty", sideName(side), level.Price))
+		}
+		var total, hidden model.Quantity
+		for _, order := range level.Orders.Orders() {
+			seen[order.GetId()]++
+			total += order.GetRemainingQuantity()
+			hidden += order.GetHiddenQuantity()
+			if order.GetSide() != side || order.GetPrice() != level.Price {
+				errs = append(errs, fmt.Errorf("order %d (%s at %d) rests in %s level %d", order.GetId(), sideName(order.GetSide()), order.GetPrice(), sideName(side), level.Price))
+			}
+			if orderbookModel.LevelOf(order) != level {
+				errs = append(errs, fmt.Errorf("order %d in %s level %d points to another level", order.GetId(), sideName(side), level.Price))
+			}
+			if o.orders[order.GetId()] != order {
+				errs = append(errs, fmt.Errorf("order %d in %s level %d is not the order looked up by its id", order.GetId(), sideName(side), level.Price))
+			}
+			errs = append(errs, checkQuantities(order)...)
+		}
+		if total != level.TotalVolume {
+			errs = append(errs, fmt.Errorf("%s level %d has total volume %d, its orders have %d open", sideName(side), level.Price, level.TotalVolume, total))
+		}
+		if hidden != level.HiddenVolume {
+			errs = append(errs, fmt.Errorf("%s level %d has hidden volume %d, its orders hide %d", sideName(side), level.Price, level.HiddenVolume, hidden))
+		}
+	}
+	o.bids.Ascend(func(item btree.Item) bool {
+		checkLevel(model.BID, &item.(*orderbookModel.BidPriceLevel).PriceLevel)
+		return true
+	})
+	o.asks.Ascend(func(item btree.Item) bool {
+		checkLevel(model.ASK, &item.(*orderbookModel.AskPriceLevel).PriceLevel)
+		return true
+	})
+
+	stops := 0
+	checkStops := func(side model.Side, level *orderbookModel.StopLevel) {
+		if level.Orders.Len() == 0 {
+			errs = append(errs, fmt.Errorf("%s stop level %d is empty", sideName(side), level.StopPrice))
+		}
+		for _, order := range level.Orders.Orders() {
+			stops++
+			seen[order.GetId()]++
+			if order.GetSide() != side || order.GetStopPrice() != level.StopPrice || !order.GetType().IsStop() {
+				errs = append(errs, fmt.Errorf("order %d (%s type %d stop %d) waits in %s stop level %d", order.GetId(), sideName(order.GetSide()), order.GetType(), order.GetStopPrice(), sideName(side), level.StopPrice))
+			}
+			if orderbookModel.StopLevelOf(order) != level {
+				errs = append(errs, fmt.Errorf("stop order %d does not point back to stop level %d", order.GetId(), level.StopPrice))
+			}
+			if o.orders[order.GetId()] != order {
+				errs = append(errs, fmt.Errorf("stop order %d is not the order looked up by its id", order.GetId()))
+			}
+			errs = append(errs, checkQuantities(order)...)
+		}
+	}
+	o.stops.buyStops.Ascend(func(item btree.Item) bool {
+		checkStops(model.BID, &item.(*orderbookModel.BuyStopLevel).StopLevel)
+		return true
+	})
+	o.stops.sellStops.Ascend(func(item btree.Item) bool {
+		checkStops(model.ASK, &item.(*orderbookModel.SellStopLevel).StopLevel)
+		return true
+	})
+	if stops != o.stops.Len() {
+		errs = append(errs, fmt.Errorf("trigger book counts %d stops, %d wait in it", o.stops.Len(), stops))
+	}
+
+	for id := range o.orders {
+		if seen[id] != 1 {
+			errs = append(errs, fmt.Errorf("order %d is on the books %d times", id, seen[id]))
+		}
+	}
+	for id := range seen {
+		if _, ok := o.orders[id]; !ok {
+			errs = append(errs, fmt.Errorf("order %d is on the books but cannot be looked up", id))
+		}
+	}
+
+	if !o.phase.IsAuction() {
+		bid, hasBid := o.bestOpposite(model.ASK)
+		ask, hasAsk := o.bestOpposite(model.BID)
+		if hasBid && hasAsk && bid.Price >= ask.Price {
+			errs = append(errs, fmt.Errorf("book is crossed in %s, best bid %d and best ask %d", o.phase, bid.Price, ask.Price))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func sideName(side model.Side) string {
+	if side == model.BID {
+		return "bid"
+	}
+	return "ask"
+}
+
+func checkQuantities(order *model.Order) []error {
+	var errs []error
+	if order.GetRemainingQuantity() == 0 {
+		errs = append(errs, fmt.Errorf("order %d is on the books with nothing open", order.GetId()))
+	}
+	if order.GetRemainingQuantity() > order.GetInitialQuantity() {
+		errs = append(errs, fmt.Errorf("order %d has %d open of the %d it was placed with", order.GetId(), order.GetRemainingQuantity(), order.GetInitialQuantity()))
+	}
+	if order.GetHiddenQuantity() > order.GetRemainingQuantity() {
+		errs = append(errs, fmt.Errorf("order %d hides %d with %d open", order.GetId(), order.GetHiddenQuantity(), order.GetRemainingQuantity()))
+	}
+	return errs
+}
+
+// CheckEvents verifies the events of one command conserve quantity: every trade is matched by
+// a fill of its buy order and one of its sell order for the same quantity, fills add up to the
+// trades on both sides, and what an order has open only drops by what it fills or is reduced by.
+func CheckEvents(events []model.Event) error {
+	var errs []error
+	var traded, bought, sold model.Quantity
+	fills := make(map[model.OrderId]model.Quantity)
+	remaining := make(map[model.OrderId]model.Quantity)
+	for _, event := range events {
+		switch event.Type {
+		case model.EVENT_TRADE:
+			traded += event.Quantity
+			fills[event.Trade.BuyOrderID] += event.Quantity
+			fills[event.Trade.SellOrderID] += event.Quantity
+			if event.Quantity == 0 || event.Quantity != event.Trade.Quantity {
+				errs = append(errs, fmt.Errorf("event %d: trade of %d reported as %d", event.Sequence, event.Trade.Quantity, event.Quantity))
+			}
+		case model.EVENT_ORDER_FILLED, model.EVENT_ORDER_PARTIALLY_FILLED:
+			if event.Side == model.BID {
+				bought += event.Quantity
+			} else {
+				sold += event.Quantity
+			}
+			fills[event.OrderID] -= event.Quantity
+			if (event.Type == model.EVENT_ORDER_FILLED) != (event.Remaining == 0) {
+				errs = append(errs, fmt.Errorf("event %d: %s of order %d leaves %d open", event.Sequence, event.Type, event.OrderID, event.Remaining))
+			}
+			errs = append(errs, checkRemaining(remaining, event)...)
+		case model.EVENT_ORDER_REDUCED:
+			if event.Quantity == 0 {
+				errs = append(errs, fmt.Errorf("event %d: order %d reduced by nothing", event.Sequence, event.OrderID))
+			}
+			errs = append(errs, checkRemaining(remaining, event)...)
+		}
+	}
+	if bought != traded || sold != traded {
+		errs = append(errs, fmt.Errorf("trades add up to %d, buy fills to %d and sell fills to %d", traded, bought, sold))
+	}
+	for id, unmatched := range fills {
+		if unmatched != 0 {
+			errs = append(errs, fmt.Errorf("order %d traded and filled quantities differ by %d", id, unmatched))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkRemaining checks a fill or reduction of an order takes exactly its quantity off what the
+// order's previous fill or reduction left open, and records what this one leaves.
+func checkRemaining(remaining map[model.OrderId]model.Quantity, event model.Event) []error {
+	var errs []error
+	if last, ok := remaining[event.OrderID]; ok && event.Remaining+event.Quantity != last {
+		errs = append(errs, fmt.Errorf("event %d: order %d had %d open, lost %d to %s and has %d open", event.Sequence, event.OrderID, last, event.Quantity, event.Type, event.Remaining))
+	}
+	remaining[event.OrderID] = event.Remaining
+	return errs
+}
+
+// checkCommand runs the invariant checks after a command in builds with the invariants tag
+// and panics on a violation, so the command that broke the book is the one on the stack.
+func (o *orderBookEngineImpl) checkCommand(events []model.Event) {
+	if !CHECK_INVARIANTS {
+		return
+	}
+	if err := errors.Join(o.CheckInvariants(), CheckEvents(events)); err != nil {
+		panic(fmt.Sprintf("ticker %s: invariants broken after sequence %d: %v", o.ticker, o.sequence, err))
+	}
+}
@@ -0,0 +1,6 @@
+//go:build !invariants
+
+package engine
+
+// CHECK_INVARIANTS is off unless built with -tags invariants, the checks walk the whole book.
+const CHECK_INVARIANTS = false
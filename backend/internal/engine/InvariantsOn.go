@@ -0,0 +1,6 @@
+//go:build invariants
+
+package engine
+
+// CHECK_INVARIANTS makes every command check the book after it is applied, see checkCommand.
+const CHECK_INVARIANTS = true
@@ -0,0 +1,211 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/Yusufzhafir/go-orderbook/backend/pkg/clock"
+	"github.com/Yusufzhafir/go-orderbook/backend/pkg/model"
+)
+
+// FLOW_MID is the price the generated orders are centered on, FLOW_WIDTH how far either way
+// they go, so most of the flow crosses and a good share of it trades.
+const (
+	FLOW_MID   = 100
+	FLOW_WIDTH = 8
+)
+
+// commandStream reads the commands of a flow out of bytes, so a seed and a fuzzer's input
+// drive the same code. Reads past the end return zero.
+type commandStream struct {
+	data []byte
+	pos  int
+}
+
+func (s *commandStream) done() bool {
+	return s.pos >= len(s.data)
+}
+
+func (s *commandStream) byte() byte {
+	if s.done() {
+		return 0
+	}
+	s.pos++
+	return s.data[s.pos-1]
+}
+
+// intn is a number below n taken from the next byte.
+func (s *commandStream) intn(n int) int {
+	return int(s.byte()) % n
+}
+
+func (s *commandStream) price() model.Price {
+	return model.Price(FLOW_MID - FLOW_WIDTH + s.intn(2*FLOW_WIDTH+1))
+}
+
+func (s *commandStream) quantity() model.Quantity {
+	return model.Quantity(1 + s.intn(20))
+}
+
+// flowBook is an engine under test together with the ids it handed out, so cancels and amends
+// can pick orders that may still be open.
+type flowBook struct {
+	book   OrderBookEngine
+	clock  *clock.Manual
+	events []model.Event
+	ids    []model.OrderId
+	nextID model.OrderId
+}
+
+// newFlowBook builds the book of the flow s describes on top of opts, which can bring a journal
+// and a clock and trade id generator of their own.
+func newFlowBook(s *commandStream, opts OrderBookEngineOpts) *flowBook {
+	policies := []MatchingPolicy{FIFOPolicy{}, ProRataPolicy{}, ProRataTopOrderPolicy{}}
+	opts.Ticker = "FLOW"
+	opts.MatchingPolicy = policies[s.intn(len(policies))]
+	if opts.Clock == nil {
+		opts.Clock = clock.NewManual(time.Date(2025, 1, 2, 9, 0, 0, 0, time.UTC))
+	}
+	if s.intn(2) == 1 {
+		opts.PriceBands = PriceBands{DynamicBps: 1500, BreakerBps: 500, BreakerWindow: time.Minute, HaltDuration: 10 * time.Second}
+	}
+	fb := &flowBook{book: NewOrderBookEngine(opts), clock: opts.Clock.(*clock.Manual)}
+	fb.book.Initialize()
+	fb.book.RegisterEventHandler(func(events []model.Event) {
+		fb.events = append(fb.events, events...)
+	})
+	return fb
+}
+
+// order builds the next order of the flow, any type, with the owners, self-trade prevention,
+// icebergs and post-only the engine has to cope with.
+func (fb *flowBook) order(s *commandStream) model.Order {
+	fb.nextID++
+	side := model.Side(s.intn(2))
+	orderType := model.OrderType(s.intn(int(model.ORDER_DAY) + 1))
+	price, quantity := s.price(), s.quantity()
+
+	var order model.Order
+	switch orderType {
+	case model.ORDER_MARKET:
+		order = model.NewMarketOrder(fb.nextID, side, quantity, uint64(s.intn(4))*500)
+	case model.ORDER_STOP_MARKET:
+		order = model.NewStopOrder(fb.nextID, side, s.price(), price, quantity, orderType, uint64(s.intn(4))*500)
+	case model.ORDER_STOP_LIMIT:
+		order = model.NewStopOrder(fb.nextID, side, s.price(), price, quantity, orderType, 0)
+	default:
+		order = model.NewOrder(fb.nextID, side, price, quantity, orderType)
+	}
+	order.SetOwner(int64(1 + s.intn(3)))
+	order.SetSelfTradePrevention(model.SelfTradePrevention(s.intn(int(model.STP_DECREMENT_AND_CANCEL) + 1)))
+	if orderType.RestsOnBook() {
+		if peak := model.Quantity(s.intn(8)); peak > 0 && peak < quantity {
+			order.SetPeakSize(peak)
+		}
+		if s.intn(3) == 0 {
+			order.SetPostOnly(model.PostOnly(1 + s.intn(2)))
+		}
+	}
+	return order
+}
+
+// pick returns one of the ids handed out so far, ok is false before the first.
+func (fb *flowBook) pick(s *commandStream) (model.OrderId, bool) {
+	if len(fb.ids) == 0 {
+		return 0, false
+	}
+	return fb.ids[(int(s.byte())<<8|int(s.byte()))%len(fb.ids)], true
+}
+
+// step applies the next command of s and describes it. Rejections are part of the flow.
+func (fb *flowBook) step(s *commandStream) string {
+	fb.clock.Advance(time.Duration(s.intn(4)) * time.Second)
+	switch op := s.intn(16); {
+	case op < 10:
+		order := fb.order(s)
+		fb.ids = append(fb.ids, order.GetId())
+		_, err := fb.book.AddOrder(order)
+		return fmt.Sprintf("add order %d (type %d side %d price %d stop %d quantity %d): %v",
+			order.GetId(), order.GetType(), order.GetSide(), order.GetPrice(), order.GetStopPrice(), order.GetInitialQuantity(), err)
+	case op < 13:
+		id, ok := fb.pick(s)
+		if !ok {
+			return "cancel of nothing"
+		}
+		return fmt.Sprintf("cancel order %d: %v", id, fb.book.CancelOrder(id))
+	case op < 15:
+		id, ok := fb.pick(s)
+		if !ok {
+			return "amend of nothing"
+		}
+		order, resting := fb.book.GetOrder(id)
+		if !resting {
+			return fmt.Sprintf("amend of closed order %d", id)
+		}
+		modify := model.OrderModify{ID: id, Side: order.GetSide(), Price: s.price(), Quantity: order.GetFilledQuantity() + s.quantity()}
+		if s.intn(2) == 0 {
+			// same price, often smaller, the amend that keeps the queue position
+			modify.Price = order.GetPrice()
+		}
+		_, err := fb.book.ModifyOrder(modify, order.GetType())
+		return fmt.Sprintf("amend order %d to %d at %d: %v", id, modify.Quantity, modify.Price, err)
+	default:
+		if s.intn(4) == 0 {
+			status := model.TickerStatus(s.intn(int(model.TICKER_STATUS_CLOSED) + 1))
+			if s.intn(2) > 0 {
+				// an operator mostly reopens the ticker, closing it empties the book
+				status = model.TICKER_STATUS_OPEN
+			}
+			_, err := fb.book.SetTickerStatus(status)
+			return fmt.Sprintf("set status %s: %v", status, err)
+		}
+		phase := model.TradingPhase(s.intn(int(model.PHASE_CLOSED) + 1))
+		if s.intn(3) > 0 {
+			// mostly trade continuously, auctions and the close are the exception
+			phase = model.PHASE_CONTINUOUS
+		}
+		_, err := fb.book.SetTradingPhase(phase)
+		return fmt.Sprintf("move to phase %s: %v", phase, err)
+	}
+}
+
+// runFlow applies every command of data to a new book and checks the book and the events of
+// each command as it goes.
+func runFlow(t *testing.T, data []byte) {
+	t.Helper()
+	s := &commandStream{data: data}
+	fb := newFlowBook(s, OrderBookEngineOpts{})
+	for step := 0; !s.done(); step++ {
+		fb.events = fb.events[:0]
+		command := fb.step(s)
+		if err := errors.Join(fb.book.CheckInvariants(), CheckEvents(fb.events)); err != nil {
+			t.Fatalf("command %d, %s: %v", step, command, err)
+		}
+	}
+}
+
+func TestRandomOrderFlow(t *testing.T) {
+	seeds, length := 50, 20_000
+	if testing.Short() {
+		seeds, length = 5, 5_000
+	}
+	for seed := 1; seed <= seeds; seed++ {
+		t.Run(fmt.Sprintf("seed=%d", seed), func(t *testing.T) {
+			data := make([]byte, length)
+			rand.New(rand.NewSource(int64(seed))).Read(data)
+			runFlow(t, data)
+		})
+	}
+}
+
+func FuzzOrderBook(f *testing.F) {
+	for seed := 1; seed <= 8; seed++ {
+		data := make([]byte, 512)
+		rand.New(rand.NewSource(int64(seed))).Read(data)
+		f.Add(data)
+	}
+	f.Fuzz(runFlow)
+}
@@ -0,0 +1,260 @@
+package engine
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"time"
+
+	"github.com/Yusufzhafir/go-orderbook/backend/pkg/model"
+)
+
+type JournalCommand uint8
+
+const (
+	JOURNAL_ADD JournalCommand = iota + 1
+	JOURNAL_CANCEL
+	JOURNAL_MODIFY
+	JOURNAL_RESTORE // an order put back on the book at startup without matching
+	JOURNAL_PHASE
+	JOURNAL_TRADE_IDS // the trade ids the command of the same sequence printed, written after it
+	JOURNAL_STATUS    // an operator changed the ticker status
+)
+
+// JournalEntry is one command as the engine received it. Sequence numbers are per ticker,
+// start at 1 and have no gaps.
+type JournalEntry struct {
+	Sequence  uint64
+	Time      time.Time // when the engine applied the command, replays run on this clock
+	Command   JournalCommand
+	Order     model.Order        // JOURNAL_ADD, JOURNAL_RESTORE
+	OrderID   model.OrderId      // JOURNAL_CANCEL
+	Modify    model.OrderModify  // JOURNAL_MODIFY
+	OrderType model.OrderType    // JOURNAL_MODIFY
+	Phase     model.TradingPhase // JOURNAL_PHASE
+	TradeIDs  []uint64           // JOURNAL_TRADE_IDS
+	Status    model.TickerStatus // JOURNAL_STATUS
+}
+
+// MAX_JOURNAL_RECORD bounds a record's payload, anything longer can only be a damaged length.
+// A command that prints more than TRADE_IDS_PER_RECORD trades journals its ids over several records.
+const (
+	MAX_JOURNAL_RECORD   = 1 << 16
+	TRADE_IDS_PER_RECORD = 4096
+)
+
+// Record layout, little-endian: payload len u32 | crc32 of payload u32 | payload, where the
+// payload is sequence u64 | time unix nanoseconds i64 | command u8 | body. An add or restore
+// carries the order as encoded by model.Order.MarshalBinary, a cancel the order id u64, a modify
+// id u64 | price u64 | quantity u64 | side u8 | order type u8, a phase change the phase u8,
+// trade ids one u64 per trade and a status change the status u8.
+
+func (e *JournalEntry) appendBinary(buf []byte) ([]byte, error) {
+	buf = binary.LittleEndian.AppendUint64(buf, e.Sequence)
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(e.Time.UnixNano()))
+	buf = append(buf, byte(e.Command))
+	switch e.Command {
+	case JOURNAL_ADD, JOURNAL_RESTORE:
+		return e.Order.AppendBinary(buf)
+	case JOURNAL_CANCEL:
+		return binary.LittleEndian.AppendUint64(buf, uint64(e.OrderID)), nil
+	case JOURNAL_MODIFY:
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(e.Modify.ID))
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(e.Modify.Price))
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(e.Modify.Quantity))
+		return append(buf, byte(e.Modify.Side), byte(e.OrderType)), nil
+	case JOURNAL_PHASE:
+		return append(buf, byte(e.Phase)), nil
+	case JOURNAL_STATUS:
+		return append(buf, byte(e.Status)), nil
+	case JOURNAL_TRADE_IDS:
+		for _, id := range e.TradeIDs {
+			buf = binary.LittleEndian.AppendUint64(buf, id)
+		}
+		return buf, nil
+	}
+	return nil, fmt.Errorf("unknown journal command %d", e.Command)
+}
+
+func (e *JournalEntry) unmarshalBinary(payload []byte) error {
+	if len(payload) < 17 {
+		return fmt.Errorf("journal entry of %d bytes is too short", len(payload))
+	}
+	e.Sequence = binary.LittleEndian.Uint64(payload)
+	e.Time = time.Unix(0, int64(binary.LittleEndian.Uint64(payload[8:])))
+	e.Command = JournalCommand(payload[16])
+	body := payload[17:]
+	switch e.Command {
+	case JOURNAL_ADD, JOURNAL_RESTORE:
+		return e.Order.UnmarshalBinary(body)
+	case JOURNAL_CANCEL:
+		if len(body) != 8 {
+			return fmt.Errorf("journal cancel %d has a %d byte body", e.Sequence, len(body))
+		}
+		e.OrderID = model.OrderId(binary.LittleEndian.Uint64(body))
+		return nil
+	case JOURNAL_MODIFY:
+		if len(body) != 26 {
+			return fmt.Errorf("journal modify %d has a %d byte body", e.Sequence, len(body))
+		}
+		e.Modify = model.OrderModify{
+			ID:       model.OrderId(binary.LittleEndian.Uint64(body)),
+			Price:    model.Price(binary.LittleEndian.Uint64(body[8:])),
+			Quantity: model.Quantity(binary.LittleEndian.Uint64(body[16:])),
+			Side:     model.Side(body[24]),
+		}
+		e.OrderType = model.OrderType(body[25])
+		return nil
+	case JOURNAL_PHASE:
+		if len(body) != 1 {
+			return fmt.Errorf("journal phase %d has a %d byte body", e.Sequence, len(body))
+		}
+		e.Phase = model.TradingPhase(body[0])
+		return nil
+	case JOURNAL_STATUS:
+		if len(body) != 1 {
+			return fmt.Errorf("journal status %d has a %d byte body", e.Sequence, len(body))
+		}
+		e.Status = model.TickerStatus(body[0])
+		return nil
+	case JOURNAL_TRADE_IDS:
+		if len(body)%8 != 0 {
+			return fmt.Errorf("journal trade ids %d have a %d byte body", e.Sequence, len(body))
+		}
+		e.TradeIDs = make([]uint64, 0, len(body)/8)
+		for ; len(body) > 0; body = body[8:] {
+			e.TradeIDs = append(e.TradeIDs, binary.LittleEndian.Uint64(body))
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown journal command %d", e.Command)
+}
+
+type JournalOpts struct {
+	Path string
+	Sync bool // fsync after every entry, survives power loss rather than just a process crash
+}
+
+// Journal is an append-only file of the commands an engine received, written before the
+// engine applies them. It is not safe for concurrent use, the engine's worker owns it.
+type Journal struct {
+	file *os.File
+	sync bool
+	buf  []byte
+}
+
+// OpenJournal opens the journal at opts.Path for appending, creating it when missing. A record
+// torn by a crash mid-write is cut off so new entries follow the last complete one.
+func OpenJournal(opts JournalOpts) (*Journal, error) {
+	file, err := os.OpenFile(opts.Path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	valid, err := scanJournal(file, func(JournalEntry) error { return nil })
+	if err != nil && !errors.Is(err, ErrJournalTorn) {
+		file.Close()
+		return nil, err
+	}
+	if err := file.Truncate(valid); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if _, err := file.Seek(valid, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &Journal{file: file, sync: opts.Sync}, nil
+}
+
+// Append writes entry to the end of the journal.
+func (j *Journal) Append(entry JournalEntry) error {
+	payload, err := entry.appendBinary(j.buf[:0])
+	if err != nil {
+		return err
+	}
+	j.buf = payload
+
+	record := make([]byte, 8, 8+len(payload))
+	binary.LittleEndian.PutUint32(record, uint32(len(payload)))
+	binary.LittleEndian.PutUint32(record[4:], crc32.ChecksumIEEE(payload))
+	if _, err := j.file.Write(append(record, payload...)); err != nil {
+		return err
+	}
+	if j.sync {
+		return j.file.Sync()
+	}
+	return nil
+}
+
+// Truncate empties the journal, once a snapshot covers everything in it.
+func (j *Journal) Truncate() error {
+	if err := j.file.Truncate(0); err != nil {
+		return err
+	}
+	_, err := j.file.Seek(0, io.SeekStart)
+	return err
+}
+
+func (j *Journal) Close() error {
+	return j.file.Close()
+}
+
+// ErrJournalTorn means the journal ends in an incomplete or damaged record, as left by a crash
+// mid-write. Everything before it is intact.
+var ErrJournalTorn = errors.New("journal ends in a torn record")
+
+// ReadJournal calls fn with every entry of the journal at path in order. A torn tail ends the
+// read without error, there is nothing after it to recover.
+func ReadJournal(path string, fn func(JournalEntry) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = scanJournal(file, fn)
+	if errors.Is(err, ErrJournalTorn) {
+		return nil
+	}
+	return err
+}
+
+// scanJournal reads records from the start of file and returns the offset after the last complete one.
+func scanJournal(file *os.File, fn func(JournalEntry) error) (int64, error) {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	reader := bufio.NewReader(file)
+	var valid int64
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			if err == io.EOF {
+				return valid, nil
+			}
+			return valid, ErrJournalTorn
+		}
+		size := binary.LittleEndian.Uint32(header)
+		if size > MAX_JOURNAL_RECORD {
+			return valid, ErrJournalTorn
+		}
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(reader, payload); err != nil {
+			return valid, ErrJournalTorn
+		}
+		if crc32.ChecksumIEEE(payload) != binary.LittleEndian.Uint32(header[4:]) {
+			return valid, ErrJournalTorn
+		}
+		var entry JournalEntry
+		if err := entry.unmarshalBinary(payload); err != nil {
+			return valid, err
+		}
+		if err := fn(entry); err != nil {
+			return valid, err
+		}
+		valid += int64(len(header) + len(payload))
+	}
+}
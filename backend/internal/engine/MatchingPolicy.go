@@ -0,0 +1,125 @@
+package engine
+
+import (
+	"fmt"
+	"math/bits"
+
+	"github.com/Yusufzhafir/go-orderbook/backend/pkg/model"
+)
+
+// MatchingPolicy shares an incoming quantity among the resting orders of one price level.
+type MatchingPolicy interface {
+	// Allocate returns how much of quantity each resting order gets, in the order the fills
+	// are applied. resting is in time priority and only displayed quantity may be allocated.
+	Allocate(resting *model.OrderQueue, quantity model.Quantity) []Allocation
+}
+
+// Allocation is the part of an incoming quantity given to one resting order.
+type Allocation struct {
+	Order    *model.Order
+	Quantity model.Quantity
+}
+
+// names a ticker uses to pick its matching policy
+const (
+	MATCHING_FIFO               = "FIFO"
+	MATCHING_PRO_RATA           = "PRO_RATA"
+	MATCHING_PRO_RATA_TOP_ORDER = "PRO_RATA_TOP_ORDER"
+)
+
+// MatchingPolicyByName returns the policy registered under name, an empty name means FIFO.
+func MatchingPolicyByName(name string) (MatchingPolicy, error) {
+	switch name {
+	case "", MATCHING_FIFO:
+		return FIFOPolicy{}, nil
+	case MATCHING_PRO_RATA:
+		return ProRataPolicy{}, nil
+	case MATCHING_PRO_RATA_TOP_ORDER:
+		return ProRataTopOrderPolicy{}, nil
+	}
+	return nil, fmt.Errorf("unknown matching policy %q", name)
+}
+
+// FIFOPolicy is price-time priority: the oldest order is filled first and the next one
+// only gets what it leaves. With 3, 5 and 2 resting, 6 incoming fills 3 then 3.
+type FIFOPolicy struct{}
+
+func (FIFOPolicy) Allocate(resting *model.OrderQueue, quantity model.Quantity) []Allocation {
+	return allocateFIFO(resting.Front(), quantity)
+}
+
+// ProRataPolicy splits the incoming quantity in proportion to displayed size, rounding
+// down, then hands the units lost to rounding out one at a time in time priority.
+// With 30, 50 and 20 resting, 10 incoming fills 3, 5 and 2.
+type ProRataPolicy struct{}
+
+func (ProRataPolicy) Allocate(resting *model.OrderQueue, quantity model.Quantity) []Allocation {
+	return allocateProRata(resting.Front(), quantity)
+}
+
+// ProRataTopOrderPolicy fills the order at the front of the queue first, up to its displayed
+// size, and shares the rest pro-rata among the others. With 30, 50 and 20 resting,
+// 40 incoming fills 30, then 8 and 2.
+type ProRataTopOrderPolicy struct{}
+
+func (ProRataTopOrderPolicy) Allocate(resting *model.OrderQueue, quantity model.Quantity) []Allocation {
+	top := resting.Front()
+	if top == nil {
+		return nil
+	}
+	fill := min(top.GetDisplayedQuantity(), quantity)
+	allocations := []Allocation{{Order: top, Quantity: fill}}
+	return append(allocations, allocateProRata(top.Next(), quantity-fill)...)
+}
+
+// allocateFIFO walks the queue from first and stops as soon as quantity is used up.
+func allocateFIFO(first *model.Order, quantity model.Quantity) []Allocation {
+	allocations := make([]Allocation, 0)
+	for order := first; order != nil && quantity > 0; order = order.Next() {
+		fill := min(order.GetDisplayedQuantity(), quantity)
+		if fill == 0 {
+			continue
+		}
+		allocations = append(allocations, Allocation{Order: order, Quantity: fill})
+		quantity -= fill
+	}
+	return allocations
+}
+
+// allocateProRata shares quantity among the queue from first to the back.
+func allocateProRata(first *model.Order, quantity model.Quantity) []Allocation {
+	var total model.Quantity
+	resting := make([]*model.Order, 0)
+	for order := first; order != nil; order = order.Next() {
+		total += order.GetDisplayedQuantity()
+		resting = append(resting, order)
+	}
+	if quantity >= total {
+		// enough for everyone, nothing to share
+		return allocateFIFO(first, quantity)
+	}
+
+	shares := make([]model.Quantity, len(resting))
+	left := quantity
+	for i, order := range resting {
+		// quantity * displayed / total without overflowing, quantity < total keeps it in range
+		hi, lo := bits.Mul64(uint64(quantity), uint64(order.GetDisplayedQuantity()))
+		share, _ := bits.Div64(hi, lo, uint64(total))
+		shares[i] = model.Quantity(share)
+		left -= shares[i]
+	}
+	for i := 0; left > 0; i = (i + 1) % len(resting) {
+		if shares[i] < resting[i].GetDisplayedQuantity() {
+			shares[i]++
+			left--
+		}
+	}
+
+	allocations := make([]Allocation, 0, len(resting))
+	for i, order := range resting {
+		if shares[i] > 0 {
+			allocations = append(allocations, Allocation{Order: order, Quantity: shares[i]})
+		}
+	}
+	return allocations
+}
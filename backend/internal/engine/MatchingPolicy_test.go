@@ -0,0 +1,175 @@
+package engine
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/Yusufzhafir/go-orderbook/backend/pkg/model"
+)
+
+// restingOrder is one order of a test queue, an iceberg when peak is set.
+type restingOrder struct {
+	quantity model.Quantity
+	peak     model.Quantity
+}
+
+// allocated is what a policy gave the order at queue position index.
+type allocated struct {
+	index    int
+	quantity model.Quantity
+}
+
+func TestMatchingPolicies(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   string
+		resting  []restingOrder
+		incoming model.Quantity
+		want     []allocated
+	}{
+		{
+			name:     "fifo fills in time priority",
+			policy:   MATCHING_FIFO,
+			resting:  []restingOrder{{quantity: 3}, {quantity: 5}, {quantity: 2}},
+			incoming: 6,
+			want:     []allocated{{0, 3}, {1, 3}},
+		},
+		{
+			name:     "fifo takes the whole level",
+			policy:   MATCHING_FIFO,
+			resting:  []restingOrder{{quantity: 3}, {quantity: 5}, {quantity: 2}},
+			incoming: 20,
+			want:     []allocated{{0, 3}, {1, 5}, {2, 2}},
+		},
+		{
+			name:     "fifo fills only the displayed slice of an iceberg",
+			policy:   MATCHING_FIFO,
+			resting:  []restingOrder{{quantity: 10, peak: 2}, {quantity: 5}},
+			incoming: 4,
+			want:     []allocated{{0, 2}, {1, 2}},
+		},
+		{
+			name:     "pro rata splits evenly divisible quantity",
+			policy:   MATCHING_PRO_RATA,
+			resting:  []restingOrder{{quantity: 30}, {quantity: 50}, {quantity: 20}},
+			incoming: 10,
+			want:     []allocated{{0, 3}, {1, 5}, {2, 2}},
+		},
+		{
+			name:     "pro rata hands the rounding remainder out in time priority",
+			policy:   MATCHING_PRO_RATA,
+			resting:  []restingOrder{{quantity: 1}, {quantity: 1}, {quantity: 1}},
+			incoming: 2,
+			want:     []allocated{{0, 1}, {1, 1}},
+		},
+		{
+			name:     "pro rata remainder skips orders already at their displayed size",
+			policy:   MATCHING_PRO_RATA,
+			resting:  []restingOrder{{quantity: 1}, {quantity: 7}, {quantity: 2}},
+			incoming: 7,
+			// shares round down to 0, 4 and 1, the first order takes one of the two left over
+			want: []allocated{{0, 1}, {1, 5}, {2, 1}},
+		},
+		{
+			name:     "pro rata weighs icebergs by their displayed slice only",
+			policy:   MATCHING_PRO_RATA,
+			resting:  []restingOrder{{quantity: 100, peak: 10}, {quantity: 10}},
+			incoming: 10,
+			want:     []allocated{{0, 5}, {1, 5}},
+		},
+		{
+			name:     "pro rata with enough for the level fills every displayed quantity",
+			policy:   MATCHING_PRO_RATA,
+			resting:  []restingOrder{{quantity: 4}, {quantity: 20, peak: 6}},
+			incoming: 10,
+			want:     []allocated{{0, 4}, {1, 6}},
+		},
+		{
+			name:     "pro rata with more than the level stops at the displayed quantity",
+			policy:   MATCHING_PRO_RATA,
+			resting:  []restingOrder{{quantity: 4}, {quantity: 20, peak: 6}},
+			incoming: 50,
+			want:     []allocated{{0, 4}, {1, 6}},
+		},
+		{
+			name:     "pro rata top order fills the front first",
+			policy:   MATCHING_PRO_RATA_TOP_ORDER,
+			resting:  []restingOrder{{quantity: 30}, {quantity: 50}, {quantity: 20}},
+			incoming: 40,
+			want:     []allocated{{0, 30}, {1, 8}, {2, 2}},
+		},
+		{
+			name:     "pro rata top order gives the front all of a small quantity",
+			policy:   MATCHING_PRO_RATA_TOP_ORDER,
+			resting:  []restingOrder{{quantity: 30}, {quantity: 50}},
+			incoming: 20,
+			want:     []allocated{{0, 20}},
+		},
+		{
+			name:     "pro rata top order fills only the displayed slice of an iceberg at the front",
+			policy:   MATCHING_PRO_RATA_TOP_ORDER,
+			resting:  []restingOrder{{quantity: 50, peak: 5}, {quantity: 3}, {quantity: 1}},
+			incoming: 7,
+			// 5 to the front, the 2 left split 1.5 and 0.5, rounding hands the last unit to the older order
+			want: []allocated{{0, 5}, {1, 2}},
+		},
+		{
+			name:     "pro rata top order with more than the level fills every displayed quantity",
+			policy:   MATCHING_PRO_RATA_TOP_ORDER,
+			resting:  []restingOrder{{quantity: 30}, {quantity: 50, peak: 10}},
+			incoming: 100,
+			want:     []allocated{{0, 30}, {1, 10}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			policy, err := MatchingPolicyByName(test.policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var queue model.OrderQueue
+			position := make(map[*model.Order]int)
+			for i, spec := range test.resting {
+				order := model.NewOrder(model.OrderId(i+1), model.ASK, 100, spec.quantity, model.ORDER_GOOD_TILL_CANCEL)
+				if spec.peak > 0 {
+					order.SetPeakSize(spec.peak)
+				}
+				queue.PushBack(&order)
+				position[&order] = i
+			}
+
+			got := make([]allocated, 0)
+			var total model.Quantity
+			for _, allocation := range policy.Allocate(&queue, test.incoming) {
+				got = append(got, allocated{position[allocation.Order], allocation.Quantity})
+				total += allocation.Quantity
+				if allocation.Quantity > allocation.Order.GetDisplayedQuantity() {
+					t.Errorf("order %d allocated %d with %d displayed", allocation.Order.GetId(), allocation.Quantity, allocation.Order.GetDisplayedQuantity())
+				}
+			}
+			if !slices.Equal(got, test.want) {
+				t.Errorf("allocated %v, want %v", got, test.want)
+			}
+			if total > test.incoming {
+				t.Errorf("allocated %d of an incoming %d", total, test.incoming)
+			}
+		})
+	}
+}
+
+func TestMatchingPolicyByName(t *testing.T) {
+	for name, want := range map[string]MatchingPolicy{
+		"":                          FIFOPolicy{},
+		MATCHING_FIFO:               FIFOPolicy{},
+		MATCHING_PRO_RATA:           ProRataPolicy{},
+		MATCHING_PRO_RATA_TOP_ORDER: ProRataTopOrderPolicy{},
+	} {
+		if got, err := MatchingPolicyByName(name); err != nil || got != want {
+			t.Errorf("MatchingPolicyByName(%q) = %T, %v", name, got, err)
+		}
+	}
+	if _, err := MatchingPolicyByName("LIFO"); err == nil {
+		t.Error("MatchingPolicyByName accepted an unknown policy")
+	}
+}
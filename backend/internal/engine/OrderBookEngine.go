@@ -3,57 +3,90 @@ package engine
 import (
 	"fmt"
 	"log"
+	"math"
 	"time"
 
 	orderbookModel "github.com/Yusufzhafir/go-orderbook/backend/internal/engine/model"
+	"github.com/Yusufzhafir/go-orderbook/backend/pkg/clock"
 	"github.com/Yusufzhafir/go-orderbook/backend/pkg/model"
+	"github.com/Yusufzhafir/go-orderbook/backend/pkg/snowflake"
 	"github.com/google/btree"
 )
 
 type OrderBookEngine interface {
-	AddOrder(order model.Order) ([]*model.Trade, error)
+	AddOrder(order model.Order) ([]model.Event, error)
 	CancelOrder(orderID model.OrderId) error
-	ModifyOrder(modify model.OrderModify, orderType model.OrderType) ([]*model.Trade, error)
+	ModifyOrder(modify model.OrderModify, orderType model.OrderType) ([]model.Event, error)
 	Initialize()
 	OrderSize() int
 	GetTopOfBook() *model.TopOfBook
 	GetOrderInfos() *model.MarketDepth
+	GetMarketDepth(levels int, bucket model.Price) *model.MarketDepth
+	GetOrderBookL3(side model.Side, offset, limit int) *model.OrderBookL3
+	GetOrder(orderID model.OrderId) (model.Order, bool)
+	RegisterCancelHandler(handler CancelHandler)
+	RegisterReduceHandler(handler ReduceHandler)
+	Snapshot() ([]byte, error)
+	Restore(data []byte) error
+	Sequence() uint64
+	RestoreOrder(order model.Order) error
+	SetTradingPhase(phase model.TradingPhase) ([]model.Event, error)
+	GetTradingPhase() model.TradingPhase
+	SetTickerStatus(status model.TickerStatus) ([]model.Event, error)
+	GetTickerState() model.TickerState
+	GetAuctionIndication() *model.AuctionIndication
+	GetHalt() *model.Halt
+	RegisterHaltHandler(handler HaltHandler)
+	Replay(entries []JournalEntry) ([]*model.Trade, error)
+	RegisterEventHandler(handler EventHandler)
+	EventSequence() uint64
+	CheckInvariants() error
 }
 
-type orderBookEngineImpl struct {
-	bids, asks *btree.BTree                   // price-level trees
-	orders     map[model.OrderId]*model.Order // lookup by ID
-	ticker     string
-}
+// CancelHandler is told about resting orders the engine cancels on its own, and about every
+// triggered stop that leaves the book without resting, such as a stop-market that fills or runs
+// out of liquidity. It gets the order as it was dropped, fills and spent notional included.
+type CancelHandler func(order model.Order)
 
-// Pop from front of slice (queue behavior - FIFO)
-func popFront[T any](slice []T) (T, []T) {
-	if len(slice) == 0 {
-		var zero T
-		return zero, slice
-	}
-	return slice[0], slice[1:]
-}
+// ReduceHandler is told when self-trade prevention takes reduced off a resting order that
+// stays on the book. It gets the order as it is after the reduction.
+type ReduceHandler func(order model.Order, reduced model.Quantity)
 
-// Pop from back of slice (stack behavior - LIFO)
-func popBack[T any](slice []T) (T, []T) {
-	if len(slice) == 0 {
-		var zero T
-		return zero, slice
-	}
-	last := len(slice) - 1
-	return slice[last], slice[:last]
-}
+// priceTick is the smallest price step, used to reprice post-only orders off the book.
+const priceTick model.Price = 1
 
-// Or modify slice in-place and return the popped element
-func popFrontInPlace[T any](slice *[]T) T {
-	if len(*slice) == 0 {
-		var zero T
-		return zero
-	}
-	item := (*slice)[0]
-	*slice = (*slice)[1:]
-	return item
+type orderBookEngineImpl struct {
+	bids, asks     *btree.BTree                   // price-level trees
+	stops          *triggerBook                   // stop orders waiting for their stop price
+	orders         map[model.OrderId]*model.Order // lookup by ID, stops included
+	ticker         string
+	lastTradePrice model.Price // 0 until the first trade
+	cancelHandler  CancelHandler
+	reduceHandler  ReduceHandler
+	haltHandler    HaltHandler
+	policy         MatchingPolicy // how a level is shared among its resting orders
+	journal        *Journal       // nil when commands are not journaled
+	clock          clock.Clock
+	ids            *snowflake.Generator // trade IDs
+	tradeIDs       []uint64             // trade IDs the command being applied drew, journaled after it
+	replayIDs      []uint64             // trade IDs the command being replayed printed the first time
+	replaying      bool
+	sequence       uint64    // journal sequence of the last command applied
+	now            time.Time // when the command being applied was journaled
+	phase          model.TradingPhase
+	status         model.TickerStatus // what the operator set, on top of the phase
+
+	bands            PriceBands
+	staticReference  model.Price // last auction price, or the first trade without one
+	breakerReference model.Price // price the circuit breaker measures moves from
+	breakerSince     time.Time   // start of the breaker window
+	halt             model.Halt  // last breaker halt, over once Until has passed
+
+	eventHandler  EventHandler
+	eventSequence uint64                // sequence of the last event emitted
+	pending       []model.Event         // events of the command being applied
+	touched       []levelKey            // levels the command being applied changed, first touch first
+	touchedSet    map[levelKey]struct{} // same levels, for lookup
 }
 
 func (o *orderBookEngineImpl) canMatch(side model.Side, price model.Price) bool {
@@ -73,239 +106,684 @@ func (o *orderBookEngineImpl) canMatch(side model.Side, price model.Price) bool
 	return price <= bestBids
 }
 
-func (o *orderBookEngineImpl) matchOrder() []*model.Trade {
-	trades := make([]*model.Trade, 0)
-	for {
-		if o.bids.Len() == 0 || o.asks.Len() == 0 {
-			break
+// availableVolume sums the opposite side volume order could trade against at its price,
+// stopping at the level that reaches want. When self-trade prevention applies, resting orders
+// of the same owner are left out, they would be cancelled rather than traded, and ok is false
+// if a level it reaches holds one that would cancel or shrink order itself instead.
+func (o *orderBookEngineImpl) availableVolume(order *model.Order, want model.Quantity) (total model.Quantity, ok bool) {
+	ok = true
+	visit := func(level *orderbookModel.PriceLevel) bool {
+		if order.GetOwner() == 0 || order.GetSelfTradePrevention() == model.STP_NONE {
+			total += level.TotalVolume
+			return total < want
 		}
+		for resting := level.Orders.Front(); resting != nil; resting = resting.Next() {
+			switch selfTradeMode(order, resting) {
+			case model.STP_NONE:
+				total += resting.GetRemainingQuantity()
+			case model.STP_CANCEL_OLDEST:
+				// dropped as it is met, the incoming order carries on
+			default:
+				ok = false
+				return false
+			}
+		}
+		return total < want
+	}
 
-		asksPriceLevel := o.asks.Min().(*orderbookModel.AskPriceLevel)
-		bidsPriceLevel := o.bids.Min().(*orderbookModel.BidPriceLevel)
+	if order.GetSide() == model.BID {
+		o.asks.Ascend(func(item btree.Item) bool {
+			askLevel := item.(*orderbookModel.AskPriceLevel)
+			return askLevel.Price <= order.GetPrice() && visit(&askLevel.PriceLevel)
+		})
+		return total, ok
+	}
 
-		log.Default().Printf("this is the initial volume ask %d bid %d", asksPriceLevel.TotalVolume, bidsPriceLevel.TotalVolume)
-		if bidsPriceLevel.Price < asksPriceLevel.Price {
-			break
+	o.bids.Ascend(func(item btree.Item) bool {
+		bidLevel := item.(*orderbookModel.BidPriceLevel)
+		return bidLevel.Price >= order.GetPrice() && visit(&bidLevel.PriceLevel)
+	})
+	return total, ok
+}
+
+// passivePrice returns the most aggressive price on side that does not cross the opposite best.
+func (o *orderBookEngineImpl) passivePrice(side model.Side) (model.Price, bool) {
+	if side == model.BID {
+		bestAsk := o.asks.Min().(*orderbookModel.AskPriceLevel).Price
+		if bestAsk <= priceTick {
+			return 0, false
 		}
+		return bestAsk - priceTick, true
+	}
+
+	bestBid := o.bids.Min().(*orderbookModel.BidPriceLevel).Price
+	if bestBid > math.MaxUint64-priceTick {
+		return 0, false
+	}
+	return bestBid + priceTick, true
+}
 
-		for len(asksPriceLevel.Orders) > 0 && len(bidsPriceLevel.Orders) > 0 {
+// bestOpposite returns the best level an order on side would trade against.
+func (o *orderBookEngineImpl) bestOpposite(side model.Side) (*orderbookModel.PriceLevel, bool) {
+	if side == model.BID {
+		if o.asks.Len() == 0 {
+			return nil, false
+		}
+		return &o.asks.Min().(*orderbookModel.AskPriceLevel).PriceLevel, true
+	}
 
-			askOrder := asksPriceLevel.Orders[0]
-			bidOrder := bidsPriceLevel.Orders[0]
+	if o.bids.Len() == 0 {
+		return nil, false
+	}
+	return &o.bids.Min().(*orderbookModel.BidPriceLevel).PriceLevel, true
+}
 
-			bestQuantity := min(askOrder.GetRemainingQuantity(), bidOrder.GetRemainingQuantity())
-			bestPrice := min(askOrder.GetPrice(), bidOrder.GetPrice())
-			if askOrder.GetPrice() <= bidOrder.GetPrice() {
-				bestPrice = max(askOrder.GetPrice(), bidOrder.GetPrice())
-			}
-			askOrder.Fill(bestQuantity)
-			bidOrder.Fill(bestQuantity)
-
-			trade := model.Trade{
-				MakerID:   askOrder.GetId(),
-				TakerID:   bidOrder.GetId(),
-				Price:     bestPrice,
-				Quantity:  bestQuantity,
-				Side:      model.BID,
-				Ticker:    o.ticker,
-				Timestamp: time.Now(),
-			}
-			if askOrder.GetType() == model.ORDER_FILL_AND_KILL {
-				trade.Side = model.ASK
-			}
-			trades = append(trades, &trade)
+// dropLevelIfEmpty deletes level from the tree of side once its last order is gone.
+func (o *orderBookEngineImpl) dropLevelIfEmpty(side model.Side, level *orderbookModel.PriceLevel) {
+	if level.Orders.Len() > 0 {
+		return
+	}
+	if side == model.ASK {
+		o.asks.Delete(orderbookModel.NewAskPriceLevel(level.Price))
+	} else {
+		o.bids.Delete(orderbookModel.NewBidPriceLevel(level.Price))
+	}
+}
 
-			asksPriceLevel.TotalVolume -= bestQuantity
-			bidsPriceLevel.TotalVolume -= bestQuantity
-			if askOrder.IsFilled() {
-				delete(o.orders, askOrder.GetId())
-				asksPriceLevel.Orders = asksPriceLevel.Orders[1:] // Pop front
-			}
-			if bidOrder.IsFilled() {
-				delete(o.orders, bidOrder.GetId())
-				bidsPriceLevel.Orders = bidsPriceLevel.Orders[1:]
-			}
+// matchOrder trades taker against the opposite side of the book one level at a time, sharing
+// each level among its resting orders as the matching policy allocates it. It reports whether
+// self-trade prevention or a circuit breaker cancelled the taker, in which case nothing of it
+// may rest.
+func (o *orderBookEngineImpl) matchOrder(taker *model.Order) ([]*model.Trade, bool) {
+	trades := make([]*model.Trade, 0)
+	for !taker.IsFilled() {
+		level, ok := o.bestOpposite(taker.GetSide())
+		if !ok {
+			break
+		}
+		if (taker.GetSide() == model.BID && level.Price > taker.GetPrice()) ||
+			(taker.GetSide() == model.ASK && level.Price < taker.GetPrice()) {
+			break
+		}
+		// market buys stop once their notional cap cannot pay for another unit
+		want := taker.AffordableQuantity(level.Price, taker.GetRemainingQuantity())
+		if want == 0 {
+			break
+		}
+		// a halt cancels what is left of the taker, the trade that tripped it does not happen
+		if o.halted() || o.tripsBreaker(matchPrice(taker, level.Price)) {
+			return trades, true
+		}
 
-			if len(asksPriceLevel.Orders) == 0 {
-				o.asks.Delete(asksPriceLevel)
-			}
-			if len(bidsPriceLevel.Orders) == 0 {
-				o.bids.Delete(bidsPriceLevel)
+		allocations := o.policy.Allocate(&level.Orders, want)
+		if len(allocations) == 0 {
+			break
+		}
+		if resting := selfTradeIn(taker, allocations); resting != nil {
+			if o.preventSelfTrade(selfTradeMode(taker, resting), taker, resting) {
+				return trades, true
 			}
+			continue
 		}
 
-		log.Default().Printf("this is the initial volume ask %d bid %d", asksPriceLevel.TotalVolume, bidsPriceLevel.TotalVolume)
+		for _, allocation := range allocations {
+			trades = append(trades, o.fill(taker, allocation.Order, allocation.Quantity))
+			level.TotalVolume -= allocation.Quantity
+		}
+		o.touch(opposite(taker.GetSide()), level.Price)
+		o.tidyLevel(level, allocations)
 	}
 
-	//asuming all order that can be matched is already matched 3finished all orders that can be matched
-	if o.asks.Len() > 0 {
-		asksPriceLevel := o.asks.Min().(*orderbookModel.AskPriceLevel)
-		askOrder := asksPriceLevel.Orders[0]
-		if askOrder.GetType() == model.ORDER_FILL_AND_KILL {
-			o.CancelOrder(askOrder.GetId())
-		}
+	return trades, false
+}
+
+// fill trades quantity between taker and a resting order and emits the trade, then the fills
+// of the resting order and of the taker.
+func (o *orderBookEngineImpl) fill(taker, resting *model.Order, quantity model.Quantity) *model.Trade {
+	price := matchPrice(taker, resting.GetPrice())
+	taker.FillAt(quantity, price)
+	resting.FillAt(quantity, price)
+
+	trade := o.newTrade(resting, taker, price, quantity)
+	o.emitTrade(trade)
+	o.emitFill(resting, price, quantity)
+	o.emitFill(taker, price, quantity)
+	return trade
+}
+
+// newTrade is the trade of quantity at price between maker and taker, on the taker's side.
+func (o *orderBookEngineImpl) newTrade(maker, taker *model.Order, price model.Price, quantity model.Quantity) *model.Trade {
+	trade := &model.Trade{
+		ID:          o.nextTradeID(),
+		Side:        taker.GetSide(),
+		MakerID:     maker.GetId(),
+		TakerID:     taker.GetId(),
+		BuyOrderID:  taker.GetId(),
+		SellOrderID: maker.GetId(),
+		Price:       price,
+		Quantity:    quantity,
+		Timestamp:   o.now,
+		Ticker:      o.ticker,
 	}
-	if o.bids.Len() > 0 {
-		bidsPriceLevel := o.bids.Min().(*orderbookModel.BidPriceLevel)
+	if taker.GetSide() == model.ASK {
+		trade.BuyOrderID, trade.SellOrderID = maker.GetId(), taker.GetId()
+	}
+	return trade
+}
 
-		bidOrder := bidsPriceLevel.Orders[0]
-		if bidOrder.GetType() == model.ORDER_FILL_AND_KILL {
-			o.CancelOrder(bidOrder.GetId())
+// opposite is the side an order on side trades against.
+func opposite(side model.Side) model.Side {
+	if side == model.BID {
+		return model.ASK
+	}
+	return model.BID
+}
+
+// matchPrice is what taker trades at against a resting order at restingPrice. Crossed orders
+// trade at the bid, a market buy carries a sentinel price so it takes the ask.
+func matchPrice(taker *model.Order, restingPrice model.Price) model.Price {
+	if taker.GetSide() == model.ASK || taker.GetType() == model.ORDER_MARKET {
+		return restingPrice
+	}
+	return taker.GetPrice()
+}
+
+// tidyLevel drops the orders a round of fills completed and reloads icebergs whose slice
+// ran out; a refreshed slice loses time priority and joins the back of the queue.
+func (o *orderBookEngineImpl) tidyLevel(level *orderbookModel.PriceLevel, allocations []Allocation) {
+	side := model.ASK
+	for _, allocation := range allocations {
+		order := allocation.Order
+		side = order.GetSide()
+		if order.IsFilled() {
+			level.Remove(order)
+			delete(o.orders, order.GetId())
+			continue
+		}
+		if moved := order.RefreshPeak(); moved > 0 {
+			level.HiddenVolume -= moved
+			level.Orders.MoveToBack(order)
+			order.SetEnteredAt(o.now)
 		}
 	}
+	o.dropLevelIfEmpty(side, level)
+}
 
-	return trades
+// AddOrder applies an add and returns the events it caused, an ORDER_REJECTED with the error
+// when the order is refused.
+func (o *orderBookEngineImpl) AddOrder(order model.Order) ([]model.Event, error) {
+	if err := o.record(JournalEntry{Command: JOURNAL_ADD, Order: order}); err != nil {
+		return nil, err
+	}
+	_, err := o.submitOrder(order)
+	return o.flushEvents(), err
 }
 
-func (o *orderBookEngineImpl) AddOrder(order model.Order) ([]*model.Trade, error) {
+// submitOrder applies an add without journaling it.
+func (o *orderBookEngineImpl) submitOrder(order model.Order) ([]*model.Trade, error) {
+	trades, err := o.placeOrder(&order)
+	if err != nil {
+		o.emitOrder(model.EVENT_ORDER_REJECTED, &order, err.Error())
+	}
+	return trades, err
+}
+
+func (o *orderBookEngineImpl) placeOrder(order *model.Order) ([]*model.Trade, error) {
 	_, ok := o.orders[order.GetId()]
 	if ok {
 		return []*model.Trade{}, fmt.Errorf("order already exist for id %d", order.GetId())
 	}
+	if err := o.acceptsOrder(order); err != nil {
+		return []*model.Trade{}, err
+	}
 
-	if order.GetType() == model.ORDER_FILL_AND_KILL && !o.canMatch(order.GetSide(), order.GetPrice()) {
-		return []*model.Trade{}, fmt.Errorf("cannot fill and kill at that price for order id %d", order.GetId())
+	if order.GetType().IsStop() {
+		if err := o.addStop(order); err != nil {
+			return []*model.Trade{}, err
+		}
+		o.emitOrder(model.EVENT_ORDER_ACCEPTED, order, "")
+		return []*model.Trade{}, nil
 	}
 
-	o.orders[order.GetId()] = &order
+	if err := o.admit(order); err != nil {
+		return []*model.Trade{}, err
+	}
+	o.emitOrder(model.EVENT_ORDER_ACCEPTED, order, "")
+	trades := o.place(order)
+	return append(trades, o.releaseStops(trades)...), nil
+}
 
-	switch order.GetSide() {
-	case model.ASK:
-		priceLevel := &orderbookModel.AskPriceLevel{Price: order.GetPrice()}
+// acceptsOrder checks the ticker takes order in its current phase and price bands.
+func (o *orderBookEngineImpl) acceptsOrder(order *model.Order) error {
+	if err := o.status.CheckOrder(o.ticker); err != nil {
+		return err
+	}
+	if o.phase == model.PHASE_CLOSED {
+		return fmt.Errorf("ticker %s is closed, order id %d rejected", o.ticker, order.GetId())
+	}
+	if o.halted() {
+		return fmt.Errorf("ticker %s is halted until %s, order id %d rejected", o.ticker, o.halt.Until.Format(time.RFC3339), order.GetId())
+	}
+	if o.phase.IsAuction() && order.GetType().IsImmediate() {
+		return fmt.Errorf("immediate order id %d cannot be placed during %s", order.GetId(), o.phase)
+	}
+	return o.checkPriceBands(order)
+}
 
-		if !o.asks.Has(priceLevel) {
-			priceLevel.TotalVolume = 0
-			priceLevel.Orders = make([]*model.Order, 0)
-			o.asks.ReplaceOrInsert(priceLevel)
-		}
+// addStop parks a stop order in the trigger book. A stop the last trade already reached is
+// rejected, otherwise it would trigger on a price move that happened before it existed.
+func (o *orderBookEngineImpl) addStop(order *model.Order) error {
+	if err := o.checkStopPrice(order); err != nil {
+		return err
+	}
+	o.stops.add(order)
+	o.orders[order.GetId()] = order
+	return nil
+}
 
-		currentPriceLevel := o.asks.Get(priceLevel).(*orderbookModel.AskPriceLevel)
+// checkStopPrice refuses a stop the last trade already went through, it would wait for a trade
+// that has happened.
+func (o *orderBookEngineImpl) checkStopPrice(order *model.Order) error {
+	if o.lastTradePrice == 0 {
+		return nil
+	}
+	if order.GetSide() == model.BID && order.GetStopPrice() <= o.lastTradePrice {
+		return fmt.Errorf("buy stop price %d is not above the last trade %d for order id %d", order.GetStopPrice(), o.lastTradePrice, order.GetId())
+	}
+	if order.GetSide() == model.ASK && order.GetStopPrice() >= o.lastTradePrice {
+		return fmt.Errorf("sell stop price %d is not below the last trade %d for order id %d", order.GetStopPrice(), o.lastTradePrice, order.GetId())
+	}
+	return nil
+}
 
-		if currentPriceLevel == nil {
-			panic("WHAT THE HELL HAPPENED?!?!?")
+// releaseStops moves the stops crossed by trades into the book. The trades of a released
+// stop can cross further stops, so it keeps going until a round triggers nothing new.
+func (o *orderBookEngineImpl) releaseStops(trades []*model.Trade) []*model.Trade {
+	released := make([]*model.Trade, 0)
+	for len(trades) > 0 {
+		low, high := trades[0].Price, trades[0].Price
+		for _, trade := range trades {
+			low = min(low, trade.Price)
+			high = max(high, trade.Price)
+		}
+		o.setReferencePrices(trades, false)
+		if o.halted() {
+			// stops wait out a halt in the trigger book
+			break
 		}
 
-		currentPriceLevel.Orders = append(currentPriceLevel.Orders, &order)
-		currentPriceLevel.TotalVolume += order.GetInitialQuantity()
+		next := make([]*model.Trade, 0)
+		for _, stop := range o.stops.popTriggered(low, high) {
+			delete(o.orders, stop.GetId())
+			o.emitOrder(model.EVENT_ORDER_TRIGGERED, stop, "")
+			stop.Trigger()
+			quantity := stop.GetInitialQuantity()
+			stopTrades, err := o.addOrder(stop)
+			if err != nil {
+				log.Printf("triggered stop order id %d dropped: %v", stop.GetId(), err)
+				o.emitOrder(model.EVENT_ORDER_CANCELLED, stop, err.Error())
+			}
+			next = append(next, stopTrades...)
+			// a stop that did not rest is done, filled or not, and whatever it reserved but did not
+			// trade, self-trade reductions included, goes back through the cancel handler; one that
+			// rests reports its reduction like a maker would
+			_, resting := o.orders[stop.GetId()]
+			if !resting && o.cancelHandler != nil {
+				o.cancelHandler(*stop)
+			}
+			if resting && stop.GetInitialQuantity() < quantity && o.reduceHandler != nil {
+				o.reduceHandler(*stop, quantity-stop.GetInitialQuantity())
+			}
+		}
+		released = append(released, next...)
+		trades = next
+	}
+	return released
+}
 
-	case model.BID:
-		priceLevel := &orderbookModel.BidPriceLevel{Price: order.GetPrice()}
+// addOrder checks order against its type rules, matches it and rests what is left on the book.
+func (o *orderBookEngineImpl) addOrder(order *model.Order) ([]*model.Trade, error) {
+	if err := o.admit(order); err != nil {
+		return []*model.Trade{}, err
+	}
+	return o.place(order), nil
+}
 
-		if !o.bids.Has(priceLevel) {
-			priceLevel.TotalVolume = 0
-			priceLevel.Orders = make([]*model.Order, 0)
-			o.bids.ReplaceOrInsert(priceLevel)
-		}
+// admit checks order against its type rules without touching the book, repricing a post-only
+// order that would take liquidity when it asked for that.
+func (o *orderBookEngineImpl) admit(order *model.Order) error {
+	if o.phase.IsAuction() {
+		return nil
+	}
 
-		currentPriceLevel := o.bids.Get(priceLevel).(*orderbookModel.BidPriceLevel)
+	switch order.GetType() {
+	case model.ORDER_IMMEDIATE_OR_CANCEL:
+		if !o.canMatch(order.GetSide(), order.GetPrice()) {
+			return fmt.Errorf("cannot immediately match at that price for order id %d", order.GetId())
+		}
+	case model.ORDER_FILL_OR_KILL:
+		// check the whole quantity is reachable before touching the book, self-trade prevention
+		// must not cut a fill or kill short once it trades
+		available, ok := o.availableVolume(order, order.GetInitialQuantity())
+		if !ok {
+			return fmt.Errorf("fill or kill order id %d would meet a resting order of its own owner", order.GetId())
+		}
+		if available < order.GetInitialQuantity() {
+			return fmt.Errorf("not enough volume to fill or kill order id %d", order.GetId())
+		}
+	case model.ORDER_MARKET:
+		if !o.canMatch(order.GetSide(), order.GetPrice()) {
+			return fmt.Errorf("no liquidity for market order id %d", order.GetId())
+		}
+	}
 
-		if currentPriceLevel == nil {
-			panic("WHAT THE HELL HAPPENED?!?!?")
+	if order.GetPostOnly() != model.POST_ONLY_NONE && o.canMatch(order.GetSide(), order.GetPrice()) {
+		if order.GetPostOnly() == model.POST_ONLY_REJECT {
+			return fmt.Errorf("post-only order id %d would take liquidity", order.GetId())
 		}
+		passive, ok := o.passivePrice(order.GetSide())
+		if !ok {
+			return fmt.Errorf("post-only order id %d cannot be repriced off the book", order.GetId())
+		}
+		order.Reprice(passive)
+	}
+	return nil
+}
 
-		currentPriceLevel.Orders = append(currentPriceLevel.Orders, &order)
-		currentPriceLevel.TotalVolume += order.GetInitialQuantity()
+// place matches an admitted order and rests what is left on the book. What may not rest is
+// cancelled.
+func (o *orderBookEngineImpl) place(order *model.Order) []*model.Trade {
+	if o.phase.IsAuction() {
+		// auctions collect orders, the book may cross until it is uncrossed
+		o.rest(order)
+		return []*model.Trade{}
 	}
 
-	return o.matchOrder(), nil
+	trades, cancelled := o.matchOrder(order)
+	if order.IsFilled() {
+		return trades
+	}
+	if cancelled || order.GetType().IsImmediate() {
+		// immediate remainders are cancelled rather than rested
+		o.emitOrder(model.EVENT_ORDER_CANCELLED, order, "")
+		return trades
+	}
+	order.RefreshPeak()
+	o.rest(order)
+	return trades
+}
+
+// rest puts order at the back of the queue at its price. An order that already has an entry
+// time, as one coming back from a snapshot, keeps it.
+func (o *orderBookEngineImpl) rest(order *model.Order) {
+	o.orders[order.GetId()] = order
+	if order.GetEnteredAt().IsZero() {
+		order.SetEnteredAt(o.now)
+	}
+	o.touch(order.GetSide(), order.GetPrice())
+
+	if order.GetSide() == model.ASK {
+		level, ok := o.asks.Get(orderbookModel.NewAskPriceLevel(order.GetPrice())).(*orderbookModel.AskPriceLevel)
+		if !ok {
+			level = orderbookModel.NewAskPriceLevel(order.GetPrice())
+			o.asks.ReplaceOrInsert(level)
+		}
+		level.Append(order)
+		return
+	}
+
+	level, ok := o.bids.Get(orderbookModel.NewBidPriceLevel(order.GetPrice())).(*orderbookModel.BidPriceLevel)
+	if !ok {
+		level = orderbookModel.NewBidPriceLevel(order.GetPrice())
+		o.bids.ReplaceOrInsert(level)
+	}
+	level.Append(order)
 }
 
 func (o *orderBookEngineImpl) CancelOrder(orderID model.OrderId) error {
+	if err := o.record(JournalEntry{Command: JOURNAL_CANCEL, OrderID: orderID}); err != nil {
+		return err
+	}
+	err := o.cancelOrder(orderID, "")
+	o.flushEvents()
+	return err
+}
+
+// cancelOrder applies a cancel without journaling it, the engine also uses it for the
+// cancels it decides on itself and gives its reason.
+func (o *orderBookEngineImpl) cancelOrder(orderID model.OrderId, reason string) error {
 	order, exists := o.orders[orderID]
 	if !exists {
 		return fmt.Errorf("order not found: %d", orderID)
 	}
+	o.pull(order)
+	o.emitOrder(model.EVENT_ORDER_CANCELLED, order, reason)
+	return nil
+}
 
-	// Find and remove from price level
-	if order.GetSide() == model.ASK {
-		// removeOrderByID
-		priceLevel := &orderbookModel.AskPriceLevel{Price: order.GetPrice()}
-		if item := o.asks.Get(priceLevel); item != nil {
-			item.(*orderbookModel.AskPriceLevel).RemoveOrderByID(order.GetId())
-		}
-		priceLevel.TotalVolume -= order.GetRemainingQuantity()
-		if len(priceLevel.Orders) == 0 {
-			o.asks.Delete(priceLevel)
-		}
-	} else {
-		priceLevel := &orderbookModel.BidPriceLevel{Price: order.GetPrice()}
-		if item := o.bids.Get(priceLevel); item != nil {
-			item.(*orderbookModel.BidPriceLevel).RemoveOrderByID(order.GetId())
-		}
-		priceLevel.TotalVolume -= order.GetRemainingQuantity()
-		if len(priceLevel.Orders) == 0 {
-			o.bids.Delete(priceLevel)
-		}
+// pull takes order off the book or the trigger book.
+func (o *orderBookEngineImpl) pull(order *model.Order) {
+	delete(o.orders, order.GetId())
+	if order.GetType().IsStop() {
+		o.stops.remove(order)
+		return
 	}
 
-	delete(o.orders, orderID)
-	return nil
+	// the order knows its level, so this is O(1) unless the level empties
+	if level := orderbookModel.LevelOf(order); level != nil {
+		level.Remove(order)
+		o.touch(order.GetSide(), level.Price)
+		o.dropLevelIfEmpty(order.GetSide(), level)
+	}
+}
+
+// ModifyOrder applies an amend and returns the events it caused. A refused amend leaves the
+// order as it was and emits nothing.
+func (o *orderBookEngineImpl) ModifyOrder(modify model.OrderModify, orderType model.OrderType) ([]model.Event, error) {
+	if err := o.record(JournalEntry{Command: JOURNAL_MODIFY, Modify: modify, OrderType: orderType}); err != nil {
+		return nil, err
+	}
+	_, err := o.modifyOrder(modify, orderType)
+	return o.flushEvents(), err
 }
 
-func (o *orderBookEngineImpl) ModifyOrder(modify model.OrderModify, orderType model.OrderType) ([]*model.Trade, error) {
+// modifyOrder applies a modify without journaling it. modify.Quantity is the new total
+// quantity, fills included; the order keeps its side, type and everything else it was placed
+// with. Cutting the quantity at the same price amends the order in place and keeps its queue
+// position. A new price or a larger quantity loses it: the order is pulled and goes through
+// matching again as if it just arrived, with what it filled carried over.
+func (o *orderBookEngineImpl) modifyOrder(modify model.OrderModify, orderType model.OrderType) ([]*model.Trade, error) {
+	if err := o.status.CheckOrder(o.ticker); err != nil {
+		return nil, err
+	}
 	existing, ok := o.orders[modify.ID]
 	if !ok {
 		return nil, fmt.Errorf("cannot find order with id %v", modify.ID)
 	}
-	err := o.CancelOrder(existing.GetId())
-	if err != nil {
+	if !existing.GetType().RestsOnBook() {
+		return nil, fmt.Errorf("order id %d of type %d cannot be amended, cancel it instead", modify.ID, existing.GetType())
+	}
+	if orderType != existing.GetType() {
+		return nil, fmt.Errorf("amending order id %d cannot change its type", modify.ID)
+	}
+	if modify.Quantity <= existing.GetFilledQuantity() {
+		return nil, fmt.Errorf("order id %d filled %d already, it cannot be amended to %d", modify.ID, existing.GetFilledQuantity(), modify.Quantity)
+	}
+
+	if modify.Price == existing.GetPrice() && modify.Quantity <= existing.GetInitialQuantity() {
+		o.shrink(existing, existing.GetInitialQuantity()-modify.Quantity)
+		o.emitOrder(model.EVENT_ORDER_ACCEPTED, existing, "")
+		return []*model.Trade{}, nil
+	}
+
+	// the replacement is checked before the original is pulled, a rejected modify leaves it resting
+	candidate := amended(existing, modify)
+	if err := o.acceptsOrder(&candidate); err != nil {
+		return nil, err
+	}
+	if err := o.admit(&candidate); err != nil {
+		return nil, err
+	}
+	o.pull(existing)
+	replacement := amended(existing, modify)
+	if err := o.admit(&replacement); err != nil {
+		o.emitOrder(model.EVENT_ORDER_CANCELLED, existing, err.Error())
 		return nil, err
 	}
+	o.emitOrder(model.EVENT_ORDER_ACCEPTED, &replacement, "")
+	trades := o.place(&replacement)
+	return append(trades, o.releaseStops(trades)...), nil
+}
+
+// amended is a copy of order with the price and total quantity of modify, not yet on the book.
+func amended(order *model.Order, modify model.OrderModify) model.Order {
+	replacement := *order
+	replacement.Reprice(modify.Price)
+	replacement.Resize(modify.Quantity)
+	replacement.SetEnteredAt(time.Time{})
+	return replacement
+}
+
+// shrink takes quantity off a resting order in place, it keeps its queue position.
+func (o *orderBookEngineImpl) shrink(order *model.Order, quantity model.Quantity) {
+	if quantity == 0 {
+		return
+	}
+	hiddenBefore := order.GetHiddenQuantity()
+	if err := order.Reduce(quantity); err != nil {
+		log.Printf("shrinking order id %d: %v", order.GetId(), err)
+		return
+	}
+	if level := orderbookModel.LevelOf(order); level != nil {
+		level.TotalVolume -= quantity
+		level.HiddenVolume -= hiddenBefore - order.GetHiddenQuantity()
+		o.touch(order.GetSide(), level.Price)
+	}
+}
 
-	addOrder, err := o.AddOrder(modify.ToOrder(orderType))
-	return addOrder, err
+// RestoreOrder puts back an order that was resting before a restart, keeping its filled
+// quantity. It is not matched and no cancel or reduce handler is called; stops go back to the
+// trigger book and the levels it joins are reported as changed. An order that would cross the
+// opposite side is refused, the book never rests crossed, and so is a stop the last trade
+// already went through, as it is when added, and any order of a closed ticker.
+func (o *orderBookEngineImpl) RestoreOrder(order model.Order) error {
+	if err := o.record(JournalEntry{Command: JOURNAL_RESTORE, Order: order}); err != nil {
+		return err
+	}
+	err := o.restoreOrder(&order)
+	o.flushEvents()
+	return err
+}
+
+func (o *orderBookEngineImpl) restoreOrder(order *model.Order) error {
+	if _, ok := o.orders[order.GetId()]; ok {
+		return fmt.Errorf("order already exist for id %d", order.GetId())
+	}
+	if o.status == model.TICKER_STATUS_CLOSED {
+		return fmt.Errorf("ticker %s is closed, order %d cannot rest", o.ticker, order.GetId())
+	}
+	if order.GetType().IsStop() {
+		return o.addStop(order)
+	}
+	if !order.GetType().RestsOnBook() || order.IsFilled() {
+		return fmt.Errorf("order %d cannot rest on the book", order.GetId())
+	}
+	if !o.phase.IsAuction() && o.canMatch(order.GetSide(), order.GetPrice()) {
+		return fmt.Errorf("order %d at %d would cross the book", order.GetId(), order.GetPrice())
+	}
+	o.rest(order)
+	return nil
 }
 
 func (o *orderBookEngineImpl) OrderSize() int {
 	return o.asks.Len() + o.bids.Len()
 }
 
-func (o *orderBookEngineImpl) getMarketDepth(levels int) *model.MarketDepth {
-	depth := &model.MarketDepth{
-		Bids:      make([]model.MarketDepthLevel, 0, levels),
-		Asks:      make([]model.MarketDepthLevel, 0, levels),
-		Timestamp: time.Now().UnixMilli(),
+// getMarketDepth aggregates up to levels price levels per side, all of them when levels is 0.
+// With a bucket above 1 adjacent prices are grouped into buckets of that width: bids round
+// down and asks round up to a multiple of it, so a bucket never looks better than the prices
+// in it. Every level carries the volume of all levels up to and including it.
+func (o *orderBookEngineImpl) getMarketDepth(levels int, bucket model.Price) *model.MarketDepth {
+	bucket = max(bucket, 1)
+	return &model.MarketDepth{
+		Bids:      depthOf(o.bids, model.BID, levels, bucket),
+		Asks:      depthOf(o.asks, model.ASK, levels, bucket),
+		Timestamp: o.clock.Now().UnixMilli(),
 	}
+}
 
-	// Collect bid levels (highest price first)
-	bidCount := 0
-	o.bids.Ascend(func(item btree.Item) bool {
-		if bidCount >= levels {
-			return false // Stop iteration
+// depthOf walks the levels of tree from the best price, merging those in the same bucket.
+func depthOf(tree *btree.BTree, side model.Side, levels int, bucket model.Price) []model.MarketDepthLevel {
+	depth := make([]model.MarketDepthLevel, 0, min(tree.Len(), max(levels, 1)))
+	var cumulative model.Quantity
+	tree.Ascend(func(item btree.Item) bool {
+		level := priceLevelOf(item)
+		price := level.Price - level.Price%bucket
+		if side == model.ASK && price != level.Price && price <= math.MaxUint64-bucket {
+			price += bucket
 		}
 
-		bidLevel := item.(*orderbookModel.BidPriceLevel)
-		depth.Bids = append(depth.Bids, model.MarketDepthLevel{
-			Price:      bidLevel.Price,
-			Volume:     bidLevel.TotalVolume,
-			OrderCount: len(bidLevel.Orders),
-		})
-
-		bidCount++
-		return true // Continue iteration
-	})
-
-	// Collect ask levels (lowest price first)
-	askCount := 0
-	o.asks.Ascend(func(item btree.Item) bool {
-		if askCount >= levels {
+		cumulative += level.DisplayedVolume()
+		if last := len(depth) - 1; last >= 0 && depth[last].Price == price {
+			depth[last].Volume += level.DisplayedVolume()
+			depth[last].OrderCount += level.Orders.Len()
+			depth[last].CumulativeVolume = cumulative
+			return true
+		}
+		if levels > 0 && len(depth) == levels {
 			return false
 		}
-
-		askLevel := item.(*orderbookModel.AskPriceLevel)
-		depth.Asks = append(depth.Asks, model.MarketDepthLevel{
-			Price:      askLevel.Price,
-			Volume:     askLevel.TotalVolume,
-			OrderCount: len(askLevel.Orders),
+		depth = append(depth, model.MarketDepthLevel{
+			Price:            price,
+			Volume:           level.DisplayedVolume(),
+			OrderCount:       level.Orders.Len(),
+			CumulativeVolume: cumulative,
 		})
-
-		askCount++
 		return true
 	})
-
 	return depth
 }
 
+// GetOrderBookL3 returns up to limit resting orders of side, skipping the first offset in
+// price then queue order. Whole levels before offset are skipped without visiting their orders.
+func (o *orderBookEngineImpl) GetOrderBookL3(side model.Side, offset, limit int) *model.OrderBookL3 {
+	tree := o.bids
+	if side == model.ASK {
+		tree = o.asks
+	}
+	book := &model.OrderBookL3{
+		Side:     side,
+		Sequence: o.sequence,
+		Offset:   offset,
+		Orders:   make([]model.OrderBookL3Entry, 0, limit),
+	}
+	skip := offset
+	tree.Ascend(func(item btree.Item) bool {
+		level := priceLevelOf(item)
+		book.Total += level.Orders.Len()
+		if skip >= level.Orders.Len() {
+			skip -= level.Orders.Len()
+			return true
+		}
+		for order := level.Orders.Front(); order != nil && len(book.Orders) < limit; order = order.Next() {
+			if skip > 0 {
+				skip--
+				continue
+			}
+			book.Orders = append(book.Orders, model.OrderBookL3Entry{
+				OrderID:   order.GetId(),
+				Owner:     order.GetOwner(),
+				Price:     order.GetPrice(),
+				Quantity:  order.GetDisplayedQuantity(),
+				EnteredAt: order.GetEnteredAt(),
+			})
+		}
+		skip = 0
+		return true
+	})
+	return book
+}
+
 // GetTopOfBook returns best bid and ask
 func (o *orderBookEngineImpl) GetTopOfBook() *model.TopOfBook {
 	tob := &model.TopOfBook{}
@@ -314,9 +792,10 @@ func (o *orderBookEngineImpl) GetTopOfBook() *model.TopOfBook {
 	if o.bids.Len() > 0 {
 		bestBidItem := o.bids.Min().(*orderbookModel.BidPriceLevel)
 		tob.BestBid = &model.MarketDepthLevel{
-			Price:      bestBidItem.Price,
-			Volume:     bestBidItem.TotalVolume,
-			OrderCount: len(bestBidItem.Orders),
+			Price:            bestBidItem.Price,
+			Volume:           bestBidItem.DisplayedVolume(),
+			OrderCount:       bestBidItem.Orders.Len(),
+			CumulativeVolume: bestBidItem.DisplayedVolume(),
 		}
 	}
 
@@ -324,9 +803,10 @@ func (o *orderBookEngineImpl) GetTopOfBook() *model.TopOfBook {
 	if o.asks.Len() > 0 {
 		bestAskItem := o.asks.Min().(*orderbookModel.AskPriceLevel)
 		tob.BestAsk = &model.MarketDepthLevel{
-			Price:      bestAskItem.Price,
-			Volume:     bestAskItem.TotalVolume,
-			OrderCount: len(bestAskItem.Orders),
+			Price:            bestAskItem.Price,
+			Volume:           bestAskItem.DisplayedVolume(),
+			OrderCount:       bestAskItem.Orders.Len(),
+			CumulativeVolume: bestAskItem.DisplayedVolume(),
 		}
 	}
 
@@ -338,20 +818,73 @@ func (o *orderBookEngineImpl) GetTopOfBook() *model.TopOfBook {
 	return tob
 }
 
-// GetOrderInfos - your original method, now implemented
+func (o *orderBookEngineImpl) RegisterCancelHandler(handler CancelHandler) {
+	o.cancelHandler = handler
+}
+
+func (o *orderBookEngineImpl) RegisterReduceHandler(handler ReduceHandler) {
+	o.reduceHandler = handler
+}
+
+// GetOrder returns a copy of a resting order
+func (o *orderBookEngineImpl) GetOrder(orderID model.OrderId) (model.Order, bool) {
+	order, ok := o.orders[orderID]
+	if !ok {
+		return model.Order{}, false
+	}
+	return *order, true
+}
+
+// GetOrderInfos returns the top 10 price levels of each side, one level per price.
 func (o *orderBookEngineImpl) GetOrderInfos() *model.MarketDepth {
-	return o.getMarketDepth(10) // Default to top 10 levels
+	return o.getMarketDepth(10, 1)
+}
+
+// GetMarketDepth aggregates up to levels price levels per side, 0 for all of them, grouping
+// prices into buckets of width bucket.
+func (o *orderBookEngineImpl) GetMarketDepth(levels int, bucket model.Price) *model.MarketDepth {
+	return o.getMarketDepth(levels, bucket)
 }
 
 func (o *orderBookEngineImpl) Initialize() {
 	o.bids = btree.New(32) // degree tuned for performance
 	o.asks = btree.New(32)
+	o.stops = newTriggerBook()
 	o.orders = make(map[model.OrderId]*model.Order)
+	o.touchedSet = make(map[levelKey]struct{})
 	log.Printf("order book is initialized!! %v", o)
 }
 
-func NewOrderBookEngine(ticker string) OrderBookEngine {
+type OrderBookEngineOpts struct {
+	Ticker         string
+	MatchingPolicy MatchingPolicy // nil means FIFO
+	Journal        *Journal       // optional, every add, cancel and modify is written here before it is applied
+	PriceBands     PriceBands     // zero means no bands and no circuit breaker
+	Clock          clock.Clock    // nil means the system clock
+	// IDs numbers trades, share one generator among the engines of a process; nil gives the
+	// engine one of its own on node 0
+	IDs *snowflake.Generator
+}
+
+func NewOrderBookEngine(opts OrderBookEngineOpts) OrderBookEngine {
+	policy := opts.MatchingPolicy
+	if policy == nil {
+		policy = FIFOPolicy{}
+	}
+	engineClock := opts.Clock
+	if engineClock == nil {
+		engineClock = clock.System{}
+	}
+	ids := opts.IDs
+	if ids == nil {
+		ids, _ = snowflake.NewGenerator(snowflake.GeneratorOpts{Clock: engineClock})
+	}
 	return &orderBookEngineImpl{
-		ticker: ticker,
+		ticker:  opts.Ticker,
+		policy:  policy,
+		journal: opts.Journal,
+		bands:   opts.PriceBands,
+		clock:   engineClock,
+		ids:     ids,
 	}
 }
@@ -0,0 +1,668 @@
+package engine
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Yusufzhafir/go-orderbook/backend/pkg/clock"
+	"github.com/Yusufzhafir/go-orderbook/backend/pkg/model"
+)
+
+// TestMain keeps the engine's logging, which every new book and dropped order writes to, out
+// of the test output.
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// newTestBook returns an initialized engine for ticker on a manual clock.
+func newTestBook(tb testing.TB, ticker string) OrderBookEngine {
+	tb.Helper()
+	book := NewOrderBookEngine(OrderBookEngineOpts{
+		Ticker: ticker,
+		Clock:  clock.NewManual(time.Date(2025, 1, 2, 9, 0, 0, 0, time.UTC)),
+	})
+	book.Initialize()
+	return book
+}
+
+// mustAdd adds order to book and fails the test if the engine refuses it.
+func mustAdd(tb testing.TB, book OrderBookEngine, order model.Order) []model.Event {
+	tb.Helper()
+	events, err := book.AddOrder(order)
+	if err != nil {
+		tb.Fatalf("adding order %d: %v", order.GetId(), err)
+	}
+	return events
+}
+
+// eventsOf returns the types of the events about order id, in the order they were emitted.
+func eventsOf(events []model.Event, id model.OrderId) []model.EventType {
+	types := make([]model.EventType, 0)
+	for _, event := range events {
+		if event.OrderID == id && event.Type != model.EVENT_TRADE {
+			types = append(types, event.Type)
+		}
+	}
+	return types
+}
+
+const BENCH_PRICE model.Price = 100
+
+// BENCH_DEPTHS are the queue depths cancel and modify are timed at. Both should stay flat as the
+// queue grows, since an order unlinks itself from its level.
+var BENCH_DEPTHS = []int{100, 1000, 10000, 100000}
+
+// deepBook returns an engine with depth asks queued at BENCH_PRICE, ids 1 to depth.
+func deepBook(tb testing.TB, depth int) OrderBookEngine {
+	tb.Helper()
+	book := NewOrderBookEngine(OrderBookEngineOpts{Ticker: "BENCH"})
+	book.Initialize()
+	for i := 1; i <= depth; i++ {
+		if _, err := book.AddOrder(model.NewOrder(model.OrderId(i), model.ASK, BENCH_PRICE, 10, model.ORDER_GOOD_TILL_CANCEL)); err != nil {
+			tb.Fatalf("seeding book: %v", err)
+		}
+	}
+	return book
+}
+
+// BenchmarkCancel cancels an order from the middle of the queue and queues it again, so the
+// depth stays the same across iterations.
+func BenchmarkCancel(b *testing.B) {
+	for _, depth := range BENCH_DEPTHS {
+		b.Run(fmt.Sprintf("depth=%d", depth), func(b *testing.B) {
+			book := deepBook(b, depth)
+			id := model.OrderId(depth/2 + 1)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				order, _ := book.GetOrder(id)
+				b.StartTimer()
+				if err := book.CancelOrder(id); err != nil {
+					b.Fatal(err)
+				}
+				b.StopTimer()
+				if _, err := book.AddOrder(model.NewOrder(id, model.ASK, BENCH_PRICE, order.GetRemainingQuantity(), model.ORDER_GOOD_TILL_CANCEL)); err != nil {
+					b.Fatal(err)
+				}
+				b.StartTimer()
+			}
+		})
+	}
+}
+
+// BenchmarkModify amends the quantity of an order in the middle of the queue.
+func BenchmarkModify(b *testing.B) {
+	for _, depth := range BENCH_DEPTHS {
+		b.Run(fmt.Sprintf("depth=%d", depth), func(b *testing.B) {
+			book := deepBook(b, depth)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				modify := model.OrderModify{
+					ID:       model.OrderId(depth/2 + 1),
+					Side:     model.ASK,
+					Price:    BENCH_PRICE,
+					Quantity: model.Quantity(10 + i%2),
+				}
+				if _, err := book.ModifyOrder(modify, model.ORDER_GOOD_TILL_CANCEL); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestMarketOrderNotionalCap(t *testing.T) {
+	tests := []struct {
+		name      string
+		order     model.Order
+		rejected  bool
+		filled    model.Quantity
+		spent     uint64
+		cancelled bool // whether the remainder was cancelled rather than filled
+	}{
+		{
+			name:   "uncapped buy sweeps the asks it needs",
+			order:  model.NewMarketOrder(10, model.BID, 8, 0),
+			filled: 8,
+			spent:  5*100 + 3*110,
+		},
+		{
+			name:   "cap that covers the whole order",
+			order:  model.NewMarketOrder(10, model.BID, 8, 1000),
+			filled: 8,
+			spent:  5*100 + 3*110,
+		},
+		{
+			name:      "cap stops the buy at the last unit it can pay for",
+			order:     model.NewMarketOrder(10, model.BID, 20, 1000),
+			filled:    9,
+			spent:     5*100 + 4*110,
+			cancelled: true,
+		},
+		{
+			name:      "cap used up exactly at a level",
+			order:     model.NewMarketOrder(10, model.BID, 20, 500),
+			filled:    5,
+			spent:     500,
+			cancelled: true,
+		},
+		{
+			name:      "cap below one unit at the best ask trades nothing",
+			order:     model.NewMarketOrder(10, model.BID, 3, 50),
+			cancelled: true,
+		},
+		{
+			name:      "uncapped buy larger than the book",
+			order:     model.NewMarketOrder(10, model.BID, 20, 0),
+			filled:    15,
+			spent:     5*100 + 5*110 + 5*120,
+			cancelled: true,
+		},
+		{
+			name:     "sell with no bids is rejected",
+			order:    model.NewMarketOrder(10, model.ASK, 3, 0),
+			rejected: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			book := newTestBook(t, "MKT")
+			for i, price := range []model.Price{100, 110, 120} {
+				mustAdd(t, book, model.NewOrder(model.OrderId(i+1), model.ASK, price, 5, model.ORDER_GOOD_TILL_CANCEL))
+			}
+
+			events, err := book.AddOrder(test.order)
+			if (err != nil) != test.rejected {
+				t.Fatalf("AddOrder returned %v, rejected should be %v", err, test.rejected)
+			}
+			var filled model.Quantity
+			var spent uint64
+			for _, trade := range tradesIn(events) {
+				filled += trade.Quantity
+				spent += uint64(trade.Price) * uint64(trade.Quantity)
+			}
+			if filled != test.filled || spent != test.spent {
+				t.Errorf("bought %d for %d, want %d for %d", filled, spent, test.filled, test.spent)
+			}
+			if budget := test.order.GetMaxNotional(); budget > 0 && spent > budget {
+				t.Errorf("spent %d over the cap of %d", spent, budget)
+			}
+			if cancelled := slices.Contains(eventsOf(events, 10), model.EVENT_ORDER_CANCELLED); cancelled != test.cancelled {
+				t.Errorf("remainder cancelled %v, want %v, events %v", cancelled, test.cancelled, eventsOf(events, 10))
+			}
+			if _, ok := book.GetOrder(10); ok {
+				t.Error("the market order rests on the book")
+			}
+			if err := book.CheckInvariants(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestPostOnly(t *testing.T) {
+	tests := []struct {
+		name     string
+		side     model.Side
+		price    model.Price
+		postOnly model.PostOnly
+		rejected bool
+		rests    model.Price // price the order rests at when it is not rejected
+	}{
+		{
+			name:     "reject buy that would take the best ask",
+			side:     model.BID,
+			price:    101,
+			postOnly: model.POST_ONLY_REJECT,
+			rejected: true,
+		},
+		{
+			name:     "reject sell that would go through the best bid",
+			side:     model.ASK,
+			price:    90,
+			postOnly: model.POST_ONLY_REJECT,
+			rejected: true,
+		},
+		{
+			name:     "reject buy that does not cross rests at its price",
+			side:     model.BID,
+			price:    100,
+			postOnly: model.POST_ONLY_REJECT,
+			rests:    100,
+		},
+		{
+			name:     "reprice buy rests one tick under the best ask",
+			side:     model.BID,
+			price:    105,
+			postOnly: model.POST_ONLY_REPRICE,
+			rests:    100,
+		},
+		{
+			name:     "reprice sell rests one tick over the best bid",
+			side:     model.ASK,
+			price:    95,
+			postOnly: model.POST_ONLY_REPRICE,
+			rests:    100,
+		},
+		{
+			name:     "reprice sell that does not cross keeps its price",
+			side:     model.ASK,
+			price:    101,
+			postOnly: model.POST_ONLY_REPRICE,
+			rests:    101,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			book := newTestBook(t, "POST")
+			mustAdd(t, book, model.NewOrder(1, model.BID, 99, 5, model.ORDER_GOOD_TILL_CANCEL))
+			mustAdd(t, book, model.NewOrder(2, model.ASK, 101, 5, model.ORDER_GOOD_TILL_CANCEL))
+
+			order := model.NewOrder(10, test.side, test.price, 3, model.ORDER_GOOD_TILL_CANCEL)
+			order.SetPostOnly(test.postOnly)
+			events, err := book.AddOrder(order)
+			if (err != nil) != test.rejected {
+				t.Fatalf("AddOrder returned %v, rejected should be %v", err, test.rejected)
+			}
+			if trades := tradesIn(events); len(trades) > 0 {
+				t.Errorf("post-only order traded %v", trades)
+			}
+			resting, ok := book.GetOrder(10)
+			if ok == test.rejected {
+				t.Fatalf("order rests %v, rejected %v", ok, test.rejected)
+			}
+			if ok && resting.GetPrice() != test.rests {
+				t.Errorf("order rests at %d, want %d", resting.GetPrice(), test.rests)
+			}
+			if err := book.CheckInvariants(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestIcebergSlices(t *testing.T) {
+	tests := []struct {
+		name      string
+		takes     []model.Quantity // buys that hit the level one after another
+		queue     []model.OrderId  // queue at the level afterwards, front first
+		displayed model.Quantity   // iceberg's displayed slice afterwards
+		hidden    model.Quantity   // iceberg's hidden reserve afterwards
+	}{
+		{
+			name:      "part of the slice keeps the iceberg in front",
+			takes:     []model.Quantity{3},
+			queue:     []model.OrderId{1, 2},
+			displayed: 1,
+			hidden:    8,
+		},
+		{
+			name:      "used up slice refreshes behind the next order",
+			takes:     []model.Quantity{4},
+			queue:     []model.OrderId{2, 1},
+			displayed: 4,
+			hidden:    4,
+		},
+		{
+			name:      "more than the slice spills to the next order, not the reserve",
+			takes:     []model.Quantity{6},
+			queue:     []model.OrderId{2, 1},
+			displayed: 4,
+			hidden:    4,
+		},
+		{
+			name:      "refreshed slice trades after the order it went behind",
+			takes:     []model.Quantity{4, 6},
+			queue:     []model.OrderId{1},
+			displayed: 3,
+			hidden:    4,
+		},
+		{
+			name:      "last slice is what is left of the reserve",
+			takes:     []model.Quantity{4, 5, 4},
+			queue:     []model.OrderId{1},
+			displayed: 4,
+			hidden:    0,
+		},
+		{
+			name:  "iceberg fills through its last slice",
+			takes: []model.Quantity{4, 5, 4, 4},
+			queue: []model.OrderId{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			book := newTestBook(t, "ICE")
+			iceberg := model.NewOrder(1, model.ASK, 100, 12, model.ORDER_GOOD_TILL_CANCEL)
+			iceberg.SetPeakSize(4)
+			mustAdd(t, book, iceberg)
+			mustAdd(t, book, model.NewOrder(2, model.ASK, 100, 5, model.ORDER_GOOD_TILL_CANCEL))
+			for i, take := range test.takes {
+				mustAdd(t, book, model.NewOrder(model.OrderId(10+i), model.BID, 100, take, model.ORDER_IMMEDIATE_OR_CANCEL))
+			}
+
+			l3 := book.GetOrderBookL3(model.ASK, 0, 10)
+			queue := make([]model.OrderId, 0)
+			for _, entry := range l3.Orders {
+				queue = append(queue, entry.OrderID)
+				if entry.OrderID == 1 && entry.Quantity != test.displayed {
+					t.Errorf("L3 shows %d of the iceberg, want %d", entry.Quantity, test.displayed)
+				}
+			}
+			if !slices.Equal(queue, test.queue) {
+				t.Errorf("queue %v, want %v", queue, test.queue)
+			}
+			if order, ok := book.GetOrder(1); ok {
+				if order.GetDisplayedQuantity() != test.displayed || order.GetHiddenQuantity() != test.hidden {
+					t.Errorf("iceberg shows %d and hides %d, want %d and %d", order.GetDisplayedQuantity(), order.GetHiddenQuantity(), test.displayed, test.hidden)
+				}
+			}
+			if err := book.CheckInvariants(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestAmendPriority(t *testing.T) {
+	tests := []struct {
+		name      string
+		modify    model.OrderModify // total quantity, fills included
+		rejected  bool
+		queue     []model.OrderId // asks at 100 afterwards, front first
+		remaining model.Quantity  // of the amended order
+		trades    int
+	}{
+		{
+			name:      "cut at the same price keeps the place",
+			modify:    model.OrderModify{ID: 2, Side: model.ASK, Price: 100, Quantity: 3},
+			queue:     []model.OrderId{1, 2, 3},
+			remaining: 3,
+		},
+		{
+			name:      "cut of a partly filled order counts its fills",
+			modify:    model.OrderModify{ID: 1, Side: model.ASK, Price: 100, Quantity: 4},
+			queue:     []model.OrderId{1, 2, 3},
+			remaining: 2,
+		},
+		{
+			name:      "larger quantity goes to the back",
+			modify:    model.OrderModify{ID: 2, Side: model.ASK, Price: 100, Quantity: 8},
+			queue:     []model.OrderId{1, 3, 2},
+			remaining: 8,
+		},
+		{
+			name:      "larger quantity of a partly filled order keeps its fills",
+			modify:    model.OrderModify{ID: 1, Side: model.ASK, Price: 100, Quantity: 8},
+			queue:     []model.OrderId{2, 3, 1},
+			remaining: 6,
+		},
+		{
+			name:      "new price leaves the level",
+			modify:    model.OrderModify{ID: 2, Side: model.ASK, Price: 101, Quantity: 5},
+			queue:     []model.OrderId{1, 3},
+			remaining: 5,
+		},
+		{
+			name:      "new price that crosses trades like a new order",
+			modify:    model.OrderModify{ID: 2, Side: model.ASK, Price: 98, Quantity: 5},
+			queue:     []model.OrderId{1, 3},
+			remaining: 1,
+			trades:    1,
+		},
+		{
+			name:     "quantity down to what already filled is rejected",
+			modify:   model.OrderModify{ID: 1, Side: model.ASK, Price: 100, Quantity: 2},
+			rejected: true,
+			queue:    []model.OrderId{1, 2, 3},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			book := newTestBook(t, "AMD")
+			for id := model.OrderId(1); id <= 3; id++ {
+				mustAdd(t, book, model.NewOrder(id, model.ASK, 100, 5, model.ORDER_GOOD_TILL_CANCEL))
+			}
+			mustAdd(t, book, model.NewOrder(9, model.BID, 98, 4, model.ORDER_GOOD_TILL_CANCEL))
+			// order 1 fills 2 of its 5
+			mustAdd(t, book, model.NewOrder(10, model.BID, 100, 2, model.ORDER_IMMEDIATE_OR_CANCEL))
+
+			events, err := book.ModifyOrder(test.modify, model.ORDER_GOOD_TILL_CANCEL)
+			if (err != nil) != test.rejected {
+				t.Fatalf("ModifyOrder returned %v, rejected should be %v", err, test.rejected)
+			}
+			if trades := len(tradesIn(events)); trades != test.trades {
+				t.Errorf("amend printed %d trades, want %d", trades, test.trades)
+			}
+			queue := make([]model.OrderId, 0)
+			for _, entry := range book.GetOrderBookL3(model.ASK, 0, 10).Orders {
+				if entry.Price == 100 {
+					queue = append(queue, entry.OrderID)
+				}
+			}
+			if !slices.Equal(queue, test.queue) {
+				t.Errorf("queue at 100 is %v, want %v", queue, test.queue)
+			}
+			if order, ok := book.GetOrder(test.modify.ID); !test.rejected && (!ok || order.GetRemainingQuantity() != test.remaining) {
+				t.Errorf("amended order rests %v with %d, want %d", ok, order.GetRemainingQuantity(), test.remaining)
+			}
+			if err := book.CheckInvariants(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestOrderBookL3Pages(t *testing.T) {
+	tests := []struct {
+		name   string
+		offset int
+		limit  int
+		want   []model.OrderId
+	}{
+		{name: "first page", offset: 0, limit: 2, want: []model.OrderId{1, 2}},
+		{name: "page across a level", offset: 2, limit: 2, want: []model.OrderId{3, 4}},
+		{name: "offset skips whole levels", offset: 3, limit: 10, want: []model.OrderId{4, 5, 6}},
+		{name: "offset on the first order of a level", offset: 5, limit: 1, want: []model.OrderId{6}},
+		{name: "last page is short", offset: 4, limit: 5, want: []model.OrderId{5, 6}},
+		{name: "offset past the end", offset: 6, limit: 5, want: []model.OrderId{}},
+		{name: "zero limit", offset: 0, limit: 0, want: []model.OrderId{}},
+	}
+
+	book := newTestBook(t, "L3")
+	// three bids at 101, two at 100 and one at 99, in id order within each price
+	for id, price := range []model.Price{101, 101, 101, 100, 100, 99} {
+		mustAdd(t, book, model.NewOrder(model.OrderId(id+1), model.BID, price, 1, model.ORDER_GOOD_TILL_CANCEL))
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			page := book.GetOrderBookL3(model.BID, test.offset, test.limit)
+			got := make([]model.OrderId, 0, len(page.Orders))
+			for _, entry := range page.Orders {
+				got = append(got, entry.OrderID)
+			}
+			if !slices.Equal(got, test.want) {
+				t.Errorf("page holds %v, want %v", got, test.want)
+			}
+			if page.Total != 6 || page.Offset != test.offset || page.Side != model.BID {
+				t.Errorf("page reports total %d, offset %d and side %d", page.Total, page.Offset, page.Side)
+			}
+		})
+	}
+}
+
+func TestMarketDepthBuckets(t *testing.T) {
+	tests := []struct {
+		name     string
+		levels   int
+		bucket   model.Price
+		wantBids []model.MarketDepthLevel
+		wantAsks []model.MarketDepthLevel
+	}{
+		{
+			name: "every price",
+			wantBids: []model.MarketDepthLevel{
+				{Price: 98, Volume: 7, OrderCount: 2, CumulativeVolume: 7},
+				{Price: 97, Volume: 5, OrderCount: 1, CumulativeVolume: 12},
+				{Price: 95, Volume: 1, OrderCount: 1, CumulativeVolume: 13},
+			},
+			wantAsks: []model.MarketDepthLevel{
+				{Price: 101, Volume: 2, OrderCount: 1, CumulativeVolume: 2},
+				{Price: 103, Volume: 6, OrderCount: 1, CumulativeVolume: 8},
+				{Price: 104, Volume: 1, OrderCount: 1, CumulativeVolume: 9},
+				{Price: 106, Volume: 3, OrderCount: 1, CumulativeVolume: 12},
+			},
+		},
+		{
+			name:   "bids round down and asks round up",
+			bucket: 5,
+			wantBids: []model.MarketDepthLevel{
+				{Price: 95, Volume: 13, OrderCount: 4, CumulativeVolume: 13},
+			},
+			wantAsks: []model.MarketDepthLevel{
+				{Price: 105, Volume: 9, OrderCount: 3, CumulativeVolume: 9},
+				{Price: 110, Volume: 3, OrderCount: 1, CumulativeVolume: 12},
+			},
+		},
+		{
+			name:   "levels count buckets, not prices",
+			levels: 2,
+			bucket: 2,
+			wantBids: []model.MarketDepthLevel{
+				{Price: 98, Volume: 7, OrderCount: 2, CumulativeVolume: 7},
+				{Price: 96, Volume: 5, OrderCount: 1, CumulativeVolume: 12},
+			},
+			wantAsks: []model.MarketDepthLevel{
+				{Price: 102, Volume: 2, OrderCount: 1, CumulativeVolume: 2},
+				{Price: 104, Volume: 7, OrderCount: 2, CumulativeVolume: 9},
+			},
+		},
+		{
+			name:   "top of the book only",
+			levels: 1,
+			bucket: 1,
+			wantBids: []model.MarketDepthLevel{
+				{Price: 98, Volume: 7, OrderCount: 2, CumulativeVolume: 7},
+			},
+			wantAsks: []model.MarketDepthLevel{
+				{Price: 101, Volume: 2, OrderCount: 1, CumulativeVolume: 2},
+			},
+		},
+	}
+
+	book := newTestBook(t, "DEPTH")
+	// the iceberg at 106 shows 3 of its 30
+	iceberg := model.NewOrder(8, model.ASK, 106, 30, model.ORDER_GOOD_TILL_CANCEL)
+	iceberg.SetPeakSize(3)
+	for _, order := range []model.Order{
+		model.NewOrder(1, model.BID, 98, 3, model.ORDER_GOOD_TILL_CANCEL),
+		model.NewOrder(2, model.BID, 98, 4, model.ORDER_GOOD_TILL_CANCEL),
+		model.NewOrder(3, model.BID, 97, 5, model.ORDER_GOOD_TILL_CANCEL),
+		model.NewOrder(4, model.BID, 95, 1, model.ORDER_GOOD_TILL_CANCEL),
+		model.NewOrder(5, model.ASK, 101, 2, model.ORDER_GOOD_TILL_CANCEL),
+		model.NewOrder(6, model.ASK, 103, 6, model.ORDER_GOOD_TILL_CANCEL),
+		model.NewOrder(7, model.ASK, 104, 1, model.ORDER_GOOD_TILL_CANCEL),
+		iceberg,
+	} {
+		mustAdd(t, book, order)
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			depth := book.GetMarketDepth(test.levels, test.bucket)
+			if !slices.Equal(depth.Bids, test.wantBids) {
+				t.Errorf("bids %+v, want %+v", depth.Bids, test.wantBids)
+			}
+			if !slices.Equal(depth.Asks, test.wantAsks) {
+				t.Errorf("asks %+v, want %+v", depth.Asks, test.wantAsks)
+			}
+		})
+	}
+}
+
+func TestTradeRoles(t *testing.T) {
+	tests := []struct {
+		name    string
+		resting []model.Order
+		taker   model.Order
+		want    model.Trade // the last trade the taker prints; only the role fields are compared
+	}{
+		{
+			name:    "limit buy takes a resting ask",
+			resting: []model.Order{model.NewOrder(1, model.ASK, 100, 5, model.ORDER_GOOD_TILL_CANCEL)},
+			taker:   model.NewOrder(2, model.BID, 100, 5, model.ORDER_GOOD_TILL_CANCEL),
+			want:    model.Trade{Side: model.BID, MakerID: 1, TakerID: 2, BuyOrderID: 2, SellOrderID: 1},
+		},
+		{
+			name:    "limit sell takes a resting bid",
+			resting: []model.Order{model.NewOrder(1, model.BID, 100, 5, model.ORDER_GOOD_TILL_CANCEL)},
+			taker:   model.NewOrder(2, model.ASK, 100, 5, model.ORDER_IMMEDIATE_OR_CANCEL),
+			want:    model.Trade{Side: model.ASK, MakerID: 1, TakerID: 2, BuyOrderID: 1, SellOrderID: 2},
+		},
+		{
+			name:    "market buy",
+			resting: []model.Order{model.NewOrder(1, model.ASK, 100, 5, model.ORDER_GOOD_TILL_CANCEL)},
+			taker:   model.NewMarketOrder(2, model.BID, 5, 500),
+			want:    model.Trade{Side: model.BID, MakerID: 1, TakerID: 2, BuyOrderID: 2, SellOrderID: 1},
+		},
+		{
+			name:    "market sell",
+			resting: []model.Order{model.NewOrder(1, model.BID, 100, 5, model.ORDER_GOOD_TILL_CANCEL)},
+			taker:   model.NewMarketOrder(2, model.ASK, 5, 0),
+			want:    model.Trade{Side: model.ASK, MakerID: 1, TakerID: 2, BuyOrderID: 1, SellOrderID: 2},
+		},
+		{
+			name: "a triggered stop takes as it is released",
+			resting: []model.Order{
+				model.NewOrder(1, model.ASK, 100, 1, model.ORDER_GOOD_TILL_CANCEL),
+				model.NewOrder(2, model.ASK, 101, 5, model.ORDER_GOOD_TILL_CANCEL),
+				model.NewStopOrder(3, model.BID, 100, 0, 2, model.ORDER_STOP_MARKET, 1000),
+			},
+			taker: model.NewOrder(4, model.BID, 100, 1, model.ORDER_IMMEDIATE_OR_CANCEL),
+			want:  model.Trade{Side: model.BID, MakerID: 2, TakerID: 3, BuyOrderID: 3, SellOrderID: 2},
+		},
+		{
+			name: "an ask that sweeps bids makes every trade on the sell side",
+			resting: []model.Order{
+				model.NewOrder(1, model.BID, 101, 2, model.ORDER_GOOD_TILL_CANCEL),
+				model.NewOrder(2, model.BID, 100, 2, model.ORDER_GOOD_TILL_CANCEL),
+			},
+			taker: model.NewOrder(3, model.ASK, 100, 4, model.ORDER_FILL_OR_KILL),
+			want:  model.Trade{Side: model.ASK, MakerID: 2, TakerID: 3, BuyOrderID: 2, SellOrderID: 3},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			book := newTestBook(t, "ROLE")
+			for _, order := range test.resting {
+				mustAdd(t, book, order)
+			}
+			trades := tradesIn(mustAdd(t, book, test.taker))
+			if len(trades) == 0 {
+				t.Fatal("the taker did not trade")
+			}
+			for _, trade := range trades {
+				if (trade.Side == model.BID) != (trade.BuyOrderID == trade.TakerID) || (trade.Side == model.ASK) != (trade.SellOrderID == trade.TakerID) {
+					t.Errorf("trade %+v is not on the taker's side", trade)
+				}
+			}
+			got := trades[len(trades)-1]
+			if got.Side != test.want.Side || got.MakerID != test.want.MakerID || got.TakerID != test.want.TakerID ||
+				got.BuyOrderID != test.want.BuyOrderID || got.SellOrderID != test.want.SellOrderID {
+				t.Errorf("trade %+v, want the roles of %+v", got, test.want)
+			}
+		})
+	}
+}
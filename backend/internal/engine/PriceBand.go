@@ -0,0 +1,102 @@
+package engine
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Yusufzhafir/go-orderbook/backend/pkg/model"
+)
+
+// BPS_DENOMINATOR is what basis points are a fraction of.
+const BPS_DENOMINATOR = 10_000
+
+// PriceBands limit how far prices may stray, in basis points of a reference price. A zero
+// limit is off.
+type PriceBands struct {
+	StaticBps     uint32        // orders priced this far from the last auction price, or the first trade without one, are rejected
+	DynamicBps    uint32        // orders priced this far from the last trade are rejected
+	BreakerBps    uint32        // a trade this far from the price at the start of the window halts the ticker
+	BreakerWindow time.Duration // how long the breaker's reference price lasts
+	HaltDuration  time.Duration // cooling-off period of a breaker halt
+}
+
+// HaltHandler is told when a circuit breaker halts the ticker.
+type HaltHandler func(halt model.Halt)
+
+// outsideBand reports whether price is further than bps from reference. Either being 0 never is.
+func outsideBand(price, reference model.Price, bps uint32) bool {
+	if bps == 0 || reference == 0 {
+		return false
+	}
+	distance := max(price, reference) - min(price, reference)
+	// widen before multiplying, a price times the denominator can overflow 64 bits
+	return float64(distance)*BPS_DENOMINATOR > float64(reference)*float64(bps)
+}
+
+// checkPriceBands rejects a priced order outside the static or dynamic band. Market orders
+// have no price to check, the circuit breaker limits where they trade.
+func (o *orderBookEngineImpl) checkPriceBands(order *model.Order) error {
+	if order.GetType() == model.ORDER_MARKET || order.GetType() == model.ORDER_STOP_MARKET {
+		return nil
+	}
+	price := order.GetPrice()
+	if outsideBand(price, o.staticReference, o.bands.StaticBps) {
+		return fmt.Errorf("price %d of order id %d is outside the static band of %d bps around %d", price, order.GetId(), o.bands.StaticBps, o.staticReference)
+	}
+	if outsideBand(price, o.lastTradePrice, o.bands.DynamicBps) {
+		return fmt.Errorf("price %d of order id %d is outside the dynamic band of %d bps around %d", price, order.GetId(), o.bands.DynamicBps, o.lastTradePrice)
+	}
+	return nil
+}
+
+// halted reports whether a breaker halt is still cooling off.
+func (o *orderBookEngineImpl) halted() bool {
+	return o.now.Before(o.halt.Until)
+}
+
+// tripsBreaker halts the ticker when a trade at price would move it more than the breaker
+// allows within its window. The window restarts from the last trade once it has run out, and
+// from the price that tripped it once the halt is over, so trading can resume at that price.
+func (o *orderBookEngineImpl) tripsBreaker(price model.Price) bool {
+	if o.bands.BreakerBps == 0 {
+		return false
+	}
+	if o.now.Sub(o.breakerSince) > o.bands.BreakerWindow || o.breakerReference == 0 {
+		o.breakerReference, o.breakerSince = o.lastTradePrice, o.now
+	}
+	if !outsideBand(price, o.breakerReference, o.bands.BreakerBps) {
+		return false
+	}
+
+	o.halt = model.Halt{Ticker: o.ticker, Price: price, Reference: o.breakerReference, Until: o.now.Add(o.bands.HaltDuration)}
+	o.breakerReference, o.breakerSince = price, o.halt.Until
+	if o.haltHandler != nil {
+		o.haltHandler(o.halt)
+	}
+	return true
+}
+
+// setReferencePrices follows the trades just printed. An auction price becomes the static
+// reference, otherwise only the first trade of the book sets it.
+func (o *orderBookEngineImpl) setReferencePrices(trades []*model.Trade, auction bool) {
+	if len(trades) == 0 {
+		return
+	}
+	o.lastTradePrice = trades[len(trades)-1].Price
+	if auction || o.staticReference == 0 {
+		o.staticReference = trades[0].Price
+	}
+}
+
+// GetHalt is the breaker halt the ticker is cooling off from, nil when trading.
+func (o *orderBookEngineImpl) GetHalt() *model.Halt {
+	if !o.clock.Now().Before(o.halt.Until) {
+		return nil
+	}
+	halt := o.halt
+	return &halt
+}
+
+func (o *orderBookEngineImpl) RegisterHaltHandler(handler HaltHandler) {
+	o.haltHandler = handler
+}
@@ -0,0 +1,193 @@
+package engine
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Yusufzhafir/go-orderbook/backend/pkg/clock"
+	"github.com/Yusufzhafir/go-orderbook/backend/pkg/model"
+)
+
+func TestOutsideBand(t *testing.T) {
+	tests := []struct {
+		name      string
+		price     model.Price
+		reference model.Price
+		bps       uint32
+		want      bool
+	}{
+		{name: "inside", price: 104, reference: 100, bps: 500, want: false},
+		{name: "on the edge", price: 105, reference: 100, bps: 500, want: false},
+		{name: "above", price: 106, reference: 100, bps: 500, want: true},
+		{name: "below", price: 94, reference: 100, bps: 500, want: true},
+		{name: "band off", price: 1000, reference: 100, bps: 0, want: false},
+		{name: "no reference", price: 1000, reference: 0, bps: 500, want: false},
+		{name: "prices too large to multiply in 64 bits", price: math.MaxUint64 / 2, reference: math.MaxUint64 / 4, bps: 500, want: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := outsideBand(test.price, test.reference, test.bps); got != test.want {
+				t.Errorf("outsideBand(%d, %d, %d) = %v, want %v", test.price, test.reference, test.bps, got, test.want)
+			}
+		})
+	}
+}
+
+// bandBook is a book under bands whose clock the test moves.
+type bandBook struct {
+	book   OrderBookEngine
+	clock  *clock.Manual
+	nextID model.OrderId
+}
+
+func newBandBook(t *testing.T, bands PriceBands) *bandBook {
+	t.Helper()
+	now := clock.NewManual(time.Date(2025, 1, 2, 9, 0, 0, 0, time.UTC))
+	book := NewOrderBookEngine(OrderBookEngineOpts{Ticker: "BAND", Clock: now, PriceBands: bands})
+	book.Initialize()
+	return &bandBook{book: book, clock: now, nextID: 1000}
+}
+
+// trade prints one unit at price and returns the trades it got, none when the trade was refused
+// or tripped the breaker.
+func (bb *bandBook) trade(t *testing.T, price model.Price) []model.Trade {
+	t.Helper()
+	bb.nextID += 2
+	if _, err := bb.book.AddOrder(model.NewOrder(bb.nextID, model.ASK, price, 1, model.ORDER_GOOD_TILL_CANCEL)); err != nil {
+		return nil
+	}
+	events, _ := bb.book.AddOrder(model.NewOrder(bb.nextID+1, model.BID, price, 1, model.ORDER_IMMEDIATE_OR_CANCEL))
+	// a refused trade leaves the ask behind, it must not meet the next one
+	bb.book.CancelOrder(bb.nextID)
+	return tradesIn(events)
+}
+
+func TestPriceBandRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		order  model.Order
+		reject string // which band rejects the order, empty when it is accepted
+	}{
+		{
+			name:  "inside both bands",
+			order: model.NewOrder(1, model.BID, 110, 1, model.ORDER_GOOD_TILL_CANCEL),
+		},
+		{
+			name:   "inside the static band, too far from the last trade",
+			order:  model.NewOrder(1, model.BID, 102, 1, model.ORDER_GOOD_TILL_CANCEL),
+			reject: "dynamic",
+		},
+		{
+			name:   "near the last trade, too far from the first",
+			order:  model.NewOrder(1, model.ASK, 112, 1, model.ORDER_GOOD_TILL_CANCEL),
+			reject: "static",
+		},
+		{
+			name:   "stop-limit prices are checked too",
+			order:  model.NewStopOrder(1, model.BID, 110, 120, 1, model.ORDER_STOP_LIMIT, 0),
+			reject: "static",
+		},
+		{
+			name:  "market orders carry no price to check",
+			order: model.NewMarketOrder(1, model.ASK, 1, 0),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			bb := newBandBook(t, PriceBands{StaticBps: 1000, DynamicBps: 500})
+			// the first trade sets the static reference, the last one the dynamic
+			for _, price := range []model.Price{100, 104, 108} {
+				if len(bb.trade(t, price)) != 1 {
+					t.Fatalf("setting up a trade at %d failed", price)
+				}
+			}
+			mustAdd(t, bb.book, model.NewOrder(2, model.BID, 107, 1, model.ORDER_GOOD_TILL_CANCEL))
+
+			_, err := bb.book.AddOrder(test.order)
+			if test.reject == "" && err != nil {
+				t.Fatalf("AddOrder returned %v", err)
+			}
+			if test.reject != "" && (err == nil || !strings.Contains(err.Error(), test.reject)) {
+				t.Fatalf("AddOrder returned %v, want the %s band to reject it", err, test.reject)
+			}
+		})
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	tests := []struct {
+		name   string
+		before []model.Price // trades after the first at 100, a minute apart
+		wait   time.Duration // before the move
+		move   model.Price   // price of the trade that may trip the breaker
+		halted bool
+	}{
+		{
+			name: "move inside the breaker trades",
+			move: 104,
+		},
+		{
+			name:   "move past the breaker halts instead of trading",
+			move:   106,
+			halted: true,
+		},
+		{
+			name:   "moves within the window add up",
+			before: []model.Price{104},
+			move:   107,
+			halted: true,
+		},
+		{
+			name:   "a new window measures from the last trade",
+			before: []model.Price{104},
+			wait:   2 * time.Minute,
+			move:   108,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			bands := PriceBands{BreakerBps: 500, BreakerWindow: 5 * time.Minute, HaltDuration: 10 * time.Second}
+			if test.wait > 0 {
+				bands.BreakerWindow = time.Minute
+			}
+			bb := newBandBook(t, bands)
+			var halts []model.Halt
+			bb.book.RegisterHaltHandler(func(halt model.Halt) { halts = append(halts, halt) })
+			for _, price := range append([]model.Price{100}, test.before...) {
+				if len(bb.trade(t, price)) != 1 {
+					t.Fatalf("setting up a trade at %d failed", price)
+				}
+				bb.clock.Advance(time.Second)
+			}
+			bb.clock.Advance(test.wait)
+
+			traded := len(bb.trade(t, test.move)) == 1
+			if traded == test.halted || (bb.book.GetHalt() != nil) != test.halted || (len(halts) == 1) != test.halted {
+				t.Fatalf("move to %d traded %v with halt %+v and halts %v, want halted %v", test.move, traded, bb.book.GetHalt(), halts, test.halted)
+			}
+			if !test.halted {
+				return
+			}
+
+			// orders are refused until the halt has cooled off, then the same move trades
+			if _, err := bb.book.AddOrder(model.NewOrder(1, model.BID, test.move, 1, model.ORDER_GOOD_TILL_CANCEL)); err == nil {
+				t.Error("an order was accepted during the halt")
+			}
+			bb.clock.Advance(bands.HaltDuration)
+			if bb.book.GetHalt() != nil {
+				t.Errorf("still halted after the halt duration: %+v", bb.book.GetHalt())
+			}
+			if len(bb.trade(t, test.move)) != 1 {
+				t.Error("the move did not trade once the halt was over")
+			}
+			if err := bb.book.CheckInvariants(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package engine
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/Yusufzhafir/go-orderbook/backend/pkg/model"
+)
+
+// record gives a command the next sequence number and journals it before it is applied. A
+// command that cannot be journaled is refused, the book never runs ahead of its journal. The
+// command runs at the time it is journaled with, so a replay sees the same clock.
+func (o *orderBookEngineImpl) record(entry JournalEntry) error {
+	entry.Sequence = o.sequence + 1
+	entry.Time = o.clock.Now().Round(0) // wall clock only, as a replay reads it back
+	if o.journal != nil {
+		if err := o.journal.Append(entry); err != nil {
+			return fmt.Errorf("journaling command %d: %w", entry.Sequence, err)
+		}
+	}
+	o.sequence = entry.Sequence
+	o.now = entry.Time
+	return nil
+}
+
+// nextTradeID numbers a trade of the command being applied. A replay hands out the ids the
+// original run journaled for the command, so it prints the very same trades; a command whose ids
+// never reached the journal, cut off by a crash, gets new ones.
+func (o *orderBookEngineImpl) nextTradeID() uint64 {
+	if len(o.replayIDs) > 0 {
+		id := o.replayIDs[0]
+		o.replayIDs = o.replayIDs[1:]
+		return id
+	}
+	id := o.ids.Next()
+	o.tradeIDs = append(o.tradeIDs, id)
+	return id
+}
+
+// journalTradeIDs writes the ids of the trades the command printed after the command itself. The
+// command is applied by then, so failing to write them is only logged; a replay numbers those
+// trades anew.
+func (o *orderBookEngineImpl) journalTradeIDs() {
+	defer func() { o.tradeIDs = o.tradeIDs[:0] }()
+	if o.journal == nil || o.replaying {
+		return
+	}
+	for start := 0; start < len(o.tradeIDs); start += TRADE_IDS_PER_RECORD {
+		entry := JournalEntry{
+			Sequence: o.sequence,
+			Time:     o.now,
+			Command:  JOURNAL_TRADE_IDS,
+			TradeIDs: o.tradeIDs[start:min(start+TRADE_IDS_PER_RECORD, len(o.tradeIDs))],
+		}
+		if err := o.journal.Append(entry); err != nil {
+			log.Printf("ticker %s: journaling trade ids of command %d: %v", o.ticker, o.sequence, err)
+			return
+		}
+	}
+}
+
+// Sequence is the journal sequence of the last command the engine applied.
+func (o *orderBookEngineImpl) Sequence() uint64 {
+	return o.sequence
+}
+
+// Replay applies journaled commands to the book without journaling them again and returns the
+// trades they print, the same trades the original run printed down to their ids and times.
+// Entries the book already covers, such as those taken before the snapshot it was restored
+// from, are skipped. Cancel, reduce, halt and event handlers are not called, their effects
+// happened in the original run; the events are still numbered, so the event stream carries on
+// where the original run left it. A command the engine rejects was rejected the first time
+// too, so that is not an error; a gap in the sequence is.
+func (o *orderBookEngineImpl) Replay(entries []JournalEntry) ([]*model.Trade, error) {
+	cancelHandler, reduceHandler, haltHandler, eventHandler := o.cancelHandler, o.reduceHandler, o.haltHandler, o.eventHandler
+	o.cancelHandler, o.reduceHandler, o.haltHandler, o.eventHandler = nil, nil, nil, nil
+	defer func() {
+		o.cancelHandler, o.reduceHandler, o.haltHandler, o.eventHandler = cancelHandler, reduceHandler, haltHandler, eventHandler
+	}()
+
+	tradeIDs := make(map[uint64][]uint64)
+	for _, entry := range entries {
+		if entry.Command == JOURNAL_TRADE_IDS {
+			tradeIDs[entry.Sequence] = append(tradeIDs[entry.Sequence], entry.TradeIDs...)
+		}
+	}
+	o.replaying = true
+	defer func() { o.replaying, o.replayIDs = false, nil }()
+
+	trades := make([]*model.Trade, 0)
+	for _, entry := range entries {
+		if entry.Sequence <= o.sequence || entry.Command == JOURNAL_TRADE_IDS {
+			continue
+		}
+		if entry.Sequence != o.sequence+1 {
+			return trades, fmt.Errorf("journal jumps from %d to %d", o.sequence, entry.Sequence)
+		}
+		o.now = entry.Time
+		o.replayIDs = tradeIDs[entry.Sequence]
+
+		var replayed []*model.Trade
+		switch entry.Command {
+		case JOURNAL_ADD:
+			replayed, _ = o.submitOrder(entry.Order)
+		case JOURNAL_CANCEL:
+			o.cancelOrder(entry.OrderID, "")
+		case JOURNAL_MODIFY:
+			replayed, _ = o.modifyOrder(entry.Modify, entry.OrderType)
+		case JOURNAL_RESTORE:
+			order := entry.Order
+			o.restoreOrder(&order)
+		case JOURNAL_PHASE:
+			replayed = o.setTradingPhase(entry.Phase)
+		case JOURNAL_STATUS:
+			o.setTickerStatus(entry.Status)
+		default:
+			return trades, fmt.Errorf("unknown journal command %d at %d", entry.Command, entry.Sequence)
+		}
+		o.flushEvents()
+		trades = append(trades, replayed...)
+		o.sequence = entry.Sequence
+	}
+	return trades, nil
+}
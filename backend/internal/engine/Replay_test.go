@@ -0,0 +1,83 @@
+package engine
+
+import (
+	"math/rand"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Yusufzhafir/go-orderbook/backend/pkg/clock"
+	"github.com/Yusufzhafir/go-orderbook/backend/pkg/model"
+	"github.com/Yusufzhafir/go-orderbook/backend/pkg/snowflake"
+)
+
+// tradesIn returns the trades events report, in the order they were printed.
+func tradesIn(events []model.Event) []model.Trade {
+	trades := make([]model.Trade, 0)
+	for _, event := range events {
+		if event.Type == model.EVENT_TRADE {
+			trades = append(trades, *event.Trade)
+		}
+	}
+	return trades
+}
+
+// TestReplayPrintsTheSameTrades journals a random flow and replays it into a book whose clock
+// and trade id generator have nothing in common with the original, which still has to print
+// every trade again with the same id and time.
+func TestReplayPrintsTheSameTrades(t *testing.T) {
+	for seed := int64(1); seed <= 5; seed++ {
+		data := make([]byte, 5_000)
+		rand.New(rand.NewSource(seed)).Read(data)
+
+		path := filepath.Join(t.TempDir(), "FLOW.journal")
+		journal, err := OpenJournal(JournalOpts{Path: path})
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := &commandStream{data: data}
+		original := newFlowBook(s, OrderBookEngineOpts{Journal: journal})
+		for !s.done() {
+			original.step(s)
+		}
+		if err := journal.Close(); err != nil {
+			t.Fatal(err)
+		}
+		want := tradesIn(original.events)
+		if len(want) == 0 {
+			t.Fatalf("seed %d: the flow printed no trades", seed)
+		}
+
+		entries := make([]JournalEntry, 0)
+		if err := ReadJournal(path, func(entry JournalEntry) error {
+			entries = append(entries, entry)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		later := clock.NewManual(time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC))
+		ids, err := snowflake.NewGenerator(snowflake.GeneratorOpts{Node: 7, Clock: later})
+		if err != nil {
+			t.Fatal(err)
+		}
+		replayed := newFlowBook(&commandStream{data: data}, OrderBookEngineOpts{Clock: later, IDs: ids})
+		trades, err := replayed.book.Replay(entries)
+		if err != nil {
+			t.Fatalf("seed %d: %v", seed, err)
+		}
+
+		if len(trades) != len(want) {
+			t.Fatalf("seed %d: replay printed %d trades, the original run %d", seed, len(trades), len(want))
+		}
+		for i, trade := range trades {
+			got := *trade
+			if !got.Timestamp.Equal(want[i].Timestamp) {
+				t.Fatalf("seed %d: trade %d at %v, originally at %v", seed, i, got.Timestamp, want[i].Timestamp)
+			}
+			got.Timestamp = want[i].Timestamp
+			if got != want[i] {
+				t.Fatalf("seed %d: trade %d replayed as %+v, originally %+v", seed, i, got, want[i])
+			}
+		}
+	}
+}
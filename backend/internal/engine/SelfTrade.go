@@ -0,0 +1,90 @@
+package engine
+
+import (
+	"log"
+
+	"github.com/Yusufzhafir/go-orderbook/backend/pkg/model"
+)
+
+// selfTradeMode returns the prevention mode that applies when incoming meets resting,
+// STP_NONE unless both belong to the same known owner. The incoming order's mode wins.
+func selfTradeMode(incoming, resting *model.Order) model.SelfTradePrevention {
+	if incoming.GetOwner() == 0 || incoming.GetOwner() != resting.GetOwner() {
+		return model.STP_NONE
+	}
+	return incoming.GetSelfTradePrevention()
+}
+
+// selfTradeIn returns the first resting order in allocations that incoming must not trade with.
+func selfTradeIn(incoming *model.Order, allocations []Allocation) *model.Order {
+	for _, allocation := range allocations {
+		if selfTradeMode(incoming, allocation.Order) != model.STP_NONE {
+			return allocation.Order
+		}
+	}
+	return nil
+}
+
+// preventSelfTrade resolves a self trade between incoming and resting without printing a trade
+// and reports whether incoming is cancelled. Every reduction is reported by an ORDER_REDUCED
+// event; resting orders it cancels or shrinks also go to the handlers, incoming is not on the
+// book yet and is left to the caller. An unknown mode cancels incoming, it cannot be resolved
+// and the order would otherwise meet the same resting order again.
+func (o *orderBookEngineImpl) preventSelfTrade(mode model.SelfTradePrevention, incoming, resting *model.Order) bool {
+	switch mode {
+	case model.STP_CANCEL_NEWEST:
+		return true
+	case model.STP_CANCEL_OLDEST:
+		o.dropResting(resting)
+	case model.STP_CANCEL_BOTH:
+		o.dropResting(resting)
+		return true
+	case model.STP_DECREMENT_AND_CANCEL:
+		incomingLeft, restingLeft := incoming.GetRemainingQuantity(), resting.GetRemainingQuantity()
+		switch {
+		case incomingLeft > restingLeft:
+			o.dropResting(resting)
+			o.reduceIncoming(incoming, restingLeft)
+		case incomingLeft < restingLeft:
+			o.reduceResting(resting, incomingLeft)
+			return true
+		default:
+			o.dropResting(resting)
+			return true
+		}
+	default:
+		return true
+	}
+	return false
+}
+
+// dropResting cancels a resting order on behalf of the engine and tells the cancel handler.
+func (o *orderBookEngineImpl) dropResting(order *model.Order) {
+	if err := o.cancelOrder(order.GetId(), "self-trade prevention"); err != nil {
+		log.Printf("self trade prevention: %v", err)
+		return
+	}
+	if o.cancelHandler != nil {
+		o.cancelHandler(*order)
+	}
+}
+
+// reduceResting takes quantity off a resting order in place, keeping its queue position,
+// and tells the reduce handler.
+func (o *orderBookEngineImpl) reduceResting(order *model.Order, quantity model.Quantity) {
+	o.shrink(order, quantity)
+	o.emitReduced(order, quantity)
+	if o.reduceHandler != nil {
+		o.reduceHandler(*order, quantity)
+	}
+}
+
+// reduceIncoming takes quantity off an order that is still matching. Only the event reports
+// it, whoever placed the order accounts for it.
+func (o *orderBookEngineImpl) reduceIncoming(order *model.Order, quantity model.Quantity) {
+	if err := order.Reduce(quantity); err != nil {
+		log.Printf("self trade prevention: reducing order id %d: %v", order.GetId(), err)
+		return
+	}
+	o.emitReduced(order, quantity)
+}
@@ -0,0 +1,127 @@
+package engine
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/Yusufzhafir/go-orderbook/backend/pkg/model"
+)
+
+func TestSelfTradePrevention(t *testing.T) {
+	tests := []struct {
+		name         string
+		mode         model.SelfTradePrevention
+		incoming     model.Quantity
+		trades       int
+		restingLeft  model.Quantity // 0 means the resting order left the book
+		incomingLeft model.Quantity // what the incoming order rests with, 0 means it left
+		reduced      model.Quantity // what the reduce handler was told about the resting order
+		cancelled    bool           // whether the cancel handler was told about the resting order
+	}{
+		{
+			name:         "none trades with the own order",
+			mode:         model.STP_NONE,
+			incoming:     4,
+			trades:       1,
+			restingLeft:  6,
+			incomingLeft: 0,
+		},
+		{
+			name:         "cancel newest drops the incoming order",
+			mode:         model.STP_CANCEL_NEWEST,
+			incoming:     4,
+			restingLeft:  10,
+			incomingLeft: 0,
+		},
+		{
+			name:         "cancel oldest drops the resting order and rests the incoming one",
+			mode:         model.STP_CANCEL_OLDEST,
+			incoming:     4,
+			incomingLeft: 4,
+			cancelled:    true,
+		},
+		{
+			name:      "cancel both drops both orders",
+			mode:      model.STP_CANCEL_BOTH,
+			incoming:  4,
+			cancelled: true,
+		},
+		{
+			name:        "decrement takes the smaller incoming size off the resting order",
+			mode:        model.STP_DECREMENT_AND_CANCEL,
+			incoming:    4,
+			restingLeft: 6,
+			reduced:     4,
+		},
+		{
+			name:         "decrement takes the smaller resting size off the incoming order",
+			mode:         model.STP_DECREMENT_AND_CANCEL,
+			incoming:     15,
+			incomingLeft: 5,
+			cancelled:    true,
+		},
+		{
+			name:      "decrement with equal sizes drops both orders",
+			mode:      model.STP_DECREMENT_AND_CANCEL,
+			incoming:  10,
+			cancelled: true,
+		},
+		{
+			name:        "unknown mode drops the incoming order instead of matching forever",
+			mode:        model.STP_DECREMENT_AND_CANCEL + 1,
+			incoming:    4,
+			restingLeft: 10,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			book := newTestBook(t, "STP")
+			var cancelled bool
+			var reduced model.Quantity
+			book.RegisterCancelHandler(func(order model.Order) { cancelled = order.GetId() == 1 })
+			book.RegisterReduceHandler(func(order model.Order, quantity model.Quantity) {
+				if order.GetId() == 1 {
+					reduced += quantity
+				}
+			})
+
+			resting := model.NewOrder(1, model.ASK, 100, 10, model.ORDER_GOOD_TILL_CANCEL)
+			resting.SetOwner(7)
+			mustAdd(t, book, resting)
+			incoming := model.NewOrder(2, model.BID, 100, test.incoming, model.ORDER_GOOD_TILL_CANCEL)
+			incoming.SetOwner(7)
+			incoming.SetSelfTradePrevention(test.mode)
+			events := mustAdd(t, book, incoming)
+
+			if trades := len(tradesIn(events)); trades != test.trades {
+				t.Errorf("printed %d trades, want %d", trades, test.trades)
+			}
+			left := func(id model.OrderId) model.Quantity {
+				order, ok := book.GetOrder(id)
+				if !ok {
+					return 0
+				}
+				return order.GetRemainingQuantity()
+			}
+			if got := left(1); got != test.restingLeft {
+				t.Errorf("resting order has %d left, want %d", got, test.restingLeft)
+			}
+			if got := left(2); got != test.incomingLeft {
+				t.Errorf("incoming order rests with %d, want %d", got, test.incomingLeft)
+			}
+			if cancelled != test.cancelled {
+				t.Errorf("cancel handler told %v, want %v", cancelled, test.cancelled)
+			}
+			if reduced != test.reduced {
+				t.Errorf("reduce handler told %d, want %d", reduced, test.reduced)
+			}
+			if test.trades == 0 && test.incomingLeft == 0 && !slices.Contains(eventsOf(events, 2), model.EVENT_ORDER_CANCELLED) {
+				t.Errorf("incoming order left without ORDER_CANCELLED, got %v", eventsOf(events, 2))
+			}
+			if err := book.CheckInvariants(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,235 @@
+package engine
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	orderbookModel "github.com/Yusufzhafir/go-orderbook/backend/internal/engine/model"
+	"github.com/Yusufzhafir/go-orderbook/backend/pkg/model"
+	"github.com/google/btree"
+)
+
+// SNAPSHOT_MAGIC opens every snapshot, SNAPSHOT_VERSION is bumped whenever the layout changes.
+const (
+	SNAPSHOT_MAGIC   = "OBSN"
+	SNAPSHOT_VERSION = uint16(7)
+)
+
+var ErrSnapshotCorrupt = errors.New("order book snapshot is corrupt")
+
+// Snapshot layout, little-endian:
+//
+//	magic "OBSN" | version u16 | ticker len u16 | ticker | last trade price u64 | journal sequence u64
+//	event sequence u64
+//	trading phase u8 | ticker status u8
+//	static reference u64 | breaker reference u64 | breaker since i64
+//	halt price u64 | halt reference u64 | halt until i64
+//	bids: level count u32, per level price u64 | order count u32 | orders in queue order
+//	asks: same as bids
+//	stops: order count u32 | orders in trigger priority then time order
+//
+// Orders use the fixed encoding of model.Order.MarshalBinary, times are unix nanoseconds with 0
+// for none.
+
+// Snapshot encodes the book so Restore can rebuild it exactly, queue positions included.
+func (o *orderBookEngineImpl) Snapshot() ([]byte, error) {
+	buf := make([]byte, 0, 64+len(o.orders)*(model.ORDER_BINARY_SIZE+12))
+	buf = append(buf, SNAPSHOT_MAGIC...)
+	buf = binary.LittleEndian.AppendUint16(buf, SNAPSHOT_VERSION)
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(o.ticker)))
+	buf = append(buf, o.ticker...)
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(o.lastTradePrice))
+	buf = binary.LittleEndian.AppendUint64(buf, o.sequence)
+	buf = binary.LittleEndian.AppendUint64(buf, o.eventSequence)
+	buf = append(buf, byte(o.phase), byte(o.status))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(o.staticReference))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(o.breakerReference))
+	buf = appendTime(buf, o.breakerSince)
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(o.halt.Price))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(o.halt.Reference))
+	buf = appendTime(buf, o.halt.Until)
+
+	var err error
+	for _, tree := range []*btree.BTree{o.bids, o.asks} {
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(tree.Len()))
+		tree.Ascend(func(item btree.Item) bool {
+			level := priceLevelOf(item)
+			buf = binary.LittleEndian.AppendUint64(buf, uint64(level.Price))
+			buf = binary.LittleEndian.AppendUint32(buf, uint32(level.Orders.Len()))
+			for order := level.Orders.Front(); order != nil && err == nil; order = order.Next() {
+				buf, err = order.AppendBinary(buf)
+			}
+			return err == nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	stops := o.stops.orders()
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(stops)))
+	for _, order := range stops {
+		if buf, err = order.AppendBinary(buf); err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+// Restore replaces the whole book with the one encoded in data. The snapshot must come from
+// the same ticker. Nothing is matched and no handler is called while the book is rebuilt, and
+// the journal and event sequences pick up where the snapshot was taken.
+func (o *orderBookEngineImpl) Restore(data []byte) error {
+	r := snapshotReader{data: data}
+	if string(r.bytes(len(SNAPSHOT_MAGIC))) != SNAPSHOT_MAGIC {
+		return fmt.Errorf("%w: bad magic", ErrSnapshotCorrupt)
+	}
+	if version := r.u16(); r.err == nil && version != SNAPSHOT_VERSION {
+		return fmt.Errorf("unsupported order book snapshot version %d", version)
+	}
+	ticker := string(r.bytes(int(r.u16())))
+	if r.err != nil {
+		return r.err
+	}
+	if ticker != o.ticker {
+		return fmt.Errorf("snapshot is for ticker %q, not %q", ticker, o.ticker)
+	}
+	lastTradePrice := model.Price(r.u64())
+	sequence := r.u64()
+	eventSequence := r.u64()
+	phase := model.TradingPhase(r.u8())
+	status := model.TickerStatus(r.u8())
+	staticReference := model.Price(r.u64())
+	breakerReference := model.Price(r.u64())
+	breakerSince := r.time()
+	halt := model.Halt{Ticker: o.ticker, Price: model.Price(r.u64()), Reference: model.Price(r.u64()), Until: r.time()}
+
+	restored := &orderBookEngineImpl{ticker: o.ticker, policy: o.policy, phase: phase}
+	restored.Initialize()
+	for _, side := range []model.Side{model.BID, model.ASK} {
+		levels := r.u32()
+		for i := uint32(0); i < levels && r.err == nil; i++ {
+			price := model.Price(r.u64())
+			count := r.u32()
+			if count == 0 && r.err == nil {
+				return fmt.Errorf("%w: empty level at %d", ErrSnapshotCorrupt, price)
+			}
+			for j := uint32(0); j < count && r.err == nil; j++ {
+				order := r.order()
+				if r.err == nil && (order.GetSide() != side || order.GetPrice() != price) {
+					return fmt.Errorf("%w: order %d does not belong to level %d", ErrSnapshotCorrupt, order.GetId(), price)
+				}
+				if r.err == nil {
+					restored.rest(order)
+				}
+			}
+		}
+	}
+	stops := r.u32()
+	for i := uint32(0); i < stops && r.err == nil; i++ {
+		order := r.order()
+		if r.err == nil {
+			restored.orders[order.GetId()] = order
+			restored.stops.add(order)
+		}
+	}
+	if r.err != nil {
+		return r.err
+	}
+	if len(r.data) > 0 {
+		return fmt.Errorf("%w: %d trailing bytes", ErrSnapshotCorrupt, len(r.data))
+	}
+
+	o.bids, o.asks, o.stops, o.orders = restored.bids, restored.asks, restored.stops, restored.orders
+	o.lastTradePrice = lastTradePrice
+	o.sequence = sequence
+	o.eventSequence = eventSequence
+	o.phase = phase
+	o.status = status
+	o.staticReference, o.breakerReference, o.breakerSince = staticReference, breakerReference, breakerSince
+	o.halt = halt
+	return nil
+}
+
+func priceLevelOf(item btree.Item) *orderbookModel.PriceLevel {
+	if level, ok := item.(*orderbookModel.BidPriceLevel); ok {
+		return &level.PriceLevel
+	}
+	return &item.(*orderbookModel.AskPriceLevel).PriceLevel
+}
+
+// snapshotReader walks a snapshot, the first short read sticks in err and zeroes the rest.
+type snapshotReader struct {
+	data []byte
+	err  error
+}
+
+func (r *snapshotReader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.data) < n {
+		r.err = fmt.Errorf("%w: truncated", ErrSnapshotCorrupt)
+		return nil
+	}
+	out := r.data[:n]
+	r.data = r.data[n:]
+	return out
+}
+
+func (r *snapshotReader) u8() uint8 {
+	if b := r.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *snapshotReader) u16() uint16 {
+	if b := r.bytes(2); b != nil {
+		return binary.LittleEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *snapshotReader) u32() uint32 {
+	if b := r.bytes(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *snapshotReader) u64() uint64 {
+	if b := r.bytes(8); b != nil {
+		return binary.LittleEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (r *snapshotReader) time() time.Time {
+	if nanos := int64(r.u64()); nanos != 0 {
+		return time.Unix(0, nanos)
+	}
+	return time.Time{}
+}
+
+func appendTime(buf []byte, t time.Time) []byte {
+	if t.IsZero() {
+		return binary.LittleEndian.AppendUint64(buf, 0)
+	}
+	return binary.LittleEndian.AppendUint64(buf, uint64(t.UnixNano()))
+}
+
+func (r *snapshotReader) order() *model.Order {
+	b := r.bytes(model.ORDER_BINARY_SIZE)
+	if b == nil {
+		return nil
+	}
+	order := &model.Order{}
+	if err := order.UnmarshalBinary(b); err != nil {
+		r.err = err
+		return nil
+	}
+	return order
+}
@@ -0,0 +1,206 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/Yusufzhafir/go-orderbook/backend/pkg/model"
+)
+
+// SNAPSHOT_ORDERS is how many order ids snapshotBook hands out.
+const SNAPSHOT_ORDERS = 14
+
+// snapshotBook returns a book holding every kind of order: plain limits queued behind each
+// other, an iceberg part way through its slice, a repriced post-only, good-till-date and day
+// orders, stops still waiting and a stop-limit that was triggered and rests.
+func snapshotBook(t *testing.T) OrderBookEngine {
+	t.Helper()
+	book := newTestBook(t, "SNAP")
+	iceberg := model.NewOrder(3, model.ASK, 106, 30, model.ORDER_GOOD_TILL_CANCEL)
+	iceberg.SetPeakSize(5)
+	postOnly := model.NewOrder(7, model.BID, 105, 2, model.ORDER_GOOD_TILL_CANCEL)
+	postOnly.SetPostOnly(model.POST_ONLY_REPRICE)
+	for _, order := range []model.Order{
+		model.NewOrder(1, model.ASK, 105, 10, model.ORDER_GOOD_TILL_CANCEL),
+		model.NewOrder(2, model.ASK, 105, 4, model.ORDER_GOOD_TILL_CANCEL),
+		iceberg,
+		model.NewOrder(4, model.ASK, 106, 2, model.ORDER_GOOD_TILL_CANCEL),
+		model.NewOrder(5, model.ASK, 107, 6, model.ORDER_DAY),
+		model.NewOrder(6, model.BID, 99, 8, model.ORDER_GOOD_TILL_CANCEL),
+		model.NewOrder(8, model.BID, 99, 3, model.ORDER_GOOD_TILL_DATE),
+		postOnly,
+		model.NewStopOrder(9, model.ASK, 95, 0, 2, model.ORDER_STOP_MARKET, 0),
+		model.NewStopOrder(10, model.BID, 110, 111, 3, model.ORDER_STOP_LIMIT, 0),
+		model.NewStopOrder(11, model.BID, 105, 103, 2, model.ORDER_STOP_LIMIT, 0),
+		// takes the asks at 105 and triggers order 11, which rests at 103
+		model.NewOrder(12, model.BID, 106, 12, model.ORDER_IMMEDIATE_OR_CANCEL),
+		// takes what is left at 105 and part of the iceberg's slice
+		model.NewOrder(13, model.BID, 106, 5, model.ORDER_IMMEDIATE_OR_CANCEL),
+	} {
+		mustAdd(t, book, order)
+	}
+	if _, ok := book.GetOrder(11); !ok {
+		t.Fatal("the triggered stop-limit is not resting")
+	}
+	if order, _ := book.GetOrder(3); order.GetDisplayedQuantity() != 2 {
+		t.Fatalf("iceberg shows %d, want 2", order.GetDisplayedQuantity())
+	}
+	return book
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	original := snapshotBook(t)
+	data, err := original.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := newTestBook(t, "SNAP")
+	if err := restored.Restore(data); err != nil {
+		t.Fatal(err)
+	}
+
+	again, err := restored.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(again, data) {
+		t.Error("the restored book snapshots differently")
+	}
+	if restored.Sequence() != original.Sequence() || restored.EventSequence() != original.EventSequence() {
+		t.Errorf("restored sequences %d and %d, want %d and %d", restored.Sequence(), restored.EventSequence(), original.Sequence(), original.EventSequence())
+	}
+	if restored.GetTickerState() != original.GetTickerState() {
+		t.Errorf("restored ticker state %+v, want %+v", restored.GetTickerState(), original.GetTickerState())
+	}
+	for _, side := range []model.Side{model.BID, model.ASK} {
+		want := original.GetOrderBookL3(side, 0, SNAPSHOT_ORDERS).Orders
+		got := restored.GetOrderBookL3(side, 0, SNAPSHOT_ORDERS).Orders
+		if len(got) != len(want) {
+			t.Fatalf("side %d restored %d orders, want %d", side, len(got), len(want))
+		}
+		for i := range want {
+			if got[i].OrderID != want[i].OrderID || got[i].Price != want[i].Price || got[i].Quantity != want[i].Quantity || !got[i].EnteredAt.Equal(want[i].EnteredAt) {
+				t.Errorf("side %d position %d restored as %+v, want %+v", side, i, got[i], want[i])
+			}
+		}
+	}
+	for id := model.OrderId(1); id <= SNAPSHOT_ORDERS; id++ {
+		want, wantOK := original.GetOrder(id)
+		got, gotOK := restored.GetOrder(id)
+		if gotOK != wantOK {
+			t.Errorf("order %d restored %v, want %v", id, gotOK, wantOK)
+			continue
+		}
+		wantData, _ := want.MarshalBinary()
+		gotData, _ := got.MarshalBinary()
+		if !bytes.Equal(gotData, wantData) {
+			t.Errorf("order %d restored as %+v, want %+v", id, got, want)
+		}
+	}
+	if err := restored.CheckInvariants(); err != nil {
+		t.Error(err)
+	}
+
+	// the restored book trades the next order, and releases the stops, like the original
+	sweep := model.NewOrder(SNAPSHOT_ORDERS, model.BID, 111, 40, model.ORDER_IMMEDIATE_OR_CANCEL)
+	want := tradesIn(mustAdd(t, original, sweep))
+	got := tradesIn(mustAdd(t, restored, sweep))
+	if len(got) != len(want) {
+		t.Fatalf("restored book printed %d trades, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].MakerID != want[i].MakerID || got[i].TakerID != want[i].TakerID || got[i].Price != want[i].Price || got[i].Quantity != want[i].Quantity {
+			t.Errorf("trade %d printed as %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestRestoreRejectsBadSnapshots(t *testing.T) {
+	book := snapshotBook(t)
+	data, err := book.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	edit := func(change func([]byte) []byte) []byte {
+		return change(bytes.Clone(data))
+	}
+	tests := []struct {
+		name    string
+		ticker  string
+		data    []byte
+		corrupt bool // whether the error is ErrSnapshotCorrupt
+	}{
+		{
+			name:    "empty",
+			ticker:  "SNAP",
+			data:    nil,
+			corrupt: true,
+		},
+		{
+			name:    "truncated version",
+			ticker:  "SNAP",
+			data:    data[:len(SNAPSHOT_MAGIC)+1],
+			corrupt: true,
+		},
+		{
+			name:    "truncated header",
+			ticker:  "SNAP",
+			data:    data[:10],
+			corrupt: true,
+		},
+		{
+			name:    "truncated order",
+			ticker:  "SNAP",
+			data:    data[:len(data)-1],
+			corrupt: true,
+		},
+		{
+			name:    "trailing bytes",
+			ticker:  "SNAP",
+			data:    append(bytes.Clone(data), 0),
+			corrupt: true,
+		},
+		{
+			name:   "bad magic",
+			ticker: "SNAP",
+			data: edit(func(b []byte) []byte {
+				b[0] = 'X'
+				return b
+			}),
+			corrupt: true,
+		},
+		{
+			name:   "bad version",
+			ticker: "SNAP",
+			data: edit(func(b []byte) []byte {
+				binary.LittleEndian.PutUint16(b[len(SNAPSHOT_MAGIC):], SNAPSHOT_VERSION+1)
+				return b
+			}),
+		},
+		{
+			name:   "wrong ticker",
+			ticker: "OTHER",
+			data:   data,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			target := newTestBook(t, test.ticker)
+			mustAdd(t, target, model.NewOrder(1, model.BID, 50, 1, model.ORDER_GOOD_TILL_CANCEL))
+
+			err := target.Restore(test.data)
+			if err == nil {
+				t.Fatal("Restore accepted the snapshot")
+			}
+			if errors.Is(err, ErrSnapshotCorrupt) != test.corrupt {
+				t.Errorf("Restore returned %v, corrupt should be %v", err, test.corrupt)
+			}
+			if order, ok := target.GetOrder(1); !ok || order.GetPrice() != 50 || target.OrderSize() != 1 {
+				t.Error("a failed Restore changed the book")
+			}
+		})
+	}
+}
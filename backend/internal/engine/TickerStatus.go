@@ -0,0 +1,54 @@
+package engine
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/Yusufzhafir/go-orderbook/backend/pkg/model"
+)
+
+// TICKER_CLOSED_REASON is the reason given on the cancels of a ticker being closed.
+const TICKER_CLOSED_REASON = "ticker closed"
+
+// SetTickerStatus moves the ticker to the status an operator set. Closing it cancels every open
+// order, stops included, through the cancel handler.
+func (o *orderBookEngineImpl) SetTickerStatus(status model.TickerStatus) ([]model.Event, error) {
+	if status > model.TICKER_STATUS_CLOSED {
+		return nil, fmt.Errorf("unknown ticker status %d", status)
+	}
+	if err := o.record(JournalEntry{Command: JOURNAL_STATUS, Status: status}); err != nil {
+		return nil, err
+	}
+	o.setTickerStatus(status)
+	return o.flushEvents(), nil
+}
+
+func (o *orderBookEngineImpl) setTickerStatus(status model.TickerStatus) {
+	o.status = status
+	if status != model.TICKER_STATUS_CLOSED {
+		return
+	}
+	// by id, so a replay cancels them in the same order
+	ids := make([]model.OrderId, 0, len(o.orders))
+	for id := range o.orders {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	for _, id := range ids {
+		order := o.orders[id]
+		o.cancelOrder(id, TICKER_CLOSED_REASON)
+		if o.cancelHandler != nil {
+			o.cancelHandler(*order)
+		}
+	}
+}
+
+// GetTickerState is what the ticker takes right now: the operator status, cancel-only while the
+// phase is closed or a circuit breaker halt runs.
+func (o *orderBookEngineImpl) GetTickerState() model.TickerState {
+	state := model.TickerState{Ticker: o.ticker, Status: o.status, Operator: o.status, Phase: o.phase, Halt: o.GetHalt()}
+	if o.status == model.TICKER_STATUS_OPEN && (o.phase == model.PHASE_CLOSED || state.Halt != nil) {
+		state.Status = model.TICKER_STATUS_CANCEL_ONLY
+	}
+	return state
+}
@@ -0,0 +1,99 @@
+package engine
+
+import (
+	orderbookModel "github.com/Yusufzhafir/go-orderbook/backend/internal/engine/model"
+	"github.com/Yusufzhafir/go-orderbook/backend/pkg/model"
+	"github.com/google/btree"
+)
+
+// triggerBook keeps stop orders out of the bids/asks trees until a trade reaches their stop price.
+type triggerBook struct {
+	buyStops, sellStops *btree.BTree
+	size                int
+}
+
+func newTriggerBook() *triggerBook {
+	return &triggerBook{
+		buyStops:  btree.New(32),
+		sellStops: btree.New(32),
+	}
+}
+
+func (tb *triggerBook) Len() int {
+	return tb.size
+}
+
+func (tb *triggerBook) add(order *model.Order) {
+	if order.GetSide() == model.BID {
+		level := orderbookModel.NewBuyStopLevel(order.GetStopPrice())
+		if item := tb.buyStops.Get(level); item != nil {
+			level = item.(*orderbookModel.BuyStopLevel)
+		} else {
+			tb.buyStops.ReplaceOrInsert(level)
+		}
+		level.Append(order)
+	} else {
+		level := orderbookModel.NewSellStopLevel(order.GetStopPrice())
+		if item := tb.sellStops.Get(level); item != nil {
+			level = item.(*orderbookModel.SellStopLevel)
+		} else {
+			tb.sellStops.ReplaceOrInsert(level)
+		}
+		level.Append(order)
+	}
+	tb.size++
+}
+
+func (tb *triggerBook) remove(order *model.Order) bool {
+	level := orderbookModel.StopLevelOf(order)
+	if level == nil || !level.Remove(order) {
+		return false
+	}
+	if level.Orders.Len() == 0 {
+		if order.GetSide() == model.BID {
+			tb.buyStops.Delete(orderbookModel.NewBuyStopLevel(level.StopPrice))
+		} else {
+			tb.sellStops.Delete(orderbookModel.NewSellStopLevel(level.StopPrice))
+		}
+	}
+	tb.size--
+	return true
+}
+
+// popTriggered removes and returns the stops crossed by trades printed between low and high:
+// buy stops at or below high and sell stops at or above low, in trigger priority then time order.
+func (tb *triggerBook) popTriggered(low, high model.Price) []*model.Order {
+	triggered := make([]*model.Order, 0)
+	for tb.buyStops.Len() > 0 {
+		level := tb.buyStops.Min().(*orderbookModel.BuyStopLevel)
+		if level.StopPrice > high {
+			break
+		}
+		triggered = append(triggered, level.Drain()...)
+		tb.buyStops.DeleteMin()
+	}
+	for tb.sellStops.Len() > 0 {
+		level := tb.sellStops.Min().(*orderbookModel.SellStopLevel)
+		if level.StopPrice < low {
+			break
+		}
+		triggered = append(triggered, level.Drain()...)
+		tb.sellStops.DeleteMin()
+	}
+	tb.size -= len(triggered)
+	return triggered
+}
+
+// orders lists every waiting stop, buy stops then sell stops, each in trigger priority then time order.
+func (tb *triggerBook) orders() []*model.Order {
+	orders := make([]*model.Order, 0, tb.size)
+	tb.buyStops.Ascend(func(item btree.Item) bool {
+		orders = append(orders, item.(*orderbookModel.BuyStopLevel).Orders.Orders()...)
+		return true
+	})
+	tb.sellStops.Ascend(func(item btree.Item) bool {
+		orders = append(orders, item.(*orderbookModel.SellStopLevel).Orders.Orders()...)
+		return true
+	})
+	return orders
+}
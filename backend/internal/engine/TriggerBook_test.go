@@ -0,0 +1,167 @@
+package engine
+
+import (
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/Yusufzhafir/go-orderbook/backend/pkg/model"
+)
+
+// released is what the cancel handler was told about a triggered stop.
+type released struct {
+	filled model.Quantity
+	spent  uint64
+}
+
+func TestTriggeredStopLeftovers(t *testing.T) {
+	tests := []struct {
+		name    string
+		stop    model.Order
+		resting model.Quantity // what the stop rests with once triggered, 0 when it left the book
+		want    []released     // what the cancel handler heard about the stop
+	}{
+		{
+			name: "stop-market buy that fills completely hands back the unused notional",
+			stop: model.NewStopOrder(10, model.BID, 100, 0, 3, model.ORDER_STOP_MARKET, 1000),
+			want: []released{{filled: 3, spent: 300}},
+		},
+		{
+			name: "stop-market buy that runs out of notional is cancelled with what it spent",
+			stop: model.NewStopOrder(10, model.BID, 100, 0, 3, model.ORDER_STOP_MARKET, 250),
+			want: []released{{filled: 2, spent: 200}},
+		},
+		{
+			name: "stop-market buy that runs out of liquidity is cancelled with what it spent",
+			stop: model.NewStopOrder(10, model.BID, 100, 0, 12, model.ORDER_STOP_MARKET, 5000),
+			want: []released{{filled: 9, spent: 905}},
+		},
+		{
+			name: "stop-limit buy that fills completely is released, crossed orders trade at the bid",
+			stop: model.NewStopOrder(10, model.BID, 100, 105, 3, model.ORDER_STOP_LIMIT, 0),
+			want: []released{{filled: 3, spent: 315}},
+		},
+		{
+			name:    "stop-limit buy that rests is not released",
+			stop:    model.NewStopOrder(10, model.BID, 100, 99, 3, model.ORDER_STOP_LIMIT, 0),
+			resting: 3,
+			want:    []released{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			book := newTestBook(t, "STOP")
+			got := make([]released, 0)
+			book.RegisterCancelHandler(func(order model.Order) {
+				if order.GetId() == 10 {
+					got = append(got, released{order.GetFilledQuantity(), order.GetSpentNotional()})
+				}
+			})
+			mustAdd(t, book, model.NewOrder(1, model.ASK, 100, 5, model.ORDER_GOOD_TILL_CANCEL))
+			mustAdd(t, book, model.NewOrder(2, model.ASK, 101, 5, model.ORDER_GOOD_TILL_CANCEL))
+			mustAdd(t, book, test.stop)
+			// the trade at 100 triggers the stop
+			mustAdd(t, book, model.NewOrder(3, model.BID, 100, 1, model.ORDER_IMMEDIATE_OR_CANCEL))
+
+			if len(got) != len(test.want) {
+				t.Fatalf("cancel handler heard %v, want %v", got, test.want)
+			}
+			for i := range got {
+				if got[i] != test.want[i] {
+					t.Errorf("cancel handler heard %v, want %v", got, test.want)
+				}
+			}
+			var resting model.Quantity
+			if order, ok := book.GetOrder(10); ok {
+				resting = order.GetRemainingQuantity()
+			}
+			if resting != test.resting {
+				t.Errorf("stop rests with %d, want %d", resting, test.resting)
+			}
+			if err := book.CheckInvariants(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// TestStopCascade has one trade release a chain of stops, each triggered by the trades of the
+// one before it.
+func TestStopCascade(t *testing.T) {
+	book := newTestBook(t, "STOP")
+	got := make(map[model.OrderId]released)
+	book.RegisterCancelHandler(func(order model.Order) {
+		got[order.GetId()] = released{order.GetFilledQuantity(), order.GetSpentNotional()}
+	})
+	for _, order := range []model.Order{
+		model.NewOrder(1, model.ASK, 100, 1, model.ORDER_GOOD_TILL_CANCEL),
+		model.NewOrder(2, model.ASK, 101, 2, model.ORDER_GOOD_TILL_CANCEL),
+		model.NewOrder(3, model.ASK, 102, 2, model.ORDER_GOOD_TILL_CANCEL),
+		model.NewOrder(4, model.ASK, 103, 5, model.ORDER_GOOD_TILL_CANCEL),
+		model.NewOrder(5, model.ASK, 105, 1, model.ORDER_GOOD_TILL_CANCEL),
+		// entered before order 10 but triggers after it, on the trades at 101
+		model.NewStopOrder(11, model.BID, 101, 0, 2, model.ORDER_STOP_MARKET, 1000),
+		model.NewStopOrder(10, model.BID, 100, 0, 2, model.ORDER_STOP_MARKET, 1000),
+		// queued behind order 10 at the same stop price, finds 101 taken and rests
+		model.NewStopOrder(12, model.BID, 100, 101, 1, model.ORDER_STOP_LIMIT, 0),
+		// released by the trades at 102, runs out of notional at 103
+		model.NewStopOrder(13, model.BID, 102, 0, 3, model.ORDER_STOP_MARKET, 250),
+		// the cascade stops at 103 and never reaches it
+		model.NewStopOrder(14, model.BID, 104, 0, 1, model.ORDER_STOP_MARKET, 1000),
+	} {
+		mustAdd(t, book, order)
+	}
+
+	events := mustAdd(t, book, model.NewOrder(20, model.BID, 100, 1, model.ORDER_IMMEDIATE_OR_CANCEL))
+	order := make([]model.OrderId, 0)
+	for _, event := range events {
+		if event.Type == model.EVENT_ORDER_TRIGGERED {
+			order = append(order, event.OrderID)
+		}
+	}
+	if want := []model.OrderId{10, 12, 11, 13}; !slices.Equal(order, want) {
+		t.Errorf("stops triggered in order %v, want %v", order, want)
+	}
+	want := map[model.OrderId]released{
+		10: {filled: 2, spent: 202},
+		11: {filled: 2, spent: 204},
+		13: {filled: 2, spent: 206},
+	}
+	if !maps.Equal(got, want) {
+		t.Errorf("cancel handler heard %v, want %v", got, want)
+	}
+	if stop, ok := book.GetOrder(12); !ok || stop.GetType() != model.ORDER_GOOD_TILL_CANCEL || stop.GetRemainingQuantity() != 1 {
+		t.Errorf("the stop-limit should rest triggered with 1, got %+v", stop)
+	}
+	if stop, ok := book.GetOrder(14); !ok || stop.GetType() != model.ORDER_STOP_MARKET {
+		t.Errorf("the stop at 104 should still wait, got %+v", stop)
+	}
+	if err := book.CheckInvariants(); err != nil {
+		t.Error(err)
+	}
+
+	// a book restored after the cascade keeps the triggered stop on the book and the waiting
+	// one in the trigger book
+	data, err := book.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := newTestBook(t, "STOP")
+	if err := restored.Restore(data); err != nil {
+		t.Fatal(err)
+	}
+	events = mustAdd(t, restored, model.NewOrder(21, model.BID, 105, 4, model.ORDER_IMMEDIATE_OR_CANCEL))
+	order = order[:0]
+	for _, event := range events {
+		if event.Type == model.EVENT_ORDER_TRIGGERED {
+			order = append(order, event.OrderID)
+		}
+	}
+	if want := []model.OrderId{14}; !slices.Equal(order, want) {
+		t.Errorf("restored book triggered %v, want %v", order, want)
+	}
+	if err := restored.CheckInvariants(); err != nil {
+		t.Error(err)
+	}
+}
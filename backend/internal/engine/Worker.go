@@ -0,0 +1,329 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/Yusufzhafir/go-orderbook/backend/pkg/model"
+)
+
+// ErrWorkerStopped is returned by futures whose command never ran because the worker stopped.
+var ErrWorkerStopped = errors.New("order book worker stopped")
+
+// Future is the pending result of a command sent to a Worker.
+type Future[T any] struct {
+	done    chan struct{}
+	stopped <-chan struct{}
+	value   T
+	err     error
+}
+
+func (f *Future[T]) resolve(value T, err error) {
+	f.value, f.err = value, err
+	close(f.done)
+}
+
+// Done is closed once the result is ready.
+func (f *Future[T]) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait blocks until the worker ran the command, or returns ErrWorkerStopped if it never will.
+func (f *Future[T]) Wait() (T, error) {
+	select {
+	case <-f.done:
+		return f.value, f.err
+	case <-f.stopped:
+		select {
+		case <-f.done:
+			return f.value, f.err
+		default:
+			var zero T
+			return zero, ErrWorkerStopped
+		}
+	}
+}
+
+type command struct {
+	run      func(OrderBookEngine)
+	enqueued time.Time
+}
+
+// WorkerStats describes the command queue of one ticker.
+type WorkerStats struct {
+	Ticker      string        `json:"ticker"`
+	QueueDepth  int           `json:"queueDepth"`
+	QueueSize   int           `json:"queueSize"`
+	Processed   uint64        `json:"processed"`
+	LastLatency time.Duration `json:"lastLatencyNs"` // enqueue to completion of the latest command
+	AvgLatency  time.Duration `json:"avgLatencyNs"`
+	MaxLatency  time.Duration `json:"maxLatencyNs"`
+}
+
+type WorkerOpts struct {
+	Ticker    string
+	Engine    OrderBookEngine
+	QueueSize int // buffered commands before submitters block, defaults to 1024
+}
+
+// Worker owns an OrderBookEngine and runs every call to it on a single goroutine, so the
+// engine itself needs no locking. Commands go in over a channel and results come back as
+// futures. Worker also implements OrderBookEngine by submitting and waiting.
+type Worker struct {
+	ticker   string
+	engine   OrderBookEngine
+	commands chan command
+	stopped  chan struct{}
+
+	processed    atomic.Uint64
+	totalLatency atomic.Int64
+	lastLatency  atomic.Int64
+	maxLatency   atomic.Int64
+}
+
+func NewWorker(opts WorkerOpts) *Worker {
+	size := opts.QueueSize
+	if size <= 0 {
+		size = 1024
+	}
+	return &Worker{
+		ticker:   opts.Ticker,
+		engine:   opts.Engine,
+		commands: make(chan command, size),
+		stopped:  make(chan struct{}),
+	}
+}
+
+// Run executes commands until ctx is done. It must be started exactly once.
+func (w *Worker) Run(ctx context.Context) {
+	defer close(w.stopped)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case cmd := <-w.commands:
+			cmd.run(w.engine)
+			w.observe(time.Since(cmd.enqueued))
+		}
+	}
+}
+
+func (w *Worker) observe(latency time.Duration) {
+	w.processed.Add(1)
+	w.totalLatency.Add(int64(latency))
+	w.lastLatency.Store(int64(latency))
+	for {
+		current := w.maxLatency.Load()
+		if int64(latency) <= current || w.maxLatency.CompareAndSwap(current, int64(latency)) {
+			return
+		}
+	}
+}
+
+func (w *Worker) Stats() WorkerStats {
+	stats := WorkerStats{
+		Ticker:      w.ticker,
+		QueueDepth:  len(w.commands),
+		QueueSize:   cap(w.commands),
+		Processed:   w.processed.Load(),
+		LastLatency: time.Duration(w.lastLatency.Load()),
+		MaxLatency:  time.Duration(w.maxLatency.Load()),
+	}
+	if stats.Processed > 0 {
+		stats.AvgLatency = time.Duration(w.totalLatency.Load() / int64(stats.Processed))
+	}
+	return stats
+}
+
+// submit queues run on w and returns its future, methods cannot have type parameters.
+func submit[T any](w *Worker, run func(OrderBookEngine) (T, error)) *Future[T] {
+	future := &Future[T]{done: make(chan struct{}), stopped: w.stopped}
+	cmd := command{
+		run: func(engine OrderBookEngine) {
+			future.resolve(run(engine))
+		},
+		enqueued: time.Now(),
+	}
+	select {
+	case w.commands <- cmd:
+	case <-w.stopped:
+		var zero T
+		future.resolve(zero, ErrWorkerStopped)
+	}
+	return future
+}
+
+func (w *Worker) SubmitAdd(order model.Order) *Future[[]model.Event] {
+	return submit(w, func(engine OrderBookEngine) ([]model.Event, error) {
+		return engine.AddOrder(order)
+	})
+}
+
+func (w *Worker) SubmitCancel(orderID model.OrderId) *Future[struct{}] {
+	return submit(w, func(engine OrderBookEngine) (struct{}, error) {
+		return struct{}{}, engine.CancelOrder(orderID)
+	})
+}
+
+func (w *Worker) SubmitModify(modify model.OrderModify, orderType model.OrderType) *Future[[]model.Event] {
+	return submit(w, func(engine OrderBookEngine) ([]model.Event, error) {
+		return engine.ModifyOrder(modify, orderType)
+	})
+}
+
+// SubmitQuery runs fn on the worker goroutine, for reads or for several calls that must not
+// interleave with other commands. fn must not call back into the worker.
+func (w *Worker) SubmitQuery(fn func(engine OrderBookEngine)) *Future[struct{}] {
+	return submit(w, func(engine OrderBookEngine) (struct{}, error) {
+		fn(engine)
+		return struct{}{}, nil
+	})
+}
+
+// query runs fn on the worker and waits, a stopped worker leaves the zero value.
+func query[T any](w *Worker, fn func(OrderBookEngine) T) T {
+	var result T
+	w.SubmitQuery(func(engine OrderBookEngine) {
+		result = fn(engine)
+	}).Wait()
+	return result
+}
+
+func (w *Worker) AddOrder(order model.Order) ([]model.Event, error) {
+	return w.SubmitAdd(order).Wait()
+}
+
+func (w *Worker) CancelOrder(orderID model.OrderId) error {
+	_, err := w.SubmitCancel(orderID).Wait()
+	return err
+}
+
+// PullOrder cancels orderID and returns the order as it was when it left the book, so what is
+// released for it is what the engine actually removed.
+func (w *Worker) PullOrder(orderID model.OrderId) (model.Order, error) {
+	return submit(w, func(engine OrderBookEngine) (model.Order, error) {
+		order, _ := engine.GetOrder(orderID)
+		return order, engine.CancelOrder(orderID)
+	}).Wait()
+}
+
+func (w *Worker) ModifyOrder(modify model.OrderModify, orderType model.OrderType) ([]model.Event, error) {
+	return w.SubmitModify(modify, orderType).Wait()
+}
+
+func (w *Worker) Initialize() {
+	w.SubmitQuery(func(engine OrderBookEngine) { engine.Initialize() }).Wait()
+}
+
+func (w *Worker) OrderSize() int {
+	return query(w, func(engine OrderBookEngine) int { return engine.OrderSize() })
+}
+
+func (w *Worker) GetTopOfBook() *model.TopOfBook {
+	return query(w, func(engine OrderBookEngine) *model.TopOfBook { return engine.GetTopOfBook() })
+}
+
+func (w *Worker) GetOrderInfos() *model.MarketDepth {
+	return query(w, func(engine OrderBookEngine) *model.MarketDepth { return engine.GetOrderInfos() })
+}
+
+func (w *Worker) GetOrder(orderID model.OrderId) (model.Order, bool) {
+	var order model.Order
+	var ok bool
+	w.SubmitQuery(func(engine OrderBookEngine) {
+		order, ok = engine.GetOrder(orderID)
+	}).Wait()
+	return order, ok
+}
+
+func (w *Worker) RegisterCancelHandler(handler CancelHandler) {
+	w.SubmitQuery(func(engine OrderBookEngine) { engine.RegisterCancelHandler(handler) }).Wait()
+}
+
+func (w *Worker) RegisterReduceHandler(handler ReduceHandler) {
+	w.SubmitQuery(func(engine OrderBookEngine) { engine.RegisterReduceHandler(handler) }).Wait()
+}
+
+func (w *Worker) Snapshot() ([]byte, error) {
+	return submit(w, func(engine OrderBookEngine) ([]byte, error) {
+		return engine.Snapshot()
+	}).Wait()
+}
+
+func (w *Worker) Restore(data []byte) error {
+	_, err := submit(w, func(engine OrderBookEngine) (struct{}, error) {
+		return struct{}{}, engine.Restore(data)
+	}).Wait()
+	return err
+}
+
+func (w *Worker) Sequence() uint64 {
+	return query(w, func(engine OrderBookEngine) uint64 { return engine.Sequence() })
+}
+
+func (w *Worker) Replay(entries []JournalEntry) ([]*model.Trade, error) {
+	return submit(w, func(engine OrderBookEngine) ([]*model.Trade, error) {
+		return engine.Replay(entries)
+	}).Wait()
+}
+
+func (w *Worker) RestoreOrder(order model.Order) error {
+	_, err := submit(w, func(engine OrderBookEngine) (struct{}, error) {
+		return struct{}{}, engine.RestoreOrder(order)
+	}).Wait()
+	return err
+}
+
+func (w *Worker) SetTradingPhase(phase model.TradingPhase) ([]model.Event, error) {
+	return submit(w, func(engine OrderBookEngine) ([]model.Event, error) {
+		return engine.SetTradingPhase(phase)
+	}).Wait()
+}
+
+func (w *Worker) GetTradingPhase() model.TradingPhase {
+	return query(w, func(engine OrderBookEngine) model.TradingPhase { return engine.GetTradingPhase() })
+}
+
+func (w *Worker) SetTickerStatus(status model.TickerStatus) ([]model.Event, error) {
+	return submit(w, func(engine OrderBookEngine) ([]model.Event, error) {
+		return engine.SetTickerStatus(status)
+	}).Wait()
+}
+
+func (w *Worker) GetTickerState() model.TickerState {
+	return query(w, func(engine OrderBookEngine) model.TickerState { return engine.GetTickerState() })
+}
+
+func (w *Worker) GetAuctionIndication() *model.AuctionIndication {
+	return query(w, func(engine OrderBookEngine) *model.AuctionIndication { return engine.GetAuctionIndication() })
+}
+
+func (w *Worker) GetHalt() *model.Halt {
+	return query(w, func(engine OrderBookEngine) *model.Halt { return engine.GetHalt() })
+}
+
+func (w *Worker) RegisterHaltHandler(handler HaltHandler) {
+	w.SubmitQuery(func(engine OrderBookEngine) { engine.RegisterHaltHandler(handler) }).Wait()
+}
+
+func (w *Worker) GetOrderBookL3(side model.Side, offset, limit int) *model.OrderBookL3 {
+	return query(w, func(engine OrderBookEngine) *model.OrderBookL3 { return engine.GetOrderBookL3(side, offset, limit) })
+}
+
+func (w *Worker) GetMarketDepth(levels int, bucket model.Price) *model.MarketDepth {
+	return query(w, func(engine OrderBookEngine) *model.MarketDepth { return engine.GetMarketDepth(levels, bucket) })
+}
+
+func (w *Worker) RegisterEventHandler(handler EventHandler) {
+	w.SubmitQuery(func(engine OrderBookEngine) { engine.RegisterEventHandler(handler) }).Wait()
+}
+
+func (w *Worker) EventSequence() uint64 {
+	return query(w, func(engine OrderBookEngine) uint64 { return engine.EventSequence() })
+}
+
+func (w *Worker) CheckInvariants() error {
+	return query(w, func(engine OrderBookEngine) error { return engine.CheckInvariants() })
+}
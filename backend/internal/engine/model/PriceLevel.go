@@ -5,11 +5,52 @@ import (
 	"github.com/google/btree"
 )
 
+// PriceLevel holds the orders resting at one price, queued in time priority. Every order
+// in it keeps a handle back to the level, so removing one never searches the queue.
+type PriceLevel struct {
+	Price        model.Price
+	Orders       model.OrderQueue
+	TotalVolume  model.Quantity
+	HiddenVolume model.Quantity // iceberg reserve included in TotalVolume but not displayed
+}
+
+// Append queues order at the back of the level.
+func (pl *PriceLevel) Append(order *model.Order) {
+	pl.Orders.PushBack(order)
+	order.SetLevel(pl)
+	pl.TotalVolume += order.GetRemainingQuantity()
+	pl.HiddenVolume += order.GetHiddenQuantity()
+}
+
+// Remove takes order out of the level in O(1) and reports whether it was there.
+func (pl *PriceLevel) Remove(order *model.Order) bool {
+	if !pl.Orders.Remove(order) {
+		return false
+	}
+	order.SetLevel(nil)
+	pl.TotalVolume -= order.GetRemainingQuantity()
+	pl.HiddenVolume -= order.GetHiddenQuantity()
+	return true
+}
+
+// DisplayedVolume is the volume shown to the market, icebergs count only their current slice
+func (pl *PriceLevel) DisplayedVolume() model.Quantity {
+	return pl.TotalVolume - pl.HiddenVolume
+}
+
+// LevelOf returns the level order rests in, nil when it is not on the book.
+func LevelOf(order *model.Order) *PriceLevel {
+	level, _ := order.GetLevel().(*PriceLevel)
+	return level
+}
+
 // AskPriceLevel ascending
 type AskPriceLevel struct {
-	Price       model.Price
-	Orders      []*model.Order
-	TotalVolume model.Quantity
+	PriceLevel
+}
+
+func NewAskPriceLevel(price model.Price) *AskPriceLevel {
+	return &AskPriceLevel{PriceLevel{Price: price}}
 }
 
 func (pl *AskPriceLevel) Less(than btree.Item) bool {
@@ -17,40 +58,16 @@ func (pl *AskPriceLevel) Less(than btree.Item) bool {
 	return pl.Price < other.Price
 }
 
-// Fast order removal with index tracking
-func (pl *AskPriceLevel) RemoveOrderByID(orderID model.OrderId) bool {
-	for i, order := range pl.Orders {
-		if order.GetId() == orderID {
-			// Remove from slice
-			pl.Orders = append(pl.Orders[:i], pl.Orders[i+1:]...)
-			pl.TotalVolume -= order.GetInitialQuantity()
-			return true
-		}
-	}
-	return false
-}
-
 // BidPriceLevel descending
 type BidPriceLevel struct {
-	Price       model.Price
-	Orders      []*model.Order
-	TotalVolume model.Quantity
+	PriceLevel
+}
+
+func NewBidPriceLevel(price model.Price) *BidPriceLevel {
+	return &BidPriceLevel{PriceLevel{Price: price}}
 }
 
 func (bpl *BidPriceLevel) Less(than btree.Item) bool {
 	other := than.(*BidPriceLevel)
 	return bpl.Price > other.Price // Reverse
 }
-
-// Fast order removal with index tracking
-func (pl *BidPriceLevel) RemoveOrderByID(orderID model.OrderId) bool {
-	for i, order := range pl.Orders {
-		if order.GetId() == orderID {
-			// Remove from slice
-			pl.Orders = append(pl.Orders[:i], pl.Orders[i+1:]...)
-			pl.TotalVolume -= order.GetInitialQuantity()
-			return true
-		}
-	}
-	return false
-}
@@ -0,0 +1,71 @@
+package model
+
+import (
+	"github.com/Yusufzhafir/go-orderbook/backend/pkg/model"
+	"github.com/google/btree"
+)
+
+// StopLevel holds the stops waiting on one stop price, queued in time priority. Like a price
+// level, every order in it keeps a handle back to the level, so removing one never searches.
+type StopLevel struct {
+	StopPrice model.Price
+	Orders    model.OrderQueue
+}
+
+// Append queues order at the back of the level.
+func (sl *StopLevel) Append(order *model.Order) {
+	sl.Orders.PushBack(order)
+	order.SetLevel(sl)
+}
+
+// Remove takes order out of the level in O(1) and reports whether it was there.
+func (sl *StopLevel) Remove(order *model.Order) bool {
+	if !sl.Orders.Remove(order) {
+		return false
+	}
+	order.SetLevel(nil)
+	return true
+}
+
+// Drain empties the level and returns its orders in time priority.
+func (sl *StopLevel) Drain() []*model.Order {
+	orders := sl.Orders.Orders()
+	for _, order := range orders {
+		sl.Remove(order)
+	}
+	return orders
+}
+
+// StopLevelOf returns the stop level order waits in, nil when it is not waiting.
+func StopLevelOf(order *model.Order) *StopLevel {
+	level, _ := order.GetLevel().(*StopLevel)
+	return level
+}
+
+// BuyStopLevel ascending, the lowest stop price triggers first as prices rise
+type BuyStopLevel struct {
+	StopLevel
+}
+
+func NewBuyStopLevel(stopPrice model.Price) *BuyStopLevel {
+	return &BuyStopLevel{StopLevel{StopPrice: stopPrice}}
+}
+
+func (sl *BuyStopLevel) Less(than btree.Item) bool {
+	other := than.(*BuyStopLevel)
+	return sl.StopPrice < other.StopPrice
+}
+
+// SellStopLevel descending, the highest stop price triggers first as prices fall
+type SellStopLevel struct {
+	StopLevel
+}
+
+func NewSellStopLevel(stopPrice model.Price) *SellStopLevel {
+	return &SellStopLevel{StopLevel{StopPrice: stopPrice}}
+}
+
+func (sl *SellStopLevel) Less(than btree.Item) bool {
+	other := than.(*SellStopLevel)
+	return sl.StopPrice > other.StopPrice // Reverse
+}
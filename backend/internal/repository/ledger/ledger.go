@@ -2,6 +2,7 @@ package ledger
 
 import (
 	"context"
+	"fmt"
 	"math/big"
 	"time"
 
@@ -13,6 +14,18 @@ type Ticker struct {
 	Ticker          string    `db:"ticker"`
 	TBLedgerID      int64     `db:"tb_ledger_id"`
 	EscrowAccountID string    `db:"escrow_account_id"`
+	MatchingPolicy  string    `db:"matching_policy"` // engine.MatchingPolicyByName name
+	StaticBandBps   uint32    `db:"static_band_bps"` // price bands and circuit breaker, see engine.PriceBands
+	DynamicBandBps  uint32    `db:"dynamic_band_bps"`
+	BreakerBps      uint32    `db:"breaker_bps"`
+	BreakerWindowMs int64     `db:"breaker_window_ms"`
+	HaltMs          int64     `db:"halt_ms"`
+	TickSize        uint64    `db:"tick_size"` // instrument rules, see model.InstrumentRules
+	LotSize         uint64    `db:"lot_size"`
+	MinQuantity     uint64    `db:"min_quantity"`
+	MaxQuantity     uint64    `db:"max_quantity"`
+	MinNotional     uint64    `db:"min_notional"`
+	TradingStatus   string    `db:"trading_status"` // model.TickerStatusByName name
 	CreatedAt       time.Time `db:"created_at"`
 }
 
@@ -34,6 +47,7 @@ type LedgerRepository interface {
 	GetLedgerByTicker(ctx context.Context, tx *sqlx.Tx, ticker string) (*Ticker, error)
 	ListLedgers(ctx context.Context, tx *sqlx.Tx) ([]Ticker, error)
 	UpdateEscrowAccount(ctx context.Context, tx *sqlx.Tx, ledgerID int64, escrowAccountID int64) error
+	UpdateTradingStatus(ctx context.Context, tx *sqlx.Tx, ticker string, status string) error
 
 	// UserLedger
 	CreateUserLedger(ctx context.Context, tx *sqlx.Tx, userID int64, ledgerID int64, ledgerTbID int64, tbAccountID *big.Int, isEscrow bool) (int64, error)
@@ -69,7 +83,9 @@ func (r *ledgerRepositoryImpl) CreateLedger(ctx context.Context, tx *sqlx.Tx, ti
 func (r *ledgerRepositoryImpl) GetLedgerByID(ctx context.Context, tx *sqlx.Tx, id int64) (*Ticker, error) {
 	var t Ticker
 	err := tx.GetContext(ctx, &t,
-		`SELECT id, ticker, tb_ledger_id, escrow_account_id, created_at FROM ticker WHERE id=$1`, id)
+		`SELECT id, ticker, tb_ledger_id, escrow_account_id, matching_policy,
+		static_band_bps, dynamic_band_bps, breaker_bps, breaker_window_ms, halt_ms,
+		tick_size, lot_size, min_quantity, max_quantity, min_notional, trading_status, created_at FROM ticker WHERE id=$1`, id)
 	if err != nil {
 		return nil, err
 	}
@@ -79,7 +95,9 @@ func (r *ledgerRepositoryImpl) GetLedgerByID(ctx context.Context, tx *sqlx.Tx, i
 func (r *ledgerRepositoryImpl) GetLedgerByTicker(ctx context.Context, tx *sqlx.Tx, ticker string) (*Ticker, error) {
 	var t Ticker
 	err := tx.GetContext(ctx, &t,
-		`SELECT id, ticker, tb_ledger_id, escrow_account_id, created_at FROM ticker WHERE ticker=$1`, ticker)
+		`SELECT id, ticker, tb_ledger_id, escrow_account_id, matching_policy,
+		static_band_bps, dynamic_band_bps, breaker_bps, breaker_window_ms, halt_ms,
+		tick_size, lot_size, min_quantity, max_quantity, min_notional, trading_status, created_at FROM ticker WHERE ticker=$1`, ticker)
 	if err != nil {
 		return nil, err
 	}
@@ -89,7 +107,9 @@ func (r *ledgerRepositoryImpl) GetLedgerByTicker(ctx context.Context, tx *sqlx.T
 func (r *ledgerRepositoryImpl) ListLedgers(ctx context.Context, tx *sqlx.Tx) ([]Ticker, error) {
 	var list []Ticker
 	err := tx.SelectContext(ctx, &list,
-		`SELECT id, ticker, tb_ledger_id, escrow_account_id, created_at FROM ticker ORDER BY id`)
+		`SELECT id, ticker, tb_ledger_id, escrow_account_id, matching_policy,
+		static_band_bps, dynamic_band_bps, breaker_bps, breaker_window_ms, halt_ms,
+		tick_size, lot_size, min_quantity, max_quantity, min_notional, trading_status, created_at FROM ticker ORDER BY id`)
 	return list, err
 }
 
@@ -99,6 +119,18 @@ func (r *ledgerRepositoryImpl) UpdateEscrowAccount(ctx context.Context, tx *sqlx
 	return err
 }
 
+func (r *ledgerRepositoryImpl) UpdateTradingStatus(ctx context.Context, tx *sqlx.Tx, ticker string, status string) error {
+	result, err := tx.ExecContext(ctx,
+		`UPDATE ticker SET trading_status=$1 WHERE ticker=$2`, status, ticker)
+	if err != nil {
+		return err
+	}
+	if updated, err := result.RowsAffected(); err == nil && updated == 0 {
+		return fmt.Errorf("ticker %s not found", ticker)
+	}
+	return nil
+}
+
 // UserLedger
 
 func (r *ledgerRepositoryImpl) CreateUserLedger(ctx context.Context, tx *sqlx.Tx, userID int64, ledgerID int64, ledgerTbID int64, tbAccountID *big.Int, isEscrow bool) (int64, error) {
@@ -7,23 +7,30 @@ import (
 	"strings"
 	"time"
 
+	"github.com/Yusufzhafir/go-orderbook/backend/pkg/model"
 	"github.com/jmoiron/sqlx"
 )
 
 // --- Models corresponding to DB tables ---
 type OrderRecord struct {
-	ID             uint64  `db:"id"`
-	UserID         int64   `db:"user_id"`
-	TickerID       int64   `db:"ticker_id"`
-	Side           int8    `db:"side"`
-	TickerLedgerID int64   `db:"ticker_ledger_id"`
-	Type           uint8   `db:"type"`
-	Quantity       uint64  `db:"quantity"`
-	Filled         uint64  `db:"filled"`
-	Price          uint64  `db:"price"`
-	IsActive       bool    `db:"is_active"`
-	CreatedAt      string  `db:"created_at"`
-	ClosedAt       *string `db:"closed_at"`
+	ID             uint64     `db:"id"`
+	UserID         int64      `db:"user_id"`
+	TickerID       int64      `db:"ticker_id"`
+	Side           int8       `db:"side"`
+	TickerLedgerID int64      `db:"ticker_ledger_id"`
+	Type           uint8      `db:"type"`
+	Quantity       uint64     `db:"quantity"`
+	Filled         uint64     `db:"filled"`
+	Price          uint64     `db:"price"`
+	StopPrice      uint64     `db:"stop_price"`   // stop orders only
+	MaxNotional    uint64     `db:"max_notional"` // market buys only: cash reserved in escrow
+	PeakSize       uint64     `db:"peak_size"`    // icebergs only: displayed slice size
+	Triggered      bool       `db:"triggered"`    // stop orders only: a trade released it from the trigger book
+	IsActive       bool       `db:"is_active"`
+	Status         string     `db:"status"`
+	ExpiresAt      *time.Time `db:"expires_at"` // good-till-date and day orders only
+	CreatedAt      string     `db:"created_at"`
+	ClosedAt       *string    `db:"closed_at"`
 }
 
 func (rec *OrderRecord) GetRemaining() uint64 {
@@ -31,7 +38,7 @@ func (rec *OrderRecord) GetRemaining() uint64 {
 }
 
 type TradeRecord struct {
-	ID               int64    `db:"id"`
+	ID               uint64   `db:"id"` // the engine's trade ID
 	TickerID         int64    `db:"ticker_id"`
 	OrderTakerID     uint64   `db:"order_taker_id"`
 	OrderMakerID     uint64   `db:"order_maker_id"`
@@ -44,17 +51,40 @@ type TradeRecord struct {
 	TradedAt         string   `db:"traded_at"`
 }
 
+// EventRecord is one engine event. Trades carry the taker in OrderID and the maker in MakerOrderID.
+type EventRecord struct {
+	ID           int64     `db:"id"`
+	Ticker       string    `db:"ticker"`
+	Sequence     uint64    `db:"seq"`
+	Type         uint8     `db:"type"`
+	OrderID      uint64    `db:"order_id"`
+	MakerOrderID uint64    `db:"maker_order_id"`
+	Side         int8      `db:"side"`
+	Price        uint64    `db:"price"`
+	Quantity     uint64    `db:"quantity"`
+	Remaining    uint64    `db:"remaining"`
+	Reason       string    `db:"reason"`
+	OccurredAt   time.Time `db:"occurred_at"`
+}
+
 // --- Repository Interface ---
 type OrderRepository interface {
 	CreateOrder(ctx context.Context, tx *sqlx.Tx, order OrderRecord) error
 	UpdateOrder(ctx context.Context, tx *sqlx.Tx, order OrderRecord) error
-	CloseOrder(ctx context.Context, tx *sqlx.Tx, orderID uint64, closedAt time.Time) error
-	CloseOrders(ctx context.Context, tx *sqlx.Tx, orderID []uint64, closedAt time.Time) error
-	UpdateFilled(ctx context.Context, tx *sqlx.Tx, orderID uint64, filled uint64) error
+	AmendOrder(ctx context.Context, tx *sqlx.Tx, orderID uint64, price uint64, quantity uint64) error
+	CloseOrder(ctx context.Context, tx *sqlx.Tx, orderID uint64, closedAt time.Time, status model.OrderStatus) error
+	CloseOrders(ctx context.Context, tx *sqlx.Tx, orderID []uint64, closedAt time.Time, status model.OrderStatus) error
+	ListExpiredOrders(ctx context.Context, tx *sqlx.Tx, now time.Time) ([]OrderRecord, error)
+	UpdateFilled(ctx context.Context, tx *sqlx.Tx, orderID uint64, quantity uint64) error
+	ReduceOrder(ctx context.Context, tx *sqlx.Tx, orderID uint64, quantity uint64) error
+	CloseFilledOrders(ctx context.Context, tx *sqlx.Tx, orderIDs []uint64, closedAt time.Time) error
+	MarkTriggered(ctx context.Context, tx *sqlx.Tx, orderIDs []uint64) error
 	GetOrderByID(ctx context.Context, tx *sqlx.Tx, orderID uint64) (*OrderRecord, error)
 	ListOrdersByUser(ctx context.Context, tx *sqlx.Tx, userID int64, onlyActive bool) ([]OrderRecordWithTicker, error)
+	ListActiveOrders(ctx context.Context, tx *sqlx.Tx) ([]OrderRecordWithTicker, error)
 	CreateTrade(ctx context.Context, tx *sqlx.Tx, trade TradeRecord) error
 	CreateTrades(ctx context.Context, tx *sqlx.Tx, trade []TradeRecord) error
+	CreateEvents(ctx context.Context, tx *sqlx.Tx, events []EventRecord) error
 }
 
 // --- Implementation ---
@@ -66,9 +96,9 @@ func NewOrderRepository(db *sqlx.DB) OrderRepository {
 
 func (r *orderRepositoryImpl) CreateOrder(ctx context.Context, tx *sqlx.Tx, order OrderRecord) error {
 	_, err := tx.ExecContext(ctx,
-		`INSERT INTO orders (id, user_id, ticker_id, side, ticker_ledger_id, type, quantity,filled, price, is_active)
-         VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10)`,
-		order.ID, order.UserID, order.TickerID, order.Side, order.TickerLedgerID, order.Type, order.Quantity, order.Filled, order.Price, order.IsActive)
+		`INSERT INTO orders (id, user_id, ticker_id, side, ticker_ledger_id, type, quantity,filled, price, stop_price, max_notional, peak_size, is_active, expires_at)
+         VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14)`,
+		order.ID, order.UserID, order.TickerID, order.Side, order.TickerLedgerID, order.Type, order.Quantity, order.Filled, order.Price, order.StopPrice, order.MaxNotional, order.PeakSize, order.IsActive, order.ExpiresAt)
 	return err
 }
 
@@ -79,22 +109,42 @@ func (r *orderRepositoryImpl) UpdateOrder(ctx context.Context, tx *sqlx.Tx, orde
 		order.Price, order.Quantity, order.Type, order.Side, order.TickerLedgerID, order.Filled, order.ID)
 	return err
 }
-func (r *orderRepositoryImpl) UpdateFilled(ctx context.Context, tx *sqlx.Tx, orderID uint64, filled uint64) error {
+
+// AmendOrder sets the price and total quantity of an amended order, what it filled stays.
+func (r *orderRepositoryImpl) AmendOrder(ctx context.Context, tx *sqlx.Tx, orderID uint64, price uint64, quantity uint64) error {
+	_, err := tx.ExecContext(ctx,
+		`UPDATE orders SET price=$1, quantity=$2
+         WHERE id=$3`,
+		price, quantity, orderID)
+	return err
+}
+
+// UpdateFilled adds quantity to what the order has filled so far.
+func (r *orderRepositoryImpl) UpdateFilled(ctx context.Context, tx *sqlx.Tx, orderID uint64, quantity uint64) error {
+	_, err := tx.ExecContext(ctx,
+		`UPDATE orders SET filled=filled+$1
+         WHERE id=$2`,
+		quantity, orderID)
+	return err
+}
+
+// ReduceOrder takes quantity off the size of the order, leaving what it filled as it is.
+func (r *orderRepositoryImpl) ReduceOrder(ctx context.Context, tx *sqlx.Tx, orderID uint64, quantity uint64) error {
 	_, err := tx.ExecContext(ctx,
-		`UPDATE orders SET filled=$1
+		`UPDATE orders SET quantity=quantity-$1
          WHERE id=$2`,
-		filled, orderID)
+		quantity, orderID)
 	return err
 }
 
-func (r *orderRepositoryImpl) CloseOrder(ctx context.Context, tx *sqlx.Tx, orderID uint64, closedAt time.Time) error {
+func (r *orderRepositoryImpl) CloseOrder(ctx context.Context, tx *sqlx.Tx, orderID uint64, closedAt time.Time, status model.OrderStatus) error {
 	_, err := tx.ExecContext(ctx,
-		`UPDATE orders SET is_active=false, closed_at=$1 WHERE id=$2`,
-		closedAt, orderID)
+		`UPDATE orders SET is_active=false, closed_at=$1, status=$2 WHERE id=$3`,
+		closedAt, status, orderID)
 	return err
 }
 
-func (r *orderRepositoryImpl) CloseOrders(ctx context.Context, tx *sqlx.Tx, orderIDs []uint64, closedAt time.Time) error {
+func (r *orderRepositoryImpl) CloseOrders(ctx context.Context, tx *sqlx.Tx, orderIDs []uint64, closedAt time.Time, status model.OrderStatus) error {
 	if tx == nil {
 		return fmt.Errorf("nil transaction passed to CloseOrders")
 	}
@@ -105,10 +155,10 @@ func (r *orderRepositoryImpl) CloseOrders(ctx context.Context, tx *sqlx.Tx, orde
 	// Build: UPDATE ... WHERE id IN (...)
 	q, args, err := sqlx.In(`
 		UPDATE orders
-		SET is_active = FALSE, closed_at = ?
+		SET is_active = FALSE, closed_at = ?, status = ?
 		WHERE id IN (?)
 		  AND is_active = TRUE
-	`, closedAt, orderIDs)
+	`, closedAt, status, orderIDs)
 	if err != nil {
 		return err
 	}
@@ -118,10 +168,44 @@ func (r *orderRepositoryImpl) CloseOrders(ctx context.Context, tx *sqlx.Tx, orde
 	return err
 }
 
+// CloseFilledOrders closes as filled those of orderIDs that are still active and have filled
+// their whole quantity. The check runs on the rows as they are, so a fill and a reduction
+// written by different transactions still close the order whichever commits last.
+func (r *orderRepositoryImpl) CloseFilledOrders(ctx context.Context, tx *sqlx.Tx, orderIDs []uint64, closedAt time.Time) error {
+	if len(orderIDs) == 0 {
+		return nil
+	}
+	q, args, err := sqlx.In(`
+		UPDATE orders
+		SET is_active = FALSE, closed_at = ?, status = ?
+		WHERE id IN (?)
+		  AND is_active = TRUE
+		  AND filled >= quantity
+	`, closedAt, model.ORDER_STATUS_FILLED, orderIDs)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, tx.Rebind(q), args...)
+	return err
+}
+
+// MarkTriggered records that the stop orders of orderIDs left the trigger book.
+func (r *orderRepositoryImpl) MarkTriggered(ctx context.Context, tx *sqlx.Tx, orderIDs []uint64) error {
+	if len(orderIDs) == 0 {
+		return nil
+	}
+	q, args, err := sqlx.In(`UPDATE orders SET triggered = TRUE WHERE id IN (?)`, orderIDs)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, tx.Rebind(q), args...)
+	return err
+}
+
 func (r *orderRepositoryImpl) GetOrderByID(ctx context.Context, tx *sqlx.Tx, orderID uint64) (*OrderRecord, error) {
 	var ord OrderRecord
 	err := tx.GetContext(ctx, &ord,
-		`SELECT id, user_id, ticker_id, side, ticker_ledger_id, type, quantity,filled, price, is_active, created_at, closed_at
+		`SELECT id, user_id, ticker_id, side, ticker_ledger_id, type, quantity,filled, price, stop_price, max_notional, peak_size, triggered, is_active, status, expires_at, created_at, closed_at
          FROM orders WHERE id=$1 LIMIT 1`,
 		orderID)
 	if err != nil {
@@ -130,20 +214,35 @@ func (r *orderRepositoryImpl) GetOrderByID(ctx context.Context, tx *sqlx.Tx, ord
 	return &ord, nil
 }
 
+func (r *orderRepositoryImpl) ListExpiredOrders(ctx context.Context, tx *sqlx.Tx, now time.Time) ([]OrderRecord, error) {
+	var orders []OrderRecord
+	err := tx.SelectContext(ctx, &orders,
+		`SELECT id, user_id, ticker_id, side, ticker_ledger_id, type, quantity,filled, price, stop_price, max_notional, peak_size, triggered, is_active, status, expires_at, created_at, closed_at
+         FROM orders WHERE is_active=true AND expires_at IS NOT NULL AND expires_at<=$1 ORDER BY expires_at, id`,
+		now)
+	return orders, err
+}
+
 type OrderRecordWithTicker struct {
-	ID             uint64  `db:"id"`
-	UserID         int64   `db:"user_id"`
-	Ticker         string  `db:"ticker"`
-	TickerID       int64   `db:"ticker_id"`
-	Side           int8    `db:"side"`
-	TickerLedgerID int64   `db:"ticker_ledger_id"`
-	Type           uint8   `db:"type"`
-	Quantity       uint64  `db:"quantity"`
-	Filled         uint64  `db:"filled"`
-	Price          uint64  `db:"price"`
-	IsActive       bool    `db:"is_active"`
-	CreatedAt      string  `db:"created_at"`
-	ClosedAt       *string `db:"closed_at"`
+	ID             uint64     `db:"id"`
+	UserID         int64      `db:"user_id"`
+	Ticker         string     `db:"ticker"`
+	TickerID       int64      `db:"ticker_id"`
+	Side           int8       `db:"side"`
+	TickerLedgerID int64      `db:"ticker_ledger_id"`
+	Type           uint8      `db:"type"`
+	Quantity       uint64     `db:"quantity"`
+	Filled         uint64     `db:"filled"`
+	Price          uint64     `db:"price"`
+	StopPrice      uint64     `db:"stop_price"`
+	MaxNotional    uint64     `db:"max_notional"`
+	PeakSize       uint64     `db:"peak_size"`
+	Triggered      bool       `db:"triggered"`
+	IsActive       bool       `db:"is_active"`
+	Status         string     `db:"status"`
+	ExpiresAt      *time.Time `db:"expires_at"`
+	CreatedAt      string     `db:"created_at"`
+	ClosedAt       *string    `db:"closed_at"`
 }
 
 func (r *orderRepositoryImpl) ListOrdersByUser(ctx context.Context, tx *sqlx.Tx, userID int64, onlyActive bool) ([]OrderRecordWithTicker, error) {
@@ -151,22 +250,31 @@ func (r *orderRepositoryImpl) ListOrdersByUser(ctx context.Context, tx *sqlx.Tx,
 	var err error
 	if onlyActive {
 		err = tx.SelectContext(ctx, &orders,
-			`SELECT o.id, user_id, ticker_id,side, t.ticker as ticker,ticker_ledger_id, type, quantity,filled, price, is_active, o.created_at, closed_at
+			`SELECT o.id, user_id, ticker_id,side, t.ticker as ticker,ticker_ledger_id, type, quantity,filled, price, stop_price, is_active, status, expires_at, o.created_at, closed_at
              FROM orders o LEFT JOIN ticker t ON o.ticker_id=t.id WHERE user_id=$1 AND is_active=true ORDER BY created_at DESC`, userID)
 	} else {
 		err = tx.SelectContext(ctx, &orders,
-			`SELECT id, user_id, ticker_id, side, t.ticker as ticker, ticker_ledger_id, type, quantity,filled, price, is_active, created_at, closed_at
+			`SELECT o.id, user_id, ticker_id, side, t.ticker as ticker, ticker_ledger_id, type, quantity,filled, price, stop_price, is_active, status, expires_at, o.created_at, closed_at
              FROM orders o LEFT JOIN ticker t ON o.ticker_id=t.id  WHERE user_id=$1 ORDER BY created_at DESC`, userID)
 	}
 	return orders, err
 }
 
+// ListActiveOrders returns every open order of every ticker in the order they were placed.
+func (r *orderRepositoryImpl) ListActiveOrders(ctx context.Context, tx *sqlx.Tx) ([]OrderRecordWithTicker, error) {
+	var orders []OrderRecordWithTicker
+	err := tx.SelectContext(ctx, &orders,
+		`SELECT o.id, user_id, ticker_id, side, t.ticker as ticker, ticker_ledger_id, type, quantity, filled, price, stop_price, max_notional, peak_size, triggered, is_active, status, expires_at, o.created_at, closed_at
+         FROM orders o JOIN ticker t ON o.ticker_id=t.id WHERE is_active=true ORDER BY o.created_at, o.id`)
+	return orders, err
+}
+
 func (r *orderRepositoryImpl) CreateTrade(ctx context.Context, tx *sqlx.Tx, trade TradeRecord) error {
 	_, err := tx.ExecContext(ctx,
-		`INSERT INTO trades (ticker_id, order_taker_id, order_maker_id, ledger_transfer_id,
+		`INSERT INTO trades (id, ticker_id, order_taker_id, order_maker_id, ledger_transfer_id,
                               user_ledger_id, ticker_ledger_id, type, quantity, price, traded_at)
-         VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9, NOW())`,
-		trade.TickerID, trade.OrderTakerID, trade.OrderMakerID,
+         VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10, NOW())`,
+		trade.ID, trade.TickerID, trade.OrderTakerID, trade.OrderMakerID,
 		trade.LedgerTransferID.String(),
 		trade.UserLedgerID, trade.TickerLedgerID,
 		trade.Type, trade.Quantity, trade.Price)
@@ -180,12 +288,12 @@ func (r *orderRepositoryImpl) CreateTrades(ctx context.Context, tx *sqlx.Tx, tra
 
 	var (
 		sb    strings.Builder
-		args  = make([]interface{}, 0, len(trades)*9) // 9 bind args per row (traded_at uses NOW())
+		args  = make([]interface{}, 0, len(trades)*10) // 10 bind args per row (traded_at uses NOW())
 		count = 0
 	)
 
 	sb.WriteString(`INSERT INTO trades (
-		ticker_id, order_taker_id, order_maker_id, ledger_transfer_id,
+		id, ticker_id, order_taker_id, order_maker_id, ledger_transfer_id,
 		user_ledger_id, ticker_ledger_id, type, quantity, price, traded_at
 	) VALUES `)
 
@@ -194,11 +302,11 @@ func (r *orderRepositoryImpl) CreateTrades(ctx context.Context, tx *sqlx.Tx, tra
 			sb.WriteString(",")
 		}
 		// Placeholders for this row
-		// ($1,$2,$3,$4,$5,$6,$7,$8,$9,NOW())
-		sb.WriteString(fmt.Sprintf("($%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d,NOW())",
-			count+1, count+2, count+3, count+4, count+5, count+6, count+7, count+8, count+9,
+		// ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,NOW())
+		sb.WriteString(fmt.Sprintf("($%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d,NOW())",
+			count+1, count+2, count+3, count+4, count+5, count+6, count+7, count+8, count+9, count+10,
 		))
-		count += 9
+		count += 10
 
 		ltid := "0"
 		if t.LedgerTransferID != nil {
@@ -206,6 +314,7 @@ func (r *orderRepositoryImpl) CreateTrades(ctx context.Context, tx *sqlx.Tx, tra
 		}
 
 		args = append(args,
+			t.ID,
 			t.TickerID,
 			t.OrderTakerID,
 			t.OrderMakerID,
@@ -221,3 +330,43 @@ func (r *orderRepositoryImpl) CreateTrades(ctx context.Context, tx *sqlx.Tx, tra
 	_, err := tx.ExecContext(ctx, sb.String(), args...)
 	return err
 }
+
+func (r *orderRepositoryImpl) CreateEvents(ctx context.Context, tx *sqlx.Tx, events []EventRecord) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	var (
+		sb    strings.Builder
+		args  = make([]interface{}, 0, len(events)*11)
+		count = 0
+	)
+	sb.WriteString(`INSERT INTO engine_events (
+		ticker, seq, type, order_id, maker_order_id, side, price, quantity, remaining, reason, occurred_at
+	) VALUES `)
+	for i, e := range events {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+		sb.WriteString(fmt.Sprintf("($%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d)",
+			count+1, count+2, count+3, count+4, count+5, count+6, count+7, count+8, count+9, count+10, count+11,
+		))
+		count += 11
+		args = append(args,
+			e.Ticker,
+			e.Sequence,
+			e.Type,
+			e.OrderID,
+			e.MakerOrderID,
+			e.Side,
+			e.Price,
+			e.Quantity,
+			e.Remaining,
+			e.Reason,
+			e.OccurredAt,
+		)
+	}
+
+	_, err := tx.ExecContext(ctx, sb.String(), args...)
+	return err
+}
@@ -13,6 +13,7 @@ type User struct {
 	ID           int64     `db:"id"`
 	Username     string    `db:"username"`
 	PasswordHash string    `db:"password_hash"`
+	STPMode      uint8     `db:"stp_mode"` // account default for model.SelfTradePrevention
 	CreatedAt    time.Time `db:"created_at"`
 }
 
@@ -21,6 +22,7 @@ type UserRepository interface {
 	GetByID(ctx context.Context, id int64) (*User, error)
 	GetByUsername(ctx context.Context, username string) (*User, error)
 	VerifyPassword(ctx context.Context, username, password string) (*User, error)
+	UpdateSTPMode(ctx context.Context, id int64, mode uint8) error
 }
 
 type userRepositoryImpl struct {
@@ -47,7 +49,7 @@ func (r *userRepositoryImpl) Create(ctx context.Context, tx *sqlx.Tx, username,
 func (r *userRepositoryImpl) GetByID(ctx context.Context, id int64) (*User, error) {
 	u := &User{}
 	err := r.db.GetContext(ctx, u,
-		`SELECT id, username, password_hash, created_at FROM users WHERE id=$1`, id)
+		`SELECT id, username, password_hash, stp_mode, created_at FROM users WHERE id=$1`, id)
 	if err != nil {
 		return nil, err
 	}
@@ -57,7 +59,7 @@ func (r *userRepositoryImpl) GetByID(ctx context.Context, id int64) (*User, erro
 func (r *userRepositoryImpl) GetByUsername(ctx context.Context, username string) (*User, error) {
 	u := &User{}
 	err := r.db.GetContext(ctx, u,
-		`SELECT id, username, password_hash, created_at FROM users WHERE username=$1`, username)
+		`SELECT id, username, password_hash, stp_mode, created_at FROM users WHERE username=$1`, username)
 	if err != nil {
 		return nil, err
 	}
@@ -74,3 +76,9 @@ func (r *userRepositoryImpl) VerifyPassword(ctx context.Context, username, passw
 	}
 	return u, nil
 }
+
+func (r *userRepositoryImpl) UpdateSTPMode(ctx context.Context, id int64, mode uint8) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE users SET stp_mode=$1 WHERE id=$2`, mode, id)
+	return err
+}
@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// AdminMiddleware lets through users in adminIDs only. It reads the claims AuthMiddleware
+// puts on the context, so it has to run after it.
+func AdminMiddleware(adminIDs map[int64]struct{}) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := r.Context().Value(AuthKey{}).(*UserClaims)
+			if !ok {
+				http.Error(w, "error verifying token: missing claims", http.StatusUnauthorized)
+				return
+			}
+			if _, ok := adminIDs[claims.UserId]; !ok {
+				http.Error(w, fmt.Sprintf("user %d is not an admin", claims.UserId), http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -3,6 +3,7 @@ package router
 import (
 	"errors"
 	"net/http"
+	"time"
 
 	"github.com/Yusufzhafir/go-orderbook/backend/internal/usecase/order"
 	"github.com/Yusufzhafir/go-orderbook/backend/pkg/model"
@@ -31,12 +32,27 @@ func (or *orderRouterImpl) Add(w http.ResponseWriter, r *http.Request) {
 		Quantity model.Quantity  `json:"quantity"`
 		Type     model.OrderType `json:"type"`
 		Ticker   string          `json:"ticker"`
+		// MaxNotional caps the cash a market buy may spend, it is reserved up front
+		MaxNotional uint64 `json:"maxNotional,omitempty"`
+		// PostOnly 1 rejects and 2 reprices a limit order that would take liquidity
+		PostOnly model.PostOnly `json:"postOnly,omitempty"`
+		// StopPrice is required for stop-market and stop-limit orders
+		StopPrice model.Price `json:"stopPrice,omitempty"`
+		// PeakSize makes a limit order an iceberg that only shows this much at a time
+		PeakSize model.Quantity `json:"peakSize,omitempty"`
+		// ExpiresAt is required for good-till-date orders, RFC 3339
+		ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+		// SelfTradePrevention overrides the account mode for this order, 0 keeps the account mode
+		SelfTradePrevention model.SelfTradePrevention `json:"stpMode,omitempty"`
 	}
 	type AddOrderResponse struct {
-		OrderID model.OrderId  `json:"orderId"`
-		Trades  []*model.Trade `json:"trades,omitempty"`
-		Status  string         `json:"status"` // "accepted", "rejected"
-		Message string         `json:"message,omitempty"`
+		OrderID  model.OrderId  `json:"orderId"`
+		Trades   []*model.Trade `json:"trades,omitempty"`
+		Price    model.Price    `json:"price,omitempty"`
+		Repriced bool           `json:"repriced,omitempty"` // post-only order moved off the opposite best
+		Status   string         `json:"status"`             // "accepted", "rejected"
+		Message  string         `json:"message,omitempty"`
+		Reason   string         `json:"reason,omitempty"` // instrument rule a rejected order breaks, e.g. "TICK_SIZE"
 	}
 	req, err := decodeJSON[AddOrderRequest](w, r)
 	if err != nil {
@@ -53,21 +69,52 @@ func (or *orderRouterImpl) Add(w http.ResponseWriter, r *http.Request) {
 		writeJSONError(w, http.StatusBadRequest, errors.New("ticker must not be empty"))
 		return
 	}
+	if req.Type > model.ORDER_DAY {
+		writeJSONError(w, http.StatusBadRequest, errors.New("unknown order type"))
+		return
+	}
+	if req.PostOnly > model.POST_ONLY_REPRICE {
+		writeJSONError(w, http.StatusBadRequest, errors.New("unknown postOnly"))
+		return
+	}
+	if req.SelfTradePrevention > model.STP_DECREMENT_AND_CANCEL {
+		writeJSONError(w, http.StatusBadRequest, errors.New("unknown stpMode"))
+		return
+	}
+
+	var expiresAt time.Time
+	if req.ExpiresAt != nil {
+		expiresAt = *req.ExpiresAt
+	}
 
 	uc := *or.usecase
-	trades, orderID, err := uc.AddOrder(r.Context(), req.Ticker, req.Side, req.Price, req.Quantity, req.Type)
+	result, err := uc.AddOrder(r.Context(), req.Ticker, req.Side, req.Price, req.Quantity, req.Type, order.AddOrderOpts{
+		MaxNotional:         req.MaxNotional,
+		PostOnly:            req.PostOnly,
+		StopPrice:           req.StopPrice,
+		PeakSize:            req.PeakSize,
+		ExpiresAt:           expiresAt,
+		SelfTradePrevention: req.SelfTradePrevention,
+	})
 	if err != nil {
-		writeJSON(w, http.StatusUnprocessableEntity, AddOrderResponse{
+		response := AddOrderResponse{
 			Status:  "rejected",
 			Message: err.Error(),
-		})
+		}
+		var violation *model.RuleViolation
+		if errors.As(err, &violation) {
+			response.Reason = violation.Rule
+		}
+		writeJSON(w, http.StatusUnprocessableEntity, response)
 		return
 	}
 
 	writeJSON(w, http.StatusOK, AddOrderResponse{
-		OrderID: orderID,
-		Trades:  trades,
-		Status:  "accepted",
+		OrderID:  result.OrderID,
+		Trades:   result.Trades,
+		Price:    result.Price,
+		Repriced: result.Repriced,
+		Status:   "accepted",
 	})
 }
 
@@ -75,7 +122,7 @@ func (or *orderRouterImpl) Modify(w http.ResponseWriter, r *http.Request) {
 	type ModifyOrderRequest struct {
 		ID       model.OrderId   `json:"id"`
 		Price    model.Price     `json:"price,omitempty"`
-		Quantity model.Quantity  `json:"quantity,omitempty"`
+		Quantity model.Quantity  `json:"quantity,omitempty"` // new total quantity, fills included; a cut at the same price keeps queue priority
 		Type     model.OrderType `json:"type,omitempty"`
 		Ticker   string          `json:"ticker"`
 	}
@@ -9,6 +9,7 @@ import (
 	"github.com/Yusufzhafir/go-orderbook/backend/internal/router/middleware"
 	"github.com/Yusufzhafir/go-orderbook/backend/internal/usecase/order"
 	"github.com/Yusufzhafir/go-orderbook/backend/internal/usecase/user"
+	"github.com/Yusufzhafir/go-orderbook/backend/pkg/model"
 )
 
 type statusWriter struct {
@@ -83,12 +84,14 @@ func Cors(next http.Handler) http.Handler {
 	})
 }
 
-func bindTicker(serverRouter *http.ServeMux, orderUsecase *order.OrderUseCase, tokenMaker *middleware.JWTMaker) {
+func bindTicker(serverRouter *http.ServeMux, orderUsecase *order.OrderUseCase, tokenMaker *middleware.JWTMaker, adminUserIDs map[int64]struct{}) {
 	authmiddleware := middleware.AuthMiddleware(tokenMaker)
+	adminmiddleware := middleware.AdminMiddleware(adminUserIDs)
 	serverRouter.Handle("GET /api/v1/ticker", authmiddleware(logging(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		type TickerResponse struct {
-			ID     int64  `json:"id"`
-			Ticker string `json:"ticker"`
+			ID     int64                 `json:"id"`
+			Ticker string                `json:"ticker"`
+			Rules  model.InstrumentRules `json:"rules"`
 		}
 		type TickerListResponse struct {
 			Tickers []TickerResponse `json:"tickers"`
@@ -105,6 +108,7 @@ func bindTicker(serverRouter *http.ServeMux, orderUsecase *order.OrderUseCase, t
 			tickerResponse = append(tickerResponse, TickerResponse{
 				ID:     ticker.ID,
 				Ticker: ticker.Ticker,
+				Rules:  order.InstrumentRules(ticker),
 			})
 		}
 
@@ -121,9 +125,136 @@ func bindTicker(serverRouter *http.ServeMux, orderUsecase *order.OrderUseCase, t
 			writeJSONError(w, http.StatusBadRequest, fmt.Errorf("ticker should not be empty %s", ticker))
 			return
 		}
-		data := uc.GetOrderInfos(r.Context(), ticker)
+		// depth is the number of levels per side, "full" for all of them; bucket groups that many ticks into a level
+		levels := 10
+		if depth := r.URL.Query().Get("depth"); depth == "full" {
+			levels = 0
+		} else if depth != "" {
+			var err error
+			if levels, err = queryInt(r, "depth", 10); err != nil || levels == 0 {
+				writeJSONError(w, http.StatusBadRequest, fmt.Errorf("depth must be a positive integer or full, got %q", depth))
+				return
+			}
+		}
+		bucket, err := queryInt(r, "bucket", 1)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err)
+			return
+		}
+		data, err := uc.GetMarketDepth(r.Context(), ticker, levels, uint64(bucket))
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, fmt.Errorf("error reading market depth: %v", err))
+			return
+		}
 		writeJSON(w, http.StatusOK, data)
 	}))))
+	// every resting order of one side in priority order, paged with offset and limit
+	serverRouter.Handle("GET /api/v1/ticker/{ticker}/l3", authmiddleware(logging(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		const (
+			L3_DEFAULT_LIMIT = 100
+			L3_MAX_LIMIT     = 1000
+		)
+		uc := *orderUsecase
+		ticker := r.PathValue("ticker")
+		var side model.Side
+		switch r.URL.Query().Get("side") {
+		case "bid":
+			side = model.BID
+		case "ask":
+			side = model.ASK
+		default:
+			writeJSONError(w, http.StatusBadRequest, fmt.Errorf("side must be bid or ask"))
+			return
+		}
+		offset, err := queryInt(r, "offset", 0)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err)
+			return
+		}
+		limit, err := queryInt(r, "limit", L3_DEFAULT_LIMIT)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err)
+			return
+		}
+		if limit == 0 || limit > L3_MAX_LIMIT {
+			writeJSONError(w, http.StatusBadRequest, fmt.Errorf("limit must be between 1 and %d", L3_MAX_LIMIT))
+			return
+		}
+		writeJSON(w, http.StatusOK, uc.GetOrderBookL3(r.Context(), ticker, side, offset, limit))
+	}))))
+	// indicative price and volume while the ticker is in an auction
+	serverRouter.Handle("GET /api/v1/ticker/{ticker}/auction", authmiddleware(logging(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		type AuctionResponse struct {
+			Phase      model.TradingPhase       `json:"phase"`
+			Indication *model.AuctionIndication `json:"indication,omitempty"`
+		}
+		uc := *orderUsecase
+		ticker := r.PathValue("ticker")
+		writeJSON(w, http.StatusOK, AuctionResponse{
+			Phase:      uc.GetTradingPhase(r.Context(), ticker),
+			Indication: uc.GetAuctionIndication(r.Context(), ticker),
+		})
+	}))))
+	// moves the ticker through its trading day, leaving an auction uncrosses it
+	serverRouter.Handle("PUT /api/v1/ticker/{ticker}/phase", logging(authmiddleware(adminmiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		type SetPhaseRequest struct {
+			Phase model.TradingPhase `json:"phase"`
+		}
+		type SetPhaseResponse struct {
+			Phase  model.TradingPhase `json:"phase"`
+			Trades []*model.Trade     `json:"trades,omitempty"`
+		}
+		req, err := decodeJSON[SetPhaseRequest](w, r)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err)
+			return
+		}
+		uc := *orderUsecase
+		trades, err := uc.SetTradingPhase(r.Context(), r.PathValue("ticker"), req.Phase)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, SetPhaseResponse{Phase: req.Phase, Trades: trades})
+	})))))
+	// what the ticker takes right now: OPEN, HALTED, CANCEL_ONLY or CLOSED, with the status the
+	// operator set, the trading phase and any circuit breaker halt behind it
+	serverRouter.Handle("GET /api/v1/ticker/{ticker}/status", authmiddleware(logging(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uc := *orderUsecase
+		state, err := uc.GetTickerState(r.Context(), r.PathValue("ticker"))
+		if err != nil {
+			writeJSONError(w, http.StatusNotFound, fmt.Errorf("error reading ticker status: %v", err))
+			return
+		}
+		writeJSON(w, http.StatusOK, state)
+	}))))
+	// halts, resumes, sets cancel-only or closes the ticker, closing cancels its open orders
+	serverRouter.Handle("PUT /api/v1/ticker/{ticker}/status", logging(authmiddleware(adminmiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		type SetStatusRequest struct {
+			Status model.TickerStatus `json:"status"`
+		}
+		req, err := decodeJSON[SetStatusRequest](w, r)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err)
+			return
+		}
+		uc := *orderUsecase
+		change, err := uc.SetTickerStatus(r.Context(), r.PathValue("ticker"), req.Status)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, change)
+	})))))
+}
+
+func bindEngine(serverRouter *http.ServeMux, orderUsecase *order.OrderUseCase, tokenMaker *middleware.JWTMaker) {
+	authmiddleware := middleware.AuthMiddleware(tokenMaker)
+	// per ticker queue depth and command latency of the engine workers
+	serverRouter.Handle("GET /api/v1/engine/stats", logging(authmiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uc := *orderUsecase
+		writeJSON(w, http.StatusOK, uc.GetEngineStats(r.Context()))
+	}))))
 }
 
 func bindOrder(serverRouter *http.ServeMux, usecase *order.OrderUseCase, tokenMaker *middleware.JWTMaker) {
@@ -141,6 +272,7 @@ func bindUser(serverRouter *http.ServeMux, tokenMaker *middleware.JWTMaker, user
 	serverRouter.Handle("GET /api/v1/user/transactions", logging(authmiddleware(http.HandlerFunc(defaultHandler))))
 	serverRouter.Handle("GET /api/v1/user/portfolio", logging(authmiddleware(http.HandlerFunc(defaultHandler))))
 	serverRouter.Handle("POST /api/v1/user/money", logging(authmiddleware(http.HandlerFunc(userRouter.AddUserMoney))))
+	serverRouter.Handle("PUT /api/v1/user/stp", logging(authmiddleware(http.HandlerFunc(userRouter.SetSelfTradePrevention))))
 	serverRouter.Handle("POST /api/v1/user/register", logging(http.HandlerFunc(userRouter.RegisterUser)))
 	serverRouter.Handle("POST /api/v1/user/login", logging(http.HandlerFunc(userRouter.LoginUser)))
 }
@@ -150,12 +282,15 @@ type BindRouterOpts struct {
 	OrderUseCase *order.OrderUseCase
 	TokenMaker   *middleware.JWTMaker
 	UserUseCase  *user.UserUseCase
+	// AdminUserIDs may change the trading phase and status of tickers
+	AdminUserIDs map[int64]struct{}
 }
 
 func BindRouter(opts BindRouterOpts) {
 	bindOrder(opts.ServerRouter, opts.OrderUseCase, opts.TokenMaker)
 	bindUser(opts.ServerRouter, opts.TokenMaker, opts.UserUseCase, opts.OrderUseCase)
-	bindTicker(opts.ServerRouter, opts.OrderUseCase, opts.TokenMaker)
+	bindTicker(opts.ServerRouter, opts.OrderUseCase, opts.TokenMaker, opts.AdminUserIDs)
+	bindEngine(opts.ServerRouter, opts.OrderUseCase, opts.TokenMaker)
 
 	//healthcheck
 	opts.ServerRouter.Handle("GET /healthz", logging(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
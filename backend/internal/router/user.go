@@ -9,6 +9,7 @@ import (
 	"github.com/Yusufzhafir/go-orderbook/backend/internal/router/middleware"
 	"github.com/Yusufzhafir/go-orderbook/backend/internal/usecase/order"
 	"github.com/Yusufzhafir/go-orderbook/backend/internal/usecase/user"
+	"github.com/Yusufzhafir/go-orderbook/backend/pkg/model"
 )
 
 type UserRouter interface {
@@ -18,6 +19,7 @@ type UserRouter interface {
 	AddUserMoney(w http.ResponseWriter, r *http.Request)
 	RegisterUser(w http.ResponseWriter, r *http.Request)
 	LoginUser(w http.ResponseWriter, r *http.Request)
+	SetSelfTradePrevention(w http.ResponseWriter, r *http.Request)
 	// GetUser(w http.ResponseWriter, r *http.Request)
 }
 
@@ -41,6 +43,7 @@ func (ur *userRouterImpl) GetUser(w http.ResponseWriter, r *http.Request) {
 		CreatedAt time.Time `json:"created_at"`
 		Username  string    `json:"username"`
 		Balance   string    `json:"balance"`
+		STPMode   uint8     `json:"stpMode"`
 	}
 	claims := r.Context().Value(middleware.AuthKey{}).(*middleware.UserClaims)
 
@@ -55,6 +58,7 @@ func (ur *userRouterImpl) GetUser(w http.ResponseWriter, r *http.Request) {
 		CreatedAt: (*user).CreatedAt,
 		Username:  user.Username,
 		Balance:   (*user).UserBalance,
+		STPMode:   (*user).STPMode,
 	})
 
 }
@@ -163,3 +167,30 @@ func (ur *userRouterImpl) LoginUser(w http.ResponseWriter, r *http.Request) {
 		ExpiresAt: newClaim.ExpiresAt.Time, // optional
 	})
 }
+
+func (ur *userRouterImpl) SetSelfTradePrevention(w http.ResponseWriter, r *http.Request) {
+	type SetSTPReq struct {
+		// Mode 0 none, 1 cancel newest, 2 cancel oldest, 3 cancel both, 4 decrement and cancel
+		Mode model.SelfTradePrevention `json:"mode"`
+	}
+	type SetSTPRes struct {
+		Message string `json:"message"`
+	}
+	claims := r.Context().Value(middleware.AuthKey{}).(*middleware.UserClaims)
+
+	req, err := decodeJSON[SetSTPReq](w, r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	err = (*ur.usecase).SetSelfTradePrevention(r.Context(), claims.UserId, req.Mode)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, SetSTPRes{
+		Message: fmt.Sprintf("self-trade prevention set to %d", req.Mode),
+	})
+}
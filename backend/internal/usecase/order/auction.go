@@ -0,0 +1,114 @@
+package order
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Yusufzhafir/go-orderbook/backend/pkg/model"
+)
+
+// AuctionHandler is told the indicative price and volume of a running auction.
+type AuctionHandler func(model.AuctionIndication)
+
+func (ou *orderUseCaseImpl) RegisterAuctionHandler(handler AuctionHandler) {
+	ou.auctionHandler = handler
+}
+
+// SetTradingPhase moves ticker to phase and settles the trades of an uncross.
+func (ou *orderUseCaseImpl) SetTradingPhase(ctx context.Context, ticker string, phase model.TradingPhase) ([]*model.Trade, error) {
+	events, err := ou.getWorker(tickerType(ticker)).SetTradingPhase(phase)
+	if err != nil {
+		return nil, err
+	}
+	trades := model.TradesOf(events)
+	log.Printf("ticker %s: trading phase %s, %d auction trades", ticker, phase, len(trades))
+	if len(trades) == 0 {
+		return trades, nil
+	}
+	if err := ou.settleTrades(ctx, trades, tickerType(ticker)); err != nil {
+		return trades, fmt.Errorf("settling auction trades: %w", err)
+	}
+	if err := ou.releasePriceImprovement(ctx, trades); err != nil {
+		return trades, fmt.Errorf("releasing auction price improvement: %w", err)
+	}
+	return trades, nil
+}
+
+func (ou *orderUseCaseImpl) GetTradingPhase(ctx context.Context, ticker string) model.TradingPhase {
+	return ou.getWorker(tickerType(ticker)).GetTradingPhase()
+}
+
+// GetAuctionIndication is nil unless ticker is in an auction.
+func (ou *orderUseCaseImpl) GetAuctionIndication(ctx context.Context, ticker string) *model.AuctionIndication {
+	return ou.getWorker(tickerType(ticker)).GetAuctionIndication()
+}
+
+// releasePriceImprovement hands back what buyers reserved above the price they traded at. Bids
+// reserve their limit price, continuous trading prints at it, but an auction prints everything
+// at the uncrossing price.
+func (ou *orderUseCaseImpl) releasePriceImprovement(ctx context.Context, trades []*model.Trade) error {
+	tx := ou.db.MustBeginTx(ctx, nil)
+	defer tx.Rollback()
+
+	cashTicker, err := (*ou.ledgerRepo).GetLedgerByTicker(ctx, tx, model.CASH_TICKER)
+	if err != nil {
+		return err
+	}
+	improvements := make(map[int64]uint64)
+	for _, trade := range trades {
+		for _, id := range []model.OrderId{trade.MakerID, trade.TakerID} {
+			record, err := (*ou.orderRepo).GetOrderByID(ctx, tx, uint64(id))
+			if err != nil {
+				return err
+			}
+			if model.Side(record.Side) == model.BID && record.Price > uint64(trade.Price) {
+				improvements[record.UserID] += (record.Price - uint64(trade.Price)) * uint64(trade.Quantity)
+			}
+		}
+	}
+	for userID, amount := range improvements {
+		if err := ou.releaseToUser(ctx, tx, userID, cashTicker, amount); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// RunAuctionPublisher hands the indication of every ticker in an auction to the auction handler
+// each interval until ctx is done, whenever it changed since the last one.
+func (ou *orderUseCaseImpl) RunAuctionPublisher(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	published := make(map[tickerType]model.AuctionIndication)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if ou.auctionHandler == nil {
+				continue
+			}
+			ou.engineMu.Lock()
+			tickers := make([]tickerType, 0, len(ou.orderBookEngineMap))
+			for name := range ou.orderBookEngineMap {
+				tickers = append(tickers, name)
+			}
+			ou.engineMu.Unlock()
+
+			for _, name := range tickers {
+				indication := ou.getWorker(name).GetAuctionIndication()
+				if indication == nil {
+					delete(published, name)
+					continue
+				}
+				if last, ok := published[name]; ok && last == *indication {
+					continue
+				}
+				published[name] = *indication
+				ou.auctionHandler(*indication)
+			}
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package order
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+
+	"github.com/Yusufzhafir/go-orderbook/backend/internal/router/middleware"
+	"github.com/Yusufzhafir/go-orderbook/backend/pkg/model"
+)
+
+// GetOrderBookL3 returns a page of one side of ticker order by order. Every order gets a token
+// that stays the same for as long as it rests, only the caller's own orders show their id.
+func (ou *orderUseCaseImpl) GetOrderBookL3(ctx context.Context, ticker string, side model.Side, offset, limit int) *model.OrderBookL3 {
+	book := ou.getWorker(tickerType(ticker)).GetOrderBookL3(side, offset, limit)
+	var userID int64
+	if claims, ok := ctx.Value(middleware.AuthKey{}).(*middleware.UserClaims); ok {
+		userID = claims.UserId
+	}
+	for i := range book.Orders {
+		entry := &book.Orders[i]
+		entry.Token = ou.orderToken(entry.OrderID)
+		if userID == 0 || entry.Owner != userID {
+			entry.OrderID = 0
+		}
+	}
+	return book
+}
+
+// orderToken anonymises orderID, it cannot be turned back into the id without the key.
+func (ou *orderUseCaseImpl) orderToken(orderID model.OrderId) string {
+	mac := hmac.New(sha256.New, ou.tokenKey)
+	mac.Write(binary.LittleEndian.AppendUint64(nil, uint64(orderID)))
+	return hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+// newTokenKey is a random key for order tokens, used when none is configured. Tokens then
+// change when the process restarts.
+func newTokenKey() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	return key
+}
@@ -0,0 +1,49 @@
+package order
+
+import (
+	"context"
+	"log"
+
+	"github.com/Yusufzhafir/go-orderbook/backend/pkg/model"
+)
+
+// ESCROW_QUEUE_SIZE is how many orders the engines cancelled or reduced on their own wait for the
+// escrow releaser before the engines block on it.
+const ESCROW_QUEUE_SIZE = 4096
+
+// escrowRelease is an order the engine took off the book, or reduced by reduced, without being asked.
+type escrowRelease struct {
+	order   model.Order
+	reduced model.Quantity // zero when the order was cancelled
+}
+
+// queueRelease hands an order the engine cancelled or reduced to the escrow releaser. It runs on
+// the engine's worker, which waits while the releaser is backed up rather than lose the release.
+func (ou *orderUseCaseImpl) queueRelease(release escrowRelease) {
+	select {
+	case ou.releases <- release:
+	case <-ou.ctx.Done():
+	}
+}
+
+// RunEscrowReleaser releases the escrow of the orders the engines cancel or reduce on their own,
+// such as triggered stops that cannot rest and self-trade prevention, until ctx is done. The
+// database and ledger work stays off the engine workers. A release that fails is logged.
+func (ou *orderUseCaseImpl) RunEscrowReleaser(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case release := <-ou.releases:
+			if release.reduced == 0 {
+				if err := ou.releaseCancelledOrder(ctx, release.order); err != nil {
+					log.Printf("order %d cancelled by engine: releasing escrow failed: %v", release.order.GetId(), err)
+				}
+				continue
+			}
+			if err := ou.releaseReducedOrder(ctx, release.order, release.reduced); err != nil {
+				log.Printf("order %d reduced by engine: releasing escrow failed: %v", release.order.GetId(), err)
+			}
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package order
+
+import (
+	"context"
+	"log"
+	"math"
+
+	orderRepository "github.com/Yusufzhafir/go-orderbook/backend/internal/repository/order"
+	"github.com/Yusufzhafir/go-orderbook/backend/pkg/model"
+)
+
+// EVENT_QUEUE_SIZE is how many commands' worth of events wait for the event writer before the
+// engines block on it, EVENT_INSERT_BATCH the most events written by one insert.
+const (
+	EVENT_QUEUE_SIZE   = 4096
+	EVENT_INSERT_BATCH = 1000
+)
+
+// EventHandler is told about every engine event once it is persisted, in sequence order per ticker.
+type EventHandler func(model.Event)
+
+func (ou *orderUseCaseImpl) RegisterEventHandler(handler EventHandler) {
+	ou.eventHandler = handler
+}
+
+// queueEvents hands the events of one engine command to the event writer. It runs on the
+// engine's worker, which waits while the writer is backed up rather than lose events.
+func (ou *orderUseCaseImpl) queueEvents(events []model.Event) {
+	select {
+	case ou.events <- events:
+	case <-ou.ctx.Done():
+	}
+}
+
+// RunEventWriter persists the events the engines emit and then passes them to the event
+// handler, until ctx is done. Events that cannot be written are logged and still passed on.
+func (ou *orderUseCaseImpl) RunEventWriter(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case events := <-ou.events:
+			for start := 0; start < len(events); start += EVENT_INSERT_BATCH {
+				batch := events[start:min(start+EVENT_INSERT_BATCH, len(events))]
+				if err := ou.persistEvents(ctx, batch); err != nil {
+					log.Printf("ticker %s: persisting events %d to %d: %v", batch[0].Ticker, batch[0].Sequence, batch[len(batch)-1].Sequence, err)
+				}
+			}
+			if ou.eventHandler == nil {
+				continue
+			}
+			for _, event := range events {
+				ou.eventHandler(event)
+			}
+		}
+	}
+}
+
+func (ou *orderUseCaseImpl) persistEvents(ctx context.Context, events []model.Event) error {
+	records := make([]orderRepository.EventRecord, 0, len(events))
+	triggered := make([]uint64, 0)
+	for _, event := range events {
+		if event.Type == model.EVENT_ORDER_TRIGGERED {
+			triggered = append(triggered, uint64(event.OrderID))
+		}
+		record := orderRepository.EventRecord{
+			Ticker:     event.Ticker,
+			Sequence:   event.Sequence,
+			Type:       uint8(event.Type),
+			OrderID:    uint64(event.OrderID),
+			Side:       int8(event.Side),
+			Price:      eventPrice(event.Price),
+			Quantity:   uint64(event.Quantity),
+			Remaining:  uint64(event.Remaining),
+			Reason:     event.Reason,
+			OccurredAt: event.Time,
+		}
+		if event.Trade != nil {
+			record.OrderID = uint64(event.Trade.TakerID)
+			record.MakerOrderID = uint64(event.Trade.MakerID)
+		}
+		records = append(records, record)
+	}
+
+	tx := ou.db.MustBeginTx(ctx, nil)
+	defer tx.Rollback()
+	if err := (*ou.orderRepo).CreateEvents(ctx, tx, records); err != nil {
+		return err
+	}
+	// a restart has to know the stop is on the book now, not waiting for its price again
+	if err := (*ou.orderRepo).MarkTriggered(ctx, tx, triggered); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// eventPrice is the price an event is stored with. Market buys carry math.MaxUint64 so they can
+// sweep every ask, which the driver cannot send, they are stored at 0 like market sells.
+func eventPrice(price model.Price) uint64 {
+	if price == math.MaxUint64 {
+		return 0
+	}
+	return uint64(price)
+}
+
+// cancelledIn reports whether events cancel orderID.
+func cancelledIn(events []model.Event, orderID model.OrderId) bool {
+	for _, event := range events {
+		if event.Type == model.EVENT_ORDER_CANCELLED && event.OrderID == orderID {
+			return true
+		}
+	}
+	return false
+}
+
+// reducedIn sums what events took off orderID without trading it.
+func reducedIn(events []model.Event, orderID model.OrderId) model.Quantity {
+	var reduced model.Quantity
+	for _, event := range events {
+		if event.Type == model.EVENT_ORDER_REDUCED && event.OrderID == orderID {
+			reduced += event.Quantity
+		}
+	}
+	return reduced
+}
@@ -0,0 +1,157 @@
+package order
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Yusufzhafir/go-orderbook/backend/internal/engine"
+	orderRepository "github.com/Yusufzhafir/go-orderbook/backend/internal/repository/order"
+	"github.com/Yusufzhafir/go-orderbook/backend/pkg/model"
+	"github.com/jmoiron/sqlx"
+)
+
+// TestMain keeps the engine's logging out of the test output.
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// recordingDriver is a database/sql driver that accepts every statement and remembers the ones
+// that were committed. Arguments go through database/sql's own conversion, so values a real
+// driver cannot be sent fail here too.
+type recordingDriver struct {
+	mu        sync.Mutex
+	committed []string
+}
+
+type recordingConn struct {
+	driver  *recordingDriver
+	pending []string
+}
+
+type recordingStmt struct {
+	conn  *recordingConn
+	query string
+}
+
+type recordingTx struct{ conn *recordingConn }
+
+func (d *recordingDriver) Open(string) (driver.Conn, error) { return &recordingConn{driver: d}, nil }
+
+func (c *recordingConn) Prepare(query string) (driver.Stmt, error) {
+	return &recordingStmt{conn: c, query: query}, nil
+}
+
+func (c *recordingConn) Close() error              { return nil }
+func (c *recordingConn) Begin() (driver.Tx, error) { return &recordingTx{conn: c}, nil }
+
+func (s *recordingStmt) Close() error  { return nil }
+func (s *recordingStmt) NumInput() int { return -1 }
+
+func (s *recordingStmt) Exec([]driver.Value) (driver.Result, error) {
+	s.conn.pending = append(s.conn.pending, s.query)
+	return driver.RowsAffected(1), nil
+}
+
+func (s *recordingStmt) Query([]driver.Value) (driver.Rows, error) {
+	return nil, driver.ErrSkip
+}
+
+func (tx *recordingTx) Commit() error {
+	tx.conn.driver.mu.Lock()
+	defer tx.conn.driver.mu.Unlock()
+	tx.conn.driver.committed = append(tx.conn.driver.committed, tx.conn.pending...)
+	tx.conn.pending = nil
+	return nil
+}
+
+func (tx *recordingTx) Rollback() error {
+	tx.conn.pending = nil
+	return nil
+}
+
+// newRecordingUseCase returns a use case that persists through the real order repository into
+// a fresh recordingDriver.
+func newRecordingUseCase(t *testing.T) (*orderUseCaseImpl, *recordingDriver) {
+	t.Helper()
+	recorder := &recordingDriver{}
+	db := sqlx.NewDb(sql.OpenDB(connector{recorder}), "postgres")
+	t.Cleanup(func() { db.Close() })
+	repo := orderRepository.NewOrderRepository(db)
+	return &orderUseCaseImpl{db: db, orderRepo: &repo}, recorder
+}
+
+// connector hands database/sql the connections of one recordingDriver.
+type connector struct{ driver *recordingDriver }
+
+func (c connector) Connect(context.Context) (driver.Conn, error) { return c.driver.Open("") }
+func (c connector) Driver() driver.Driver                        { return c.driver }
+
+func TestPersistEventsOfMarketBuys(t *testing.T) {
+	tests := []struct {
+		name      string
+		orders    []model.Order // the last one is the command whose events are persisted
+		triggered bool          // whether the command released a stop
+	}{
+		{
+			name: "market buy",
+			orders: []model.Order{
+				model.NewOrder(1, model.ASK, 100, 5, model.ORDER_GOOD_TILL_CANCEL),
+				model.NewMarketOrder(2, model.BID, 3, 1000),
+			},
+		},
+		{
+			name: "market buy that runs out of asks",
+			orders: []model.Order{
+				model.NewOrder(1, model.ASK, 100, 5, model.ORDER_GOOD_TILL_CANCEL),
+				model.NewMarketOrder(2, model.BID, 8, 1000),
+			},
+		},
+		{
+			name: "triggered stop-market buy",
+			orders: []model.Order{
+				model.NewOrder(1, model.ASK, 100, 5, model.ORDER_GOOD_TILL_CANCEL),
+				model.NewStopOrder(2, model.BID, 100, 0, 2, model.ORDER_STOP_MARKET, 500),
+				model.NewOrder(3, model.BID, 100, 1, model.ORDER_IMMEDIATE_OR_CANCEL),
+			},
+			triggered: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			book := engine.NewOrderBookEngine(engine.OrderBookEngineOpts{Ticker: "EVT"})
+			book.Initialize()
+			var events []model.Event
+			for _, order := range test.orders {
+				var err error
+				if events, err = book.AddOrder(order); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			ou, recorder := newRecordingUseCase(t)
+			if err := ou.persistEvents(context.Background(), events); err != nil {
+				t.Fatalf("persisting %d events: %v", len(events), err)
+			}
+			var inserted, marked bool
+			for _, query := range recorder.committed {
+				inserted = inserted || strings.Contains(query, "INSERT INTO engine_events")
+				marked = marked || strings.Contains(query, "SET triggered = TRUE")
+			}
+			if !inserted {
+				t.Error("the events were not committed")
+			}
+			if marked != test.triggered {
+				t.Errorf("stop marked triggered %v, want %v", marked, test.triggered)
+			}
+		})
+	}
+}
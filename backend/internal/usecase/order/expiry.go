@@ -0,0 +1,50 @@
+package order
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/Yusufzhafir/go-orderbook/backend/pkg/model"
+)
+
+// RunExpiryScheduler cancels good-till-date and day orders whose expiry has passed, checking
+// every interval until ctx is done. Expired orders are closed with ORDER_STATUS_EXPIRED.
+func (ou *orderUseCaseImpl) RunExpiryScheduler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			ou.expireOrders(ctx, ou.clock.Now())
+		}
+	}
+}
+
+func (ou *orderUseCaseImpl) expireOrders(ctx context.Context, now time.Time) {
+	tx := ou.db.MustBeginTx(ctx, nil)
+	expired, err := (*ou.orderRepo).ListExpiredOrders(ctx, tx, now)
+	tx.Rollback()
+	if err != nil {
+		log.Printf("listing expired orders: %v", err)
+		return
+	}
+	for _, ord := range expired {
+		err = ou.cancelOrder(ctx, model.OrderId(ord.ID), model.ORDER_STATUS_EXPIRED)
+		if err != nil {
+			log.Printf("expiring order %d: %v", ord.ID, err)
+		}
+	}
+}
+
+// nextSessionClose is when a DAY order placed at now expires: the first session close after now.
+func (ou *orderUseCaseImpl) nextSessionClose(now time.Time) time.Time {
+	now = now.UTC()
+	sessionEnd := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC).Add(ou.sessionClose)
+	if !sessionEnd.After(now) {
+		sessionEnd = sessionEnd.AddDate(0, 0, 1)
+	}
+	return sessionEnd
+}
@@ -0,0 +1,98 @@
+package order
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Yusufzhafir/go-orderbook/backend/pkg/clock"
+	"github.com/Yusufzhafir/go-orderbook/backend/pkg/model"
+)
+
+func TestNextSessionClose(t *testing.T) {
+	jakarta := time.FixedZone("WIB", 7*60*60)
+	tests := []struct {
+		name         string
+		sessionClose time.Duration
+		now          time.Time
+		want         time.Time
+	}{
+		{
+			name:         "before the close expires the same day",
+			sessionClose: 21 * time.Hour,
+			now:          time.Date(2025, 1, 2, 9, 0, 0, 0, time.UTC),
+			want:         time.Date(2025, 1, 2, 21, 0, 0, 0, time.UTC),
+		},
+		{
+			name:         "at the close expires the next day",
+			sessionClose: 21 * time.Hour,
+			now:          time.Date(2025, 1, 2, 21, 0, 0, 0, time.UTC),
+			want:         time.Date(2025, 1, 3, 21, 0, 0, 0, time.UTC),
+		},
+		{
+			name:         "after the close expires the next day",
+			sessionClose: 21 * time.Hour,
+			now:          time.Date(2025, 1, 2, 22, 30, 0, 0, time.UTC),
+			want:         time.Date(2025, 1, 3, 21, 0, 0, 0, time.UTC),
+		},
+		{
+			name:         "after the close on the last day of the month",
+			sessionClose: 21 * time.Hour,
+			now:          time.Date(2025, 1, 31, 22, 0, 0, 0, time.UTC),
+			want:         time.Date(2025, 2, 1, 21, 0, 0, 0, time.UTC),
+		},
+		{
+			name:         "local time is taken as the UTC instant it is",
+			sessionClose: 21 * time.Hour,
+			now:          time.Date(2025, 1, 3, 3, 0, 0, 0, jakarta),
+			want:         time.Date(2025, 1, 2, 21, 0, 0, 0, time.UTC),
+		},
+		{
+			name:         "close at midnight",
+			sessionClose: 0,
+			now:          time.Date(2025, 1, 2, 9, 0, 0, 0, time.UTC),
+			want:         time.Date(2025, 1, 3, 0, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ou := &orderUseCaseImpl{sessionClose: test.sessionClose}
+			if got := ou.nextSessionClose(test.now); !got.Equal(test.want) {
+				t.Errorf("nextSessionClose(%v) = %v, want %v", test.now, got, test.want)
+			}
+		})
+	}
+}
+
+// TestAddOrderRejectsPastExpiry runs AddOrder without a database, ledger or engine, like
+// TestAddOrderRejectsUnknownTypes.
+func TestAddOrderRejectsPastExpiry(t *testing.T) {
+	now := time.Date(2025, 1, 2, 9, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		expiresAt time.Time
+	}{
+		{
+			name: "no expiry",
+		},
+		{
+			name:      "expiry in the past",
+			expiresAt: now.Add(-time.Minute),
+		},
+		{
+			name:      "expiry now",
+			expiresAt: now,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ou := &orderUseCaseImpl{clock: clock.NewManual(now)}
+			result, err := ou.AddOrder(context.Background(), "TEST", model.BID, 100, 1, model.ORDER_GOOD_TILL_DATE, AddOrderOpts{ExpiresAt: test.expiresAt})
+			if err == nil {
+				t.Fatalf("AddOrder accepted the order as %+v", result)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package order
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Yusufzhafir/go-orderbook/backend/internal/engine"
+)
+
+// JOURNAL_EXT is the extension of the per ticker journal files, named <ticker>.journal.
+const JOURNAL_EXT = ".journal"
+
+// openJournal opens the journal of ticker, nil when journaling is disabled. Failing to open it
+// is fatal: running the engine without its journal would make the next recovery lose orders.
+// Called with engineMu held.
+func (ou *orderUseCaseImpl) openJournal(ticker tickerType) *engine.Journal {
+	if ou.journalDir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(ou.journalDir, 0o755); err != nil {
+		log.Fatalf("ticker %s: creating journal dir: %v", ticker, err)
+	}
+	journal, err := engine.OpenJournal(engine.JournalOpts{
+		Path: filepath.Join(ou.journalDir, string(ticker)+JOURNAL_EXT),
+	})
+	if err != nil {
+		log.Fatalf("ticker %s: opening journal: %v", ticker, err)
+	}
+	ou.journals[ticker] = journal
+	return journal
+}
+
+// ReplayJournals feeds every journal in the journal dir back through the engine of its ticker.
+// Run it after RestoreSnapshots and before taking orders, commands a snapshot already covers are
+// skipped. Replayed trades were settled in the original run, so they are only counted.
+func (ou *orderUseCaseImpl) ReplayJournals(ctx context.Context) error {
+	if ou.journalDir == "" {
+		return nil
+	}
+	entries, err := os.ReadDir(ou.journalDir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), JOURNAL_EXT) {
+			continue
+		}
+		ticker := tickerType(strings.TrimSuffix(entry.Name(), JOURNAL_EXT))
+		commands := make([]engine.JournalEntry, 0)
+		err := engine.ReadJournal(filepath.Join(ou.journalDir, entry.Name()), func(command engine.JournalEntry) error {
+			commands = append(commands, command)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("ticker %s: %w", ticker, err)
+		}
+		worker := ou.getWorker(ticker)
+		trades, err := worker.Replay(commands)
+		if err != nil {
+			return fmt.Errorf("ticker %s: %w", ticker, err)
+		}
+		log.Printf("ticker %s: replayed journal up to %d, %d trades", ticker, worker.Sequence(), len(trades))
+	}
+	return nil
+}
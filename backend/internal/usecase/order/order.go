@@ -5,13 +5,18 @@ import (
 	"fmt"
 	"log"
 	"math/big"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/Yusufzhafir/go-orderbook/backend/internal/engine"
 	ledgerRepository "github.com/Yusufzhafir/go-orderbook/backend/internal/repository/ledger"
 	orderRepository "github.com/Yusufzhafir/go-orderbook/backend/internal/repository/order"
+	userRepository "github.com/Yusufzhafir/go-orderbook/backend/internal/repository/user"
 	"github.com/Yusufzhafir/go-orderbook/backend/internal/router/middleware"
+	"github.com/Yusufzhafir/go-orderbook/backend/pkg/clock"
 	"github.com/Yusufzhafir/go-orderbook/backend/pkg/model"
+	"github.com/Yusufzhafir/go-orderbook/backend/pkg/snowflake"
 	"github.com/jmoiron/sqlx"
 
 	tb "github.com/tigerbeetle/tigerbeetle-go"
@@ -19,7 +24,7 @@ import (
 )
 
 type OrderUseCase interface {
-	AddOrder(ctx context.Context, ticker string, side model.Side, price model.Price, quantity model.Quantity, orderType model.OrderType) (trades []*model.Trade, orderID model.OrderId, err error)
+	AddOrder(ctx context.Context, ticker string, side model.Side, price model.Price, quantity model.Quantity, orderType model.OrderType, opts AddOrderOpts) (*AddOrderResult, error)
 
 	CancelOrder(ctx context.Context, orderID model.OrderId) error
 
@@ -30,14 +35,40 @@ type OrderUseCase interface {
 	GetTopOfBook(ctx context.Context, ticker string) *model.TopOfBook
 
 	GetOrderInfos(ctx context.Context, ticker string) *model.MarketDepth
+	GetMarketDepth(ctx context.Context, ticker string, levels int, ticks uint64) (*model.MarketDepth, error)
 
 	RegisterTradeHandler(handler TradeHandler)
 	GetOrderByUserId(ctx context.Context, userId int64, isOnlyActive bool) (*[]orderRepository.OrderRecordWithTicker, error)
 	GetTickerList(ctx context.Context) ([]*ledgerRepository.Ticker, error)
+	RunExpiryScheduler(ctx context.Context, interval time.Duration)
+	GetEngineStats(ctx context.Context) []engine.WorkerStats
+	RunSnapshotter(ctx context.Context, dir string, interval time.Duration)
+	WriteSnapshots(dir string) error
+	RestoreSnapshots(ctx context.Context, dir string) error
+	ReplayJournals(ctx context.Context) error
+	RebuildFromActiveOrders(ctx context.Context) error
+	SetTradingPhase(ctx context.Context, ticker string, phase model.TradingPhase) ([]*model.Trade, error)
+	GetTradingPhase(ctx context.Context, ticker string) model.TradingPhase
+	GetAuctionIndication(ctx context.Context, ticker string) *model.AuctionIndication
+	RegisterAuctionHandler(handler AuctionHandler)
+	RunAuctionPublisher(ctx context.Context, interval time.Duration)
+	GetHalt(ctx context.Context, ticker string) *model.Halt
+	RegisterHaltHandler(handler HaltHandler)
+	GetOrderBookL3(ctx context.Context, ticker string, side model.Side, offset, limit int) *model.OrderBookL3
+	RegisterEventHandler(handler EventHandler)
+	RunEventWriter(ctx context.Context)
+	RunEscrowReleaser(ctx context.Context)
+	SetTickerStatus(ctx context.Context, ticker string, status model.TickerStatus) (*model.TickerStatusChange, error)
+	GetTickerState(ctx context.Context, ticker string) (*model.TickerState, error)
+	RestoreTickerStatuses(ctx context.Context) error
+	RegisterStatusHandler(handler StatusHandler)
 }
 type tickerType string
 type orderUseCaseImpl struct {
-	orderBookEngineMap map[tickerType]*engine.OrderBookEngine // hold interface by value, not pointer to interface
+	orderBookEngineMap map[tickerType]*engine.Worker // each ticker's engine is only touched from its worker goroutine
+	journals           map[tickerType]*engine.Journal
+	engineMu           sync.Mutex      // guards orderBookEngineMap and journals
+	ctx                context.Context // lifetime of the engine workers
 
 	tbClient *tb.Client
 
@@ -45,33 +76,96 @@ type orderUseCaseImpl struct {
 
 	escrowAccount Uint128
 
-	tradeHandler TradeHandler
-	orderRepo    *orderRepository.OrderRepository
-	ledgerRepo   *ledgerRepository.LedgerRepository
-	db           *sqlx.DB
+	tradeHandler   TradeHandler
+	auctionHandler AuctionHandler
+	haltHandler    HaltHandler
+	eventHandler   EventHandler
+	statusHandler  StatusHandler
+	events         chan []model.Event // engine events waiting for the event writer
+	releases       chan escrowRelease // orders the engines cancelled or reduced, waiting for the escrow releaser
+	orderRepo      *orderRepository.OrderRepository
+	ledgerRepo     *ledgerRepository.LedgerRepository
+	userRepo       *userRepository.UserRepository
+	db             *sqlx.DB
+	sessionClose   time.Duration
+	journalDir     string
+	tokenKey       []byte
+	clock          clock.Clock
+	ids            *snowflake.Generator
 }
 
 type TradeHandler func(model.Trade)
 
+// HaltHandler is told when a circuit breaker halts a ticker.
+type HaltHandler func(model.Halt)
+
+// AddOrderOpts carries the optional parameters of AddOrder.
+type AddOrderOpts struct {
+	MaxNotional uint64         // market buys: cash budget reserved in escrow, the engine never spends more
+	PostOnly    model.PostOnly // good-till-cancel only: never take liquidity on entry
+	StopPrice   model.Price    // stop types only: trade price that releases the order into the book
+	PeakSize    model.Quantity // good-till-cancel only: iceberg slice shown on the book, the rest stays hidden
+	ExpiresAt   time.Time      // good-till-date only: the order is cancelled as expired once this passes
+	// SelfTradePrevention applies when the order meets one of the user's own, STP_NONE falls back to the account setting
+	SelfTradePrevention model.SelfTradePrevention
+}
+
+// AddOrderResult reports what happened to an order accepted by AddOrder.
+type AddOrderResult struct {
+	OrderID  model.OrderId
+	Trades   []*model.Trade
+	Price    model.Price // resting price, differs from the request when a post-only order was repriced
+	Repriced bool
+}
+
 type OrderUseCaseOpts struct {
 	TBLedgerID    uint32
 	EscrowAccount Uint128 // (optional global escrow, but we'll use per-ticker escrow accounts)
 	OrderRepo     *orderRepository.OrderRepository
 	LedgerRepo    *ledgerRepository.LedgerRepository
+	UserRepo      *userRepository.UserRepository
 	Db            *sqlx.DB
 	TbClient      *tb.Client
+	SessionClose  time.Duration // offset from UTC midnight at which DAY orders expire
+	JournalDir    string        // where each ticker journals its engine commands, empty disables journaling
+	TokenKey      []byte        // keys the anonymised order tokens of the L3 view, random when empty
+	Clock         clock.Clock   // nil means the system clock
+	// IDs numbers orders and trades, nil gives a generator on node 0 of Clock
+	IDs *snowflake.Generator
 }
 
 func NewOrderUseCase(ctx context.Context, opts OrderUseCaseOpts) OrderUseCase {
-	orderbookMap := make(map[tickerType]*engine.OrderBookEngine, 3)
+	orderbookMap := make(map[tickerType]*engine.Worker, 3)
+	tokenKey := opts.TokenKey
+	if len(tokenKey) == 0 {
+		tokenKey = newTokenKey()
+	}
+	useCaseClock := opts.Clock
+	if useCaseClock == nil {
+		useCaseClock = clock.System{}
+	}
+	ids := opts.IDs
+	if ids == nil {
+		ids, _ = snowflake.NewGenerator(snowflake.GeneratorOpts{Clock: useCaseClock})
+	}
 	return &orderUseCaseImpl{
 		orderBookEngineMap: orderbookMap,
+		journals:           make(map[tickerType]*engine.Journal),
+		ctx:                ctx,
 		tbClient:           opts.TbClient,
 		ledgerID:           opts.TBLedgerID,
 		escrowAccount:      opts.EscrowAccount,
 		orderRepo:          opts.OrderRepo,
 		ledgerRepo:         opts.LedgerRepo,
+		userRepo:           opts.UserRepo,
 		db:                 opts.Db,
+		sessionClose:       opts.SessionClose,
+		journalDir:         opts.JournalDir,
+		tokenKey:           tokenKey,
+		events:             make(chan []model.Event, EVENT_QUEUE_SIZE),
+		releases:           make(chan escrowRelease, ESCROW_QUEUE_SIZE),
+		clock:              useCaseClock,
+		ids:                ids,
 	}
 }
 
@@ -79,39 +173,192 @@ func (ou *orderUseCaseImpl) RegisterTradeHandler(handler TradeHandler) {
 	ou.tradeHandler = handler
 }
 
+func (ou *orderUseCaseImpl) RegisterHaltHandler(handler HaltHandler) {
+	ou.haltHandler = handler
+}
+
+// GetHalt is the circuit breaker halt ticker is cooling off from, nil when it trades.
+func (ou *orderUseCaseImpl) GetHalt(ctx context.Context, ticker string) *model.Halt {
+	return ou.getWorker(tickerType(ticker)).GetHalt()
+}
+
 func (ou *orderUseCaseImpl) getOrderbook(ticker tickerType) *engine.OrderBookEngine {
-	orderbook, ok := ou.orderBookEngineMap[ticker]
+	var orderbook engine.OrderBookEngine = ou.getWorker(ticker)
+	return &orderbook
+}
+
+// hasWorker reports whether the engine of ticker was started.
+func (ou *orderUseCaseImpl) hasWorker(ticker tickerType) bool {
+	ou.engineMu.Lock()
+	defer ou.engineMu.Unlock()
+	_, ok := ou.orderBookEngineMap[ticker]
+	return ok
+}
+
+// getWorker returns the worker owning the engine of ticker, starting it on first use.
+func (ou *orderUseCaseImpl) getWorker(ticker tickerType) *engine.Worker {
+	ou.engineMu.Lock()
+	defer ou.engineMu.Unlock()
+
+	worker, ok := ou.orderBookEngineMap[ticker]
 	if ok {
-		return orderbook
+		return worker
 	}
-	createOrderbook := engine.NewOrderBookEngine(string(ticker))
+	policy, bands := ou.tickerSettings(ticker)
+	createOrderbook := engine.NewOrderBookEngine(engine.OrderBookEngineOpts{
+		Ticker:         string(ticker),
+		MatchingPolicy: policy,
+		Journal:        ou.openJournal(ticker),
+		PriceBands:     bands,
+		Clock:          ou.clock,
+		IDs:            ou.ids,
+	})
 	createOrderbook.Initialize()
-	ou.orderBookEngineMap[ticker] = &createOrderbook
+	createOrderbook.RegisterCancelHandler(func(order model.Order) {
+		ou.queueRelease(escrowRelease{order: order})
+	})
+	createOrderbook.RegisterReduceHandler(func(order model.Order, reduced model.Quantity) {
+		ou.queueRelease(escrowRelease{order: order, reduced: reduced})
+	})
+	createOrderbook.RegisterEventHandler(ou.queueEvents)
+	createOrderbook.RegisterHaltHandler(func(halt model.Halt) {
+		log.Printf("ticker %s: circuit breaker halted trading at %d from %d until %s", halt.Ticker, halt.Price, halt.Reference, halt.Until)
+		if ou.haltHandler != nil {
+			ou.haltHandler(halt)
+		}
+	})
+	worker = engine.NewWorker(engine.WorkerOpts{
+		Ticker: string(ticker),
+		Engine: createOrderbook,
+	})
+	go worker.Run(ou.ctx)
+	ou.orderBookEngineMap[ticker] = worker
+
+	return worker
+}
+
+func (ou *orderUseCaseImpl) GetEngineStats(ctx context.Context) []engine.WorkerStats {
+	ou.engineMu.Lock()
+	defer ou.engineMu.Unlock()
 
-	return &createOrderbook
+	stats := make([]engine.WorkerStats, 0, len(ou.orderBookEngineMap))
+	for _, worker := range ou.orderBookEngineMap {
+		stats = append(stats, worker.Stats())
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Ticker < stats[j].Ticker })
+	return stats
+}
+
+// tickerSettings returns the matching policy and price bands configured on the ticker, FIFO
+// without bands when it cannot be read.
+func (ou *orderUseCaseImpl) tickerSettings(ticker tickerType) (engine.MatchingPolicy, engine.PriceBands) {
+	ctx := context.Background()
+	tx := ou.db.MustBeginTx(ctx, nil)
+	defer tx.Rollback()
+
+	tickerRec, err := (*ou.ledgerRepo).GetLedgerByTicker(ctx, tx, string(ticker))
+	if err != nil {
+		log.Printf("ticker %s: reading settings failed, using FIFO without price bands: %v", ticker, err)
+		return engine.FIFOPolicy{}, engine.PriceBands{}
+	}
+	bands := engine.PriceBands{
+		StaticBps:     tickerRec.StaticBandBps,
+		DynamicBps:    tickerRec.DynamicBandBps,
+		BreakerBps:    tickerRec.BreakerBps,
+		BreakerWindow: time.Duration(tickerRec.BreakerWindowMs) * time.Millisecond,
+		HaltDuration:  time.Duration(tickerRec.HaltMs) * time.Millisecond,
+	}
+	policy, err := engine.MatchingPolicyByName(tickerRec.MatchingPolicy)
+	if err != nil {
+		log.Printf("ticker %s: %v, using FIFO", ticker, err)
+		return engine.FIFOPolicy{}, bands
+	}
+	return policy, bands
 }
 
 // AddOrder writes any necessary pre-commit ledger entries (e.g., reserve funds), then submits to engine.
-func (ou *orderUseCaseImpl) AddOrder(ctx context.Context, ticker string, side model.Side, price model.Price, quantity model.Quantity, orderType model.OrderType) ([]*model.Trade, model.OrderId, error) {
+func (ou *orderUseCaseImpl) AddOrder(ctx context.Context, ticker string, side model.Side, price model.Price, quantity model.Quantity, orderType model.OrderType, opts AddOrderOpts) (*AddOrderResult, error) {
+	if orderType > model.ORDER_DAY {
+		return nil, fmt.Errorf("unknown order type %d", orderType)
+	}
+	if opts.PostOnly > model.POST_ONLY_REPRICE {
+		return nil, fmt.Errorf("unknown post-only mode %d", opts.PostOnly)
+	}
+	isMarket := orderType == model.ORDER_MARKET || orderType == model.ORDER_STOP_MARKET
+	if isMarket {
+		// market orders have no limit price, a buy is bounded by its notional cap instead
+		price = 0
+		if side == model.BID && opts.MaxNotional == 0 {
+			return nil, fmt.Errorf("market buy requires a max notional")
+		}
+	}
+	if orderType.IsStop() && opts.StopPrice == 0 {
+		return nil, fmt.Errorf("stop orders require a stop price")
+	}
+	if opts.PostOnly != model.POST_ONLY_NONE && !orderType.RestsOnBook() {
+		return nil, fmt.Errorf("post-only requires a resting limit order")
+	}
+	if opts.PeakSize > 0 && (!orderType.RestsOnBook() || opts.PeakSize >= quantity) {
+		return nil, fmt.Errorf("iceberg peak size must be below the quantity of a resting limit order")
+	}
+	if opts.SelfTradePrevention > model.STP_DECREMENT_AND_CANCEL {
+		return nil, fmt.Errorf("unknown self-trade prevention mode %d", opts.SelfTradePrevention)
+	}
+	var expiresAt *time.Time
+	switch orderType {
+	case model.ORDER_GOOD_TILL_DATE:
+		if !opts.ExpiresAt.After(ou.clock.Now()) {
+			return nil, fmt.Errorf("good-till-date requires an expiry in the future")
+		}
+		expiresAt = &opts.ExpiresAt
+	case model.ORDER_DAY:
+		sessionEnd := ou.nextSessionClose(ou.clock.Now())
+		expiresAt = &sessionEnd
+	}
 
-	orderID := model.OrderId(time.Now().UnixMilli())
+	orderID := model.OrderId(ou.ids.Next())
 	userID := *(ctx.Value(middleware.AuthKey{}).(*middleware.UserClaims))
 
-	// Reserve funds for GTC orders (if needed)
+	selfTrade := opts.SelfTradePrevention
+	if selfTrade == model.STP_NONE && ou.userRepo != nil {
+		account, err := (*ou.userRepo).GetByID(ctx, userID.UserId)
+		if err != nil {
+			return nil, err
+		}
+		selfTrade = model.SelfTradePrevention(account.STPMode)
+	}
+
+	// Reserve funds up front, stops included, immediate orders hand back whatever they do not use
 	tx := ou.db.MustBeginTx(ctx, nil)
 	defer tx.Rollback()
 
 	assetTicker, err := (*ou.ledgerRepo).GetLedgerByTicker(ctx, tx, ticker)
-	log.Printf("tickerledger %v err %v", assetTicker, err)
 	if err != nil {
-		return nil, 0, err
+		return nil, err
 	}
 	tickerID := assetTicker.ID
 
-	if orderType == model.ORDER_GOOD_TILL_CANCEL {
+	// the ticker's status and instrument rules are checked before anything is reserved
+	if err := ou.getWorker(tickerType(ticker)).GetTickerState().Status.CheckOrder(ticker); err != nil {
+		return nil, err
+	}
+	err = InstrumentRules(assetTicker).Check(model.InstrumentOrder{
+		Side:        side,
+		Type:        orderType,
+		Price:       price,
+		StopPrice:   opts.StopPrice,
+		Quantity:    quantity,
+		PeakSize:    opts.PeakSize,
+		MaxNotional: opts.MaxNotional,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if orderType.RestsOnBook() || orderType.IsImmediate() || orderType.IsStop() {
 		quoteTicker, err := (*ou.ledgerRepo).GetLedgerByTicker(ctx, tx, model.CASH_TICKER) // replace "USD" with your quote currency
 		if err != nil {
-			return nil, 0, fmt.Errorf("failed to get quote ticker: %w", err)
+			return nil, fmt.Errorf("failed to get quote ticker: %w", err)
 		}
 		// Fetch user's ledger accounts for reservation
 		switch side {
@@ -119,17 +366,20 @@ func (ou *orderUseCaseImpl) AddOrder(ctx context.Context, ticker string, side mo
 			// Reserve fiat: debit user's currency account, credit currency escrow
 			userCashAcct, err := (*ou.ledgerRepo).GetUserLedger(ctx, tx, userID.UserId, quoteTicker.ID)
 			if err != nil {
-				return nil, 0, err
+				return nil, err
 			}
 			// Amount = price * quantity (in smallest currency units)
 			cashAmount := big.NewInt(1).Mul(big.NewInt(int64(price)), big.NewInt(int64(quantity)))
+			if isMarket {
+				cashAmount = new(big.Int).SetUint64(opts.MaxNotional)
+			}
 			userCashTb, err := stringToUint128(userCashAcct.TBAccountID)
 			if err != nil {
-				return nil, 0, err
+				return nil, err
 			}
 			tickerEscrow, err := stringToUint128(quoteTicker.EscrowAccountID)
 			if err != nil {
-				return nil, 0, err
+				return nil, err
 			}
 			err = ou.reserveFunds(ctx,
 				userCashTb,   // user's fiat account (debit)
@@ -139,21 +389,21 @@ func (ou *orderUseCaseImpl) AddOrder(ctx context.Context, ticker string, side mo
 				model.CASH_LEDGER,
 			)
 			if err != nil {
-				return nil, 0, fmt.Errorf("fund reservation failed: %w", err)
+				return nil, fmt.Errorf("fund reservation failed: %w", err)
 			}
 		case model.ASK:
 			userAssetAcct, err := (*ou.ledgerRepo).GetUserLedger(ctx, tx, userID.UserId, assetTicker.ID)
 			if err != nil {
-				return nil, 0, err
+				return nil, err
 			}
 			assetQty := big.NewInt(1).SetUint64(uint64(quantity))
 			userAssetb, err := stringToUint128(userAssetAcct.TBAccountID)
 			if err != nil {
-				return nil, 0, err
+				return nil, err
 			}
 			tickerEscrow, err := stringToUint128(assetTicker.EscrowAccountID)
 			if err != nil {
-				return nil, 0, err
+				return nil, err
 			}
 			err = ou.reserveFunds(ctx,
 				userAssetb,
@@ -163,7 +413,7 @@ func (ou *orderUseCaseImpl) AddOrder(ctx context.Context, ticker string, side mo
 				uint32(userAssetAcct.LedgerTbId),
 			)
 			if err != nil {
-				return nil, 0, fmt.Errorf("asset reservation failed: %w", err)
+				return nil, fmt.Errorf("asset reservation failed: %w", err)
 			}
 		}
 	}
@@ -179,34 +429,310 @@ func (ou *orderUseCaseImpl) AddOrder(ctx context.Context, ticker string, side mo
 		Type:           uint8(orderType),
 		Quantity:       uint64(quantity),
 		Price:          uint64(price),
+		StopPrice:      uint64(opts.StopPrice),
+		PeakSize:       uint64(opts.PeakSize),
 		IsActive:       true,
+		ExpiresAt:      expiresAt,
+	}
+	if isMarket {
+		newOrderRecord.MaxNotional = opts.MaxNotional
 	}
 
 	err = (*ou.orderRepo).CreateOrder(ctx, tx, newOrderRecord)
 	if err != nil {
-		return nil, 0, fmt.Errorf("inserting order: %w", err)
+		return nil, fmt.Errorf("inserting order: %w", err)
 	}
 
 	// 4. Submit order to matching engine
 	engineOrder := model.NewOrder(orderID, side, price, quantity, orderType)
-	matchedTrades, matchErr := (*ou.getOrderbook(tickerType(ticker))).AddOrder(engineOrder)
+	switch {
+	case orderType.IsStop():
+		// only a stop-market carries the notional cap, a capped limit could stop short and rest crossed
+		engineOrder = model.NewStopOrder(orderID, side, opts.StopPrice, price, quantity, orderType, newOrderRecord.MaxNotional)
+	case orderType == model.ORDER_MARKET:
+		engineOrder = model.NewMarketOrder(orderID, side, quantity, opts.MaxNotional)
+	}
+	engineOrder.SetPostOnly(opts.PostOnly)
+	engineOrder.SetOwner(userID.UserId)
+	engineOrder.SetSelfTradePrevention(selfTrade)
+	if opts.PeakSize > 0 {
+		engineOrder.SetPeakSize(opts.PeakSize)
+	}
+	// cash a buy holds in escrow, immediate orders get back what their trades did not spend
+	reservedCash := uint64(price) * uint64(quantity)
+	if isMarket {
+		reservedCash = opts.MaxNotional
+	}
+	// add and look at what is left of the order in one command, so nothing else trades in between
+	var events []model.Event
+	var matchErr error
+	var resting model.Order
+	var isResting bool
+	ou.getWorker(tickerType(ticker)).SubmitQuery(func(orderbook engine.OrderBookEngine) {
+		events, matchErr = orderbook.AddOrder(engineOrder)
+		resting, isResting = orderbook.GetOrder(orderID)
+	}).Wait()
+	matchedTrades := model.TradesOf(events)
 	if matchErr != nil {
-		return nil, orderID, matchErr
+		// nothing of the order reached the book, hand the whole reservation back
+		tx.Rollback()
+		if err := ou.releaseRemainder(ctx, userID.UserId, orderID, side, quantity, reservedCash, nil, ticker); err != nil {
+			log.Printf("order %d: releasing escrow failed: %v", orderID, err)
+		}
+		return nil, matchErr
 	}
 
+	result := &AddOrderResult{
+		OrderID: orderID,
+		Trades:  matchedTrades,
+		Price:   price,
+	}
+	if opts.PostOnly == model.POST_ONLY_REPRICE {
+		if isResting && resting.GetPrice() != price {
+			result.Price = resting.GetPrice()
+			result.Repriced = true
+			err = ou.applyReprice(ctx, tx, newOrderRecord, result.Price)
+			if err != nil {
+				return result, err
+			}
+		}
+	}
+
+	// self-trade prevention may have shrunk the order on its way in, whether or not any of it
+	// rests; the record and escrow follow, so what is left to release below is already smaller
+	if reduced := reducedIn(events, orderID); reduced > 0 {
+		newOrderRecord.Price = uint64(result.Price)
+		released, err := ou.applyReduction(ctx, tx, newOrderRecord, reduced)
+		if err != nil {
+			return result, err
+		}
+		quantity -= reduced
+		reservedCash -= released
+	}
+	// self-trade prevention or a circuit breaker may have cancelled what was left of it
+	engineCancelled := cancelledIn(events, orderID)
+
 	if err := tx.Commit(); err != nil {
-		return nil, orderID, err
+		return result, err
 	}
 
 	err = ou.settleTrades(ctx, matchedTrades, tickerType(ticker))
 	if err != nil {
-		return nil, orderID, err
+		return result, err
 	}
 
-	return matchedTrades, orderID, nil
+	if orderType.IsImmediate() || engineCancelled {
+		err = ou.releaseRemainder(ctx, userID.UserId, orderID, side, quantity, reservedCash, matchedTrades, ticker)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+// InstrumentRules are the order sizes and prices ticker accepts.
+func InstrumentRules(ticker *ledgerRepository.Ticker) model.InstrumentRules {
+	return model.InstrumentRules{
+		TickSize:    model.Price(ticker.TickSize),
+		LotSize:     model.Quantity(ticker.LotSize),
+		MinQuantity: model.Quantity(ticker.MinQuantity),
+		MaxQuantity: model.Quantity(ticker.MaxQuantity),
+		MinNotional: ticker.MinNotional,
+	}
+}
+
+// applyReprice records the new price of a repriced post-only order. A repriced bid rests
+// lower than it reserved for, so the difference goes back to the user's cash account.
+func (ou *orderUseCaseImpl) applyReprice(ctx context.Context, tx *sqlx.Tx, record orderRepository.OrderRecord, price model.Price) error {
+	oldPrice := record.Price
+	record.Price = uint64(price)
+	err := (*ou.orderRepo).UpdateOrder(ctx, tx, record)
+	if err != nil {
+		return fmt.Errorf("failed to update repriced order: %w", err)
+	}
+	if model.Side(record.Side) != model.BID || oldPrice <= record.Price {
+		return nil
+	}
+
+	quoteTicker, err := (*ou.ledgerRepo).GetLedgerByTicker(ctx, tx, model.CASH_TICKER)
+	if err != nil {
+		return err
+	}
+	return ou.releaseToUser(ctx, tx, record.UserID, quoteTicker, (oldPrice-record.Price)*record.Quantity)
+}
+
+// releaseRemainder returns the escrow an order did not consume and closes it. It runs
+// for immediate orders (IOC, FOK, market) after matching, since the engine cancels
+// whatever they could not fill, and for any order the engine rejected outright.
+func (ou *orderUseCaseImpl) releaseRemainder(ctx context.Context, userID int64, orderID model.OrderId, side model.Side, quantity model.Quantity, reservedCash uint64, trades []*model.Trade, ticker string) error {
+	filled, spent := tradedBy(trades, orderID)
+
+	tx := ou.db.MustBeginTx(ctx, nil)
+	defer tx.Rollback()
+
+	escrowTicker, err := (*ou.ledgerRepo).GetLedgerByTicker(ctx, tx, ticker)
+	if err != nil {
+		return err
+	}
+	amount := uint64(quantity - filled)
+	if side == model.BID {
+		escrowTicker, err = (*ou.ledgerRepo).GetLedgerByTicker(ctx, tx, model.CASH_TICKER)
+		if err != nil {
+			return err
+		}
+		amount = reservedCash - spent
+	}
+
+	err = ou.releaseToUser(ctx, tx, userID, escrowTicker, amount)
+	if err != nil {
+		return err
+	}
+
+	if filled < quantity {
+		err = (*ou.orderRepo).CloseOrders(ctx, tx, []uint64{uint64(orderID)}, ou.clock.Now(), model.ORDER_STATUS_CANCELLED)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// tradedBy sums the quantity and notional orderID traded in trades.
+func tradedBy(trades []*model.Trade, orderID model.OrderId) (model.Quantity, uint64) {
+	var filled model.Quantity
+	var spent uint64
+	for _, tr := range trades {
+		if tr.TakerID != orderID && tr.MakerID != orderID {
+			continue
+		}
+		filled += tr.Quantity
+		spent += uint64(tr.Price) * uint64(tr.Quantity)
+	}
+	return filled, spent
+}
+
+// releaseCancelledOrder hands back the escrow of a resting order the engine cancelled on
+// its own, or of a triggered stop that left the book, and closes it. The order carries its
+// fills, so only the unused part is released.
+func (ou *orderUseCaseImpl) releaseCancelledOrder(ctx context.Context, order model.Order) error {
+	tx := ou.db.MustBeginTx(ctx, nil)
+	defer tx.Rollback()
+
+	ord, err := (*ou.orderRepo).GetOrderByID(ctx, tx, uint64(order.GetId()))
+	if err != nil {
+		return err
+	}
+
+	var escrowTicker *ledgerRepository.Ticker
+	// the record still holds the size that was reserved, self-trade prevention may have shrunk the order since
+	amount := ord.Quantity - uint64(order.GetFilledQuantity())
+	if order.GetSide() == model.BID {
+		escrowTicker, err = (*ou.ledgerRepo).GetLedgerByTicker(ctx, tx, model.CASH_TICKER)
+		reserved := ord.Price * ord.Quantity
+		if ord.MaxNotional > 0 {
+			reserved = ord.MaxNotional
+		}
+		amount = reserved - order.GetSpentNotional()
+	} else {
+		escrowTicker, err = (*ou.ledgerRepo).GetLedgerByID(ctx, tx, ord.TickerID)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = ou.releaseToUser(ctx, tx, ord.UserID, escrowTicker, amount)
+	if err != nil {
+		return err
+	}
+	status := model.ORDER_STATUS_CANCELLED
+	if order.IsFilled() {
+		status = model.ORDER_STATUS_FILLED
+	}
+	err = (*ou.orderRepo).CloseOrder(ctx, tx, ord.ID, ou.clock.Now(), status)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// releaseReducedOrder hands back the escrow of the quantity self-trade prevention took off an
+// order and shrinks its record to match. A resting order stays open, one that filled everything
+// else is closed.
+func (ou *orderUseCaseImpl) releaseReducedOrder(ctx context.Context, order model.Order, reduced model.Quantity) error {
+	tx := ou.db.MustBeginTx(ctx, nil)
+	defer tx.Rollback()
+
+	ord, err := (*ou.orderRepo).GetOrderByID(ctx, tx, uint64(order.GetId()))
+	if err != nil {
+		return err
+	}
+	_, err = ou.applyReduction(ctx, tx, *ord, reduced)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// applyReduction shrinks the record of an order by reduced, closes it when that leaves nothing
+// open and releases the escrow that covered the reduced quantity. It returns what was released.
+func (ou *orderUseCaseImpl) applyReduction(ctx context.Context, tx *sqlx.Tx, record orderRepository.OrderRecord, reduced model.Quantity) (uint64, error) {
+	err := (*ou.orderRepo).ReduceOrder(ctx, tx, record.ID, uint64(reduced))
+	if err != nil {
+		return 0, fmt.Errorf("failed to update reduced order: %w", err)
+	}
+	err = (*ou.orderRepo).CloseFilledOrders(ctx, tx, []uint64{record.ID}, ou.clock.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	escrowTicker, err := (*ou.ledgerRepo).GetLedgerByID(ctx, tx, record.TickerID)
+	if model.Side(record.Side) == model.BID {
+		escrowTicker, err = (*ou.ledgerRepo).GetLedgerByTicker(ctx, tx, model.CASH_TICKER)
+	}
+	if err != nil {
+		return 0, err
+	}
+	amount := escrowHeld(model.Side(record.Side), model.Price(record.Price), reduced)
+	return amount, ou.releaseToUser(ctx, tx, record.UserID, escrowTicker, amount)
+}
+
+// releaseToUser moves amount from the escrow account of escrowTicker back to the user's account on that ledger.
+func (ou *orderUseCaseImpl) releaseToUser(ctx context.Context, tx *sqlx.Tx, userID int64, escrowTicker *ledgerRepository.Ticker, amount uint64) error {
+	if amount == 0 {
+		return nil
+	}
+	userAcct, err := (*ou.ledgerRepo).GetUserLedger(ctx, tx, userID, escrowTicker.ID)
+	if err != nil {
+		return err
+	}
+	userAcctTb, err := stringToUint128(userAcct.TBAccountID)
+	if err != nil {
+		return err
+	}
+	escrow, err := stringToUint128(escrowTicker.EscrowAccountID)
+	if err != nil {
+		return err
+	}
+	// same transfer shape as a reservation, only flowing from escrow back to the user
+	err = ou.reserveFunds(ctx, escrow, userAcctTb, ToUint128(amount), 2001, uint32(escrowTicker.TBLedgerID))
+	if err != nil {
+		return fmt.Errorf("escrow release failed: %w", err)
+	}
+	return nil
 }
 
 func (ou *orderUseCaseImpl) CancelOrder(ctx context.Context, orderID model.OrderId) error {
+	if err := ou.checkCancelAllowed(ctx, orderID); err != nil {
+		return err
+	}
+	return ou.cancelOrder(ctx, orderID, model.ORDER_STATUS_CANCELLED)
+}
+
+// cancelOrder pulls a resting order from its engine, releases the escrow held for the
+// unfilled part and closes the order with status. User cancels and expiry both end up here.
+func (ou *orderUseCaseImpl) cancelOrder(ctx context.Context, orderID model.OrderId, status model.OrderStatus) error {
 
 	// Start a transaction to update DB and possibly release funds
 	tx := ou.db.MustBeginTx(ctx, nil)
@@ -216,16 +742,41 @@ func (ou *orderUseCaseImpl) CancelOrder(ctx context.Context, orderID model.Order
 	if err != nil {
 		return err
 	}
-	// If order is not already closed and has remaining quantity, release any escrow reservation
-	if ord.IsActive && ord.Quantity > 0 {
-		// Identify asset vs currency based on side
-		tickerRec, _ := (*ou.ledgerRepo).GetLedgerByID(ctx, tx, ord.TickerID)
+	if !ord.IsActive {
+		return fmt.Errorf("order %d is already closed", orderID)
+	}
+
+	// Cancel in the matching engine first, so escrow is only released for an order that really left the book
+	tickerRec, err := (*ou.ledgerRepo).GetLedgerByID(ctx, tx, ord.TickerID)
+	if err != nil {
+		return err
+	}
+	// the engine's copy says what is left, the record may trail trades and reductions still being written
+	pulled, err := ou.getWorker(tickerType(tickerRec.Ticker)).PullOrder(orderID)
+	if err != nil {
+		return err
+	}
+
+	// If order has remaining quantity, release its escrow reservation
+	if pulled.GetRemainingQuantity() > 0 {
 		// Assume one quote currency as before
-		quoteRec, _ := (*ou.ledgerRepo).GetLedgerByTicker(ctx, tx, model.CASH_TICKER)
+		quoteRec, err := (*ou.ledgerRepo).GetLedgerByTicker(ctx, tx, model.CASH_TICKER)
+		if err != nil {
+			return err
+		}
 		userID := ord.UserID
-		if model.Side(ord.Side) == model.BID {
+		if pulled.GetSide() == model.BID && pulled.GetMaxNotional() > 0 {
+			// a stop-market buy reserved its notional cap rather than price * quantity
+			err = ou.releaseToUser(ctx, tx, userID, quoteRec, pulled.GetMaxNotional()-pulled.GetSpentNotional())
+			if err != nil {
+				return err
+			}
+		} else if pulled.GetSide() == model.BID {
 			// Release reserved currency: transfer from escrow back to user's cash account
-			userCashAcct, _ := (*ou.ledgerRepo).GetUserLedger(ctx, tx, userID, quoteRec.ID)
+			userCashAcct, err := (*ou.ledgerRepo).GetUserLedger(ctx, tx, userID, quoteRec.ID)
+			if err != nil {
+				return err
+			}
 			userCashAcctLedgerId, err := stringToUint128(userCashAcct.TBAccountID)
 			if err != nil {
 				return err
@@ -239,8 +790,8 @@ func (ou *orderUseCaseImpl) CancelOrder(ctx context.Context, orderID model.Order
 				model.BID,
 				userCashAcctLedgerId,
 				BigIntToUint128(*big.NewInt(0)),
-				model.Quantity(ord.Quantity),
-				model.Price(ord.Price),
+				pulled.GetRemainingQuantity(),
+				pulled.GetPrice(),
 				uint32(quoteRec.TBLedgerID),
 				fiatEscrow,
 			)
@@ -261,81 +812,194 @@ func (ou *orderUseCaseImpl) CancelOrder(ctx context.Context, orderID model.Order
 			if err != nil {
 				return err
 			}
-			_ = ou.releaseReservationBestEffort(
+			err = ou.releaseReservationBestEffort(
 				ctx,
 				model.ASK,
 				BigIntToUint128(*big.NewInt(0)),
 				userAssetAccountId,
-				model.Quantity(ord.Quantity),
-				model.Price(ord.Price),
-				uint32(quoteRec.TBLedgerID),
+				pulled.GetRemainingQuantity(),
+				pulled.GetPrice(),
+				uint32(tickerRec.TBLedgerID),
 				assetEscrowAccount,
 			)
+			if err != nil {
+				return err
+			}
 		}
 	}
-	// Cancel in the matching engine
-	err = (*ou.orderRepo).CloseOrder(ctx, tx, uint64(orderID), time.Now())
-	if err != nil {
-		return err
-	}
-	ledger, err := (*ou.ledgerRepo).GetLedgerByID(ctx, tx, ord.TickerID)
-	if err != nil {
-		return err
-	}
-	err = (*ou.getOrderbook(tickerType(ledger.Ticker))).CancelOrder(orderID)
+
+	err = (*ou.orderRepo).CloseOrder(ctx, tx, uint64(orderID), ou.clock.Now(), status)
 	if err != nil {
 		return err
 	}
 
-	tx.Commit()
-	return err
-
+	return tx.Commit()
 }
 
+// ModifyOrder amends a resting order to modify.Price and modify.Quantity, its new total
+// quantity. Escrow only moves by what the amend changes: a larger hold is topped up before the
+// engine sees the order, a smaller one releases the surplus once the amend is in place. The
+// engine decides whether the order keeps its queue position.
 func (ou *orderUseCaseImpl) ModifyOrder(ctx context.Context, modify model.OrderModify, orderType model.OrderType, ticker string) ([]*model.Trade, error) {
 	tx := ou.db.MustBeginTx(ctx, nil)
 	defer tx.Rollback()
-	// Fetch the current order record
 	ordRec, err := (*ou.orderRepo).GetOrderByID(ctx, tx, uint64(modify.ID))
 	if err != nil {
 		return nil, fmt.Errorf("order not found: %w", err)
 	}
-
-	// 2. Update order record with new parameters
-	ordRec.Price = uint64(modify.Price)
-	ordRec.Quantity = uint64(modify.Quantity)
-	ordRec.Side = int8(modify.Side)
-	ordRec.Type = uint8(orderType)
-	// (Reset is_active in case it was closed due to partial fill; ensure it's open for the new order)
-	ordRec.IsActive = true
-
-	err = (*ou.orderRepo).UpdateOrder(ctx, tx, *ordRec)
-	if err != nil {
-		return nil, fmt.Errorf("failed to update order: %w", err)
+	if !ordRec.IsActive {
+		return nil, fmt.Errorf("order %d is already closed", modify.ID)
 	}
-
-	err = ou.CancelOrder(ctx, modify.ID)
+	tickerRec, err := (*ou.ledgerRepo).GetLedgerByID(ctx, tx, ordRec.TickerID)
 	if err != nil {
 		return nil, err
 	}
-
-	_, _, err = ou.AddOrder(ctx, ticker, modify.Side, modify.Price, modify.Quantity, orderType)
-	if err != nil {
+	if tickerRec.Ticker != ticker {
+		return nil, fmt.Errorf("order %d does not trade on %s", modify.ID, ticker)
+	}
+	if err := ou.getWorker(tickerType(ticker)).GetTickerState().Status.CheckOrder(ticker); err != nil {
 		return nil, err
 	}
-	// 3. Submit the updated order to engine
-	trades, err := (*ou.getOrderbook(tickerType(ticker))).ModifyOrder(modify, orderType)
+	// an amend never changes sides
+	modify.Side = model.Side(ordRec.Side)
+	// a modify that breaks the instrument rules must not cost the order its place
+	err = InstrumentRules(tickerRec).Check(model.InstrumentOrder{
+		Side:     modify.Side,
+		Type:     orderType,
+		Price:    modify.Price,
+		Quantity: modify.Quantity,
+		PeakSize: model.Quantity(ordRec.PeakSize),
+	})
 	if err != nil {
 		return nil, err
 	}
-	tx.Commit()
+
+	worker := ou.getWorker(tickerType(ticker))
+	current, ok := worker.GetOrder(modify.ID)
+	if !ok {
+		return nil, fmt.Errorf("order %d is not on the book", modify.ID)
+	}
+	filled := current.GetFilledQuantity()
+	if modify.Quantity <= filled {
+		return nil, fmt.Errorf("order %d filled %d already, it cannot be amended to %d", modify.ID, filled, modify.Quantity)
+	}
+
+	escrowTicker := tickerRec
+	if modify.Side == model.BID {
+		escrowTicker, err = (*ou.ledgerRepo).GetLedgerByTicker(ctx, tx, model.CASH_TICKER)
+		if err != nil {
+			return nil, err
+		}
+	}
+	reserve, release := amendEscrow(current, modify)
+	if reserve > 0 {
+		if err := ou.reserveFromUser(ctx, tx, ordRec.UserID, escrowTicker, reserve); err != nil {
+			return nil, fmt.Errorf("reserving for the amend failed: %w", err)
+		}
+	}
+
+	// the escrow above is worked out from the order as it was read, so the amend only goes
+	// ahead if nothing traded against it in between
+	var events []model.Event
+	var amendErr error
+	changed := false
+	worker.SubmitQuery(func(orderbook engine.OrderBookEngine) {
+		now, ok := orderbook.GetOrder(modify.ID)
+		if !ok || now.GetFilledQuantity() != filled || now.GetInitialQuantity() != current.GetInitialQuantity() {
+			changed = true
+			return
+		}
+		events, amendErr = orderbook.ModifyOrder(modify, orderType)
+	}).Wait()
+	trades := model.TradesOf(events)
+	if changed {
+		amendErr = fmt.Errorf("order %d traded while it was being amended, try again", modify.ID)
+	}
+	if amendErr != nil {
+		if reserve > 0 {
+			if err := ou.releaseToUser(ctx, tx, ordRec.UserID, escrowTicker, reserve); err != nil {
+				log.Printf("order %d: releasing escrow of a failed amend: %v", modify.ID, err)
+			}
+		}
+		return nil, amendErr
+	}
+
+	// self-trade prevention or a circuit breaker may have cancelled the order as it came back,
+	// what its trades do not settle goes back as well
+	cancelled := cancelledIn(events, modify.ID)
+	quantity := modify.Quantity
+	if cancelled {
+		traded, _ := tradedBy(trades, modify.ID)
+		release += escrowHeld(modify.Side, modify.Price, modify.Quantity-filled-traded)
+	} else if reduced := reducedIn(events, modify.ID); reduced > 0 {
+		// self-trade prevention shrank it instead, the record takes the smaller size
+		release += escrowHeld(modify.Side, modify.Price, reduced)
+		quantity -= reduced
+	}
+	if err := ou.releaseToUser(ctx, tx, ordRec.UserID, escrowTicker, release); err != nil {
+		return trades, err
+	}
+	err = (*ou.orderRepo).AmendOrder(ctx, tx, uint64(modify.ID), uint64(modify.Price), uint64(quantity))
+	if err != nil {
+		return trades, fmt.Errorf("failed to update order: %w", err)
+	}
+	if cancelled {
+		err = (*ou.orderRepo).CloseOrder(ctx, tx, uint64(modify.ID), ou.clock.Now(), model.ORDER_STATUS_CANCELLED)
+		if err != nil {
+			return trades, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return trades, err
+	}
 
 	err = ou.settleTrades(ctx, trades, tickerType(ticker))
 	if err != nil {
-		return nil, err
+		return trades, err
 	}
+	return trades, nil
+}
 
-	return make([]*model.Trade, 0), nil
+// amendEscrow is how escrow moves when current, with its fills, is amended to modify: reserve
+// is topped up before the amend, release handed back after it. At most one of them is non-zero.
+func amendEscrow(current model.Order, modify model.OrderModify) (reserve, release uint64) {
+	filled := current.GetFilledQuantity()
+	before := escrowHeld(modify.Side, current.GetPrice(), current.GetInitialQuantity()-filled)
+	after := escrowHeld(modify.Side, modify.Price, modify.Quantity-filled)
+	if after > before {
+		return after - before, 0
+	}
+	return 0, before - after
+}
+
+// escrowHeld is what an order holds in escrow for quantity still open at price: cash for a
+// bid, the asset itself for an ask.
+func escrowHeld(side model.Side, price model.Price, quantity model.Quantity) uint64 {
+	if side == model.BID {
+		return uint64(price) * uint64(quantity)
+	}
+	return uint64(quantity)
+}
+
+// reserveFromUser moves amount from the user's account on the ledger of escrowTicker into its escrow account.
+func (ou *orderUseCaseImpl) reserveFromUser(ctx context.Context, tx *sqlx.Tx, userID int64, escrowTicker *ledgerRepository.Ticker, amount uint64) error {
+	userAcct, err := (*ou.ledgerRepo).GetUserLedger(ctx, tx, userID, escrowTicker.ID)
+	if err != nil {
+		return err
+	}
+	userAcctTb, err := stringToUint128(userAcct.TBAccountID)
+	if err != nil {
+		return err
+	}
+	escrow, err := stringToUint128(escrowTicker.EscrowAccountID)
+	if err != nil {
+		return err
+	}
+	code := uint16(1002)
+	if escrowTicker.Ticker == model.CASH_TICKER {
+		code = 1001
+	}
+	return ou.reserveFunds(ctx, userAcctTb, escrow, ToUint128(amount), code, uint32(escrowTicker.TBLedgerID))
 }
 
 func (ou *orderUseCaseImpl) OrderSize(ctx context.Context, ticker string) int {
@@ -356,6 +1020,22 @@ func (ou *orderUseCaseImpl) GetOrderInfos(ctx context.Context, ticker string) *m
 
 }
 
+// GetMarketDepth aggregates up to levels price levels of ticker, 0 for full depth, grouping
+// prices into buckets of ticks tick sizes.
+func (ou *orderUseCaseImpl) GetMarketDepth(ctx context.Context, ticker string, levels int, ticks uint64) (*model.MarketDepth, error) {
+	bucket := model.Price(max(ticks, 1))
+	if ticks > 1 {
+		tx := ou.db.MustBeginTx(ctx, nil)
+		defer tx.Rollback()
+		tickerRec, err := (*ou.ledgerRepo).GetLedgerByTicker(ctx, tx, ticker)
+		if err != nil {
+			return nil, err
+		}
+		bucket *= model.Price(max(tickerRec.TickSize, 1))
+	}
+	return ou.getWorker(tickerType(ticker)).GetMarketDepth(levels, bucket), nil
+}
+
 func (ou *orderUseCaseImpl) GetTickerList(ctx context.Context) ([]*ledgerRepository.Ticker, error) {
 	tx := ou.db.MustBeginTx(ctx, nil)
 	tickerList, err := (*ou.ledgerRepo).ListLedgers(ctx, tx)
@@ -506,34 +1186,31 @@ func (ou *orderUseCaseImpl) settleTrades(ctx context.Context, matchedTrades []*m
 
 	tbTransfer := make([]Transfer, 0, 2*len(matchedTrades))
 	createTrades := make([]orderRepository.TradeRecord, 0, 2*len(matchedTrades))
-	closeOrders := make([]uint64, 0, 2*len(matchedTrades))
+	tradedOrders := make([]uint64, 0, 2*len(matchedTrades))
 	for _, tr := range matchedTrades {
-		takerOrderID := tr.TakerID
-		makerOrderID := tr.MakerID
+		// cash goes to the seller and the asset to the buyer, whichever of them took liquidity
 		var buyerAssetAcct, sellerCashAcct *ledgerRepository.UserLedger
 
-		makerOrderRec, err := (*ou.orderRepo).GetOrderByID(ctx, tx, uint64(makerOrderID))
+		buyOrderRec, err := (*ou.orderRepo).GetOrderByID(ctx, tx, uint64(tr.BuyOrderID))
 		if err != nil {
-			log.Printf("settlement error: get order maker %v", err)
+			log.Printf("settlement error: get buy order %v", err)
 
 			return err
 		}
-		makerUserId := makerOrderRec.UserID
-		takerOrderRec, err := (*ou.orderRepo).GetOrderByID(ctx, tx, uint64(takerOrderID))
+		sellOrderRec, err := (*ou.orderRepo).GetOrderByID(ctx, tx, uint64(tr.SellOrderID))
 		if err != nil {
-			log.Printf("settlement error: get order taker %v", err)
+			log.Printf("settlement error: get sell order %v", err)
 
 			return err
 		}
-		takerUserID := takerOrderRec.UserID
 
-		buyerAssetAcct, err = (*ou.ledgerRepo).GetUserLedger(ctx, tx, takerUserID, assetTicker.ID)
+		buyerAssetAcct, err = (*ou.ledgerRepo).GetUserLedger(ctx, tx, buyOrderRec.UserID, assetTicker.ID)
 		if err != nil {
 			log.Printf("settlement error: get user ledger asset %v", err)
 
 			return err
 		}
-		sellerCashAcct, err = (*ou.ledgerRepo).GetUserLedger(ctx, tx, makerUserId, quoteTicker.ID)
+		sellerCashAcct, err = (*ou.ledgerRepo).GetUserLedger(ctx, tx, sellOrderRec.UserID, quoteTicker.ID)
 		if err != nil {
 			log.Printf("settlement error: get user ledger cash %v", err)
 
@@ -590,38 +1267,25 @@ func (ou *orderUseCaseImpl) settleTrades(ctx context.Context, matchedTrades []*m
 
 		// Record the trade in the database
 		tradeRecord := orderRepository.TradeRecord{
+			ID:               tr.ID,
 			TickerID:         assetTicker.ID, // asset ticker ID
 			OrderTakerID:     uint64(tr.TakerID),
 			OrderMakerID:     uint64(tr.MakerID),
 			LedgerTransferID: &transferTbId,
 			UserLedgerID:     sellerCashAcct.ID,
 			TickerLedgerID:   buyerAssetAcct.ID,
+			Type:             uint8(tr.Side), // aggressor side
 			Quantity:         uint64(tr.Quantity),
 			Price:            uint64(tr.Price),
 		}
 		createTrades = append(createTrades, tradeRecord)
 
-		// Close fully-filled orders: if the taker or maker order is now completely filled, mark as closed
-		// (Check in-memory: engine already removed filled orders. We can also compare filled qty vs initial)
-
-		isMakerOrderFilled := makerOrderRec.GetRemaining() == tradeRecord.Quantity
-		if !isMakerOrderFilled {
-			err = (*ou.orderRepo).UpdateFilled(ctx, tx, makerOrderRec.ID, tradeRecord.Quantity)
-			if err != nil {
-				return err
-			}
-		} else {
-			closeOrders = append(closeOrders, makerOrderRec.ID)
-		}
-		// return err
-		isTakerOrderFilled := takerOrderRec.GetRemaining() == tradeRecord.Quantity
-		if !isTakerOrderFilled {
-			err = (*ou.orderRepo).UpdateFilled(ctx, tx, takerOrderRec.ID, tradeRecord.Quantity)
+		for _, rec := range []*orderRepository.OrderRecord{buyOrderRec, sellOrderRec} {
+			err = (*ou.orderRepo).UpdateFilled(ctx, tx, rec.ID, tradeRecord.Quantity)
 			if err != nil {
 				return err
 			}
-		} else {
-			closeOrders = append(closeOrders, takerOrderRec.ID)
+			tradedOrders = append(tradedOrders, rec.ID)
 		}
 	}
 
@@ -634,9 +1298,10 @@ func (ou *orderUseCaseImpl) settleTrades(ctx context.Context, matchedTrades []*m
 		return fmt.Errorf("settlement transfer failures: %+v", results)
 	}
 
-	closeTradeErrs := (*ou.orderRepo).CloseOrders(ctx, tx, closeOrders, time.Now())
+	// close what is now fully filled, judged on the rows so a reduction committed meanwhile counts
+	closeTradeErrs := (*ou.orderRepo).CloseFilledOrders(ctx, tx, tradedOrders, ou.clock.Now())
 	if closeTradeErrs != nil {
-		return fmt.Errorf("inserting trade: %w", closeTradeErrs)
+		return fmt.Errorf("closing filled orders: %w", closeTradeErrs)
 	}
 	err = (*ou.orderRepo).CreateTrades(ctx, tx, createTrades)
 	if err != nil {
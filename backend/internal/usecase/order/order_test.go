@@ -0,0 +1,118 @@
+package order
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Yusufzhafir/go-orderbook/backend/pkg/model"
+)
+
+// TestAddOrderRejectsUnknownTypes runs AddOrder on a use case without a database, ledger or
+// engine, so an order that gets past validation fails the test instead of being rejected.
+func TestAddOrderRejectsUnknownTypes(t *testing.T) {
+	tests := []struct {
+		name      string
+		orderType model.OrderType
+		opts      AddOrderOpts
+	}{
+		{
+			name:      "order type past the last one",
+			orderType: model.ORDER_DAY + 1,
+		},
+		{
+			name:      "largest order type",
+			orderType: 255,
+		},
+		{
+			name:      "post-only mode past the last one",
+			orderType: model.ORDER_GOOD_TILL_CANCEL,
+			opts:      AddOrderOpts{PostOnly: model.POST_ONLY_REPRICE + 1},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ou := &orderUseCaseImpl{}
+			result, err := ou.AddOrder(context.Background(), "TEST", model.BID, 100, 1, test.orderType, test.opts)
+			if err == nil {
+				t.Fatalf("AddOrder accepted the order as %+v", result)
+			}
+		})
+	}
+}
+
+func TestAmendEscrow(t *testing.T) {
+	tests := []struct {
+		name        string
+		side        model.Side
+		filled      model.Quantity // of the current order, 10 at 100
+		modify      model.OrderModify
+		wantReserve uint64
+		wantRelease uint64
+	}{
+		{
+			name:        "bid grows",
+			side:        model.BID,
+			modify:      model.OrderModify{Price: 100, Quantity: 15},
+			wantReserve: 500,
+		},
+		{
+			name:        "bid shrinks",
+			side:        model.BID,
+			modify:      model.OrderModify{Price: 100, Quantity: 4},
+			wantRelease: 600,
+		},
+		{
+			name:        "bid reprices up",
+			side:        model.BID,
+			modify:      model.OrderModify{Price: 110, Quantity: 10},
+			wantReserve: 100,
+		},
+		{
+			name:        "bid reprices down and grows",
+			side:        model.BID,
+			modify:      model.OrderModify{Price: 50, Quantity: 16},
+			wantRelease: 200,
+		},
+		{
+			name:        "fills are already settled and not held",
+			side:        model.BID,
+			filled:      6,
+			modify:      model.OrderModify{Price: 110, Quantity: 10},
+			wantReserve: 40,
+		},
+		{
+			name:        "ask holds the asset whatever the price",
+			side:        model.ASK,
+			modify:      model.OrderModify{Price: 200, Quantity: 7},
+			wantRelease: 3,
+		},
+		{
+			name:        "ask grows after fills",
+			side:        model.ASK,
+			filled:      4,
+			modify:      model.OrderModify{Price: 90, Quantity: 12},
+			wantReserve: 2,
+		},
+		{
+			name:   "unchanged",
+			side:   model.ASK,
+			modify: model.OrderModify{Price: 100, Quantity: 10},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			current := model.NewOrder(1, test.side, 100, 10, model.ORDER_GOOD_TILL_CANCEL)
+			if err := current.Fill(test.filled); err != nil {
+				t.Fatal(err)
+			}
+			modify := test.modify
+			modify.ID, modify.Side = 1, test.side
+			reserve, release := amendEscrow(current, modify)
+			if reserve != test.wantReserve || release != test.wantRelease {
+				t.Errorf("amendEscrow reserves %d and releases %d, want %d and %d", reserve, release, test.wantReserve, test.wantRelease)
+			}
+		})
+	}
+}
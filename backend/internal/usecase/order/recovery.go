@@ -0,0 +1,103 @@
+package order
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	orderRepository "github.com/Yusufzhafir/go-orderbook/backend/internal/repository/order"
+	"github.com/Yusufzhafir/go-orderbook/backend/pkg/model"
+)
+
+// RebuildFromActiveOrders seeds the engines with every order Postgres still has open, oldest
+// first so queue priority survives the restart. Orders an engine already holds, from a snapshot
+// or its journal, are left alone. Their funds are already in escrow, so nothing is reserved and
+// nothing is matched. An order that cannot go back on the book is logged and stays open in
+// Postgres for an operator to look at.
+func (ou *orderUseCaseImpl) RebuildFromActiveOrders(ctx context.Context) error {
+	tx := ou.db.MustBeginTx(ctx, nil)
+	records, err := (*ou.orderRepo).ListActiveOrders(ctx, tx)
+	tx.Rollback()
+	if err != nil {
+		return fmt.Errorf("listing active orders: %w", err)
+	}
+
+	stpModes := make(map[int64]model.SelfTradePrevention)
+	restored := make(map[string]int)
+	for _, rec := range records {
+		worker := ou.getWorker(tickerType(rec.Ticker))
+		if _, ok := worker.GetOrder(model.OrderId(rec.ID)); ok {
+			continue
+		}
+
+		order, ok := restingOrderFromRecord(rec)
+		if !ok {
+			log.Printf("ticker %s: order %d of type %d cannot be open, not restored", rec.Ticker, rec.ID, rec.Type)
+			continue
+		}
+		mode, ok := stpModes[rec.UserID]
+		if !ok {
+			mode = ou.accountSelfTradePrevention(ctx, rec.UserID)
+			stpModes[rec.UserID] = mode
+		}
+		order.SetSelfTradePrevention(mode)
+
+		if err := worker.RestoreOrder(order); err != nil {
+			log.Printf("ticker %s: restoring order %d: %v", rec.Ticker, rec.ID, err)
+			continue
+		}
+		restored[rec.Ticker]++
+	}
+	for ticker, count := range restored {
+		log.Printf("ticker %s: %d active orders restored from postgres", ticker, count)
+	}
+	return nil
+}
+
+// restingOrderFromRecord builds the engine order of an open record, with what it filled already
+// applied. A stop recorded as triggered comes back as the order it turned into, any other
+// waits for its stop price again.
+func restingOrderFromRecord(rec orderRepository.OrderRecordWithTicker) (model.Order, bool) {
+	id := model.OrderId(rec.ID)
+	side := model.Side(rec.Side)
+	price := model.Price(rec.Price)
+	orderType := model.OrderType(rec.Type)
+
+	var order model.Order
+	switch {
+	case orderType.IsStop():
+		order = model.NewStopOrder(id, side, model.Price(rec.StopPrice), price, model.Quantity(rec.Quantity), orderType, rec.MaxNotional)
+		if rec.Triggered {
+			order.Trigger()
+		}
+	case orderType.RestsOnBook():
+		order = model.NewOrder(id, side, price, model.Quantity(rec.Quantity), orderType)
+	default:
+		return model.Order{}, false
+	}
+	if !order.GetType().IsStop() && !order.GetType().RestsOnBook() {
+		return model.Order{}, false
+	}
+
+	if err := order.FillAt(model.Quantity(rec.Filled), price); err != nil {
+		return model.Order{}, false
+	}
+	if rec.PeakSize > 0 {
+		order.SetPeakSize(model.Quantity(rec.PeakSize))
+	}
+	order.SetOwner(rec.UserID)
+	return order, true
+}
+
+// accountSelfTradePrevention is the self-trade prevention mode set on the account, none when it cannot be read.
+func (ou *orderUseCaseImpl) accountSelfTradePrevention(ctx context.Context, userID int64) model.SelfTradePrevention {
+	if ou.userRepo == nil {
+		return model.STP_NONE
+	}
+	user, err := (*ou.userRepo).GetByID(ctx, userID)
+	if err != nil {
+		log.Printf("user %d: reading self-trade prevention: %v", userID, err)
+		return model.STP_NONE
+	}
+	return model.SelfTradePrevention(user.STPMode)
+}
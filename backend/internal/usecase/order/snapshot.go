@@ -0,0 +1,112 @@
+package order
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Yusufzhafir/go-orderbook/backend/internal/engine"
+)
+
+// SNAPSHOT_EXT is the extension of the per ticker snapshot files, named <ticker>.snap.
+const SNAPSHOT_EXT = ".snap"
+
+// RunSnapshotter writes a snapshot of every running engine to dir each interval until ctx is done.
+func (ou *orderUseCaseImpl) RunSnapshotter(ctx context.Context, dir string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := ou.WriteSnapshots(dir); err != nil {
+				log.Printf("writing order book snapshots: %v", err)
+			}
+		}
+	}
+}
+
+// WriteSnapshots writes a snapshot of every running engine to dir. Each file is written to a
+// temporary name first and renamed, so a crash never leaves a half written snapshot behind.
+// A journal the snapshot covers is emptied afterwards.
+func (ou *orderUseCaseImpl) WriteSnapshots(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	ou.engineMu.Lock()
+	tickers := make([]tickerType, 0, len(ou.orderBookEngineMap))
+	for ticker := range ou.orderBookEngineMap {
+		tickers = append(tickers, ticker)
+	}
+	ou.engineMu.Unlock()
+
+	for _, ticker := range tickers {
+		if err := ou.writeSnapshot(dir, ticker); err != nil {
+			return fmt.Errorf("ticker %s: %w", ticker, err)
+		}
+	}
+	return nil
+}
+
+// writeSnapshot saves the book of ticker and then empties its journal, all on the worker so no
+// command slips in between. Should the truncate fail, replay skips what the snapshot covers.
+func (ou *orderUseCaseImpl) writeSnapshot(dir string, ticker tickerType) error {
+	ou.engineMu.Lock()
+	journal := ou.journals[ticker]
+	ou.engineMu.Unlock()
+
+	var err error
+	path := filepath.Join(dir, string(ticker)+SNAPSHOT_EXT)
+	_, stopped := ou.getWorker(ticker).SubmitQuery(func(orderbook engine.OrderBookEngine) {
+		var data []byte
+		if data, err = orderbook.Snapshot(); err != nil {
+			return
+		}
+		if err = os.WriteFile(path+".tmp", data, 0o644); err != nil {
+			return
+		}
+		if err = os.Rename(path+".tmp", path); err != nil {
+			return
+		}
+		if journal != nil {
+			err = journal.Truncate()
+		}
+	}).Wait()
+	if stopped != nil {
+		return stopped
+	}
+	return err
+}
+
+// RestoreSnapshots loads every snapshot in dir into the engine of its ticker. Books come back
+// as they were when the snapshot was taken, a missing dir just means there is nothing to restore.
+func (ou *orderUseCaseImpl) RestoreSnapshots(ctx context.Context, dir string) error {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), SNAPSHOT_EXT) {
+			continue
+		}
+		ticker := tickerType(strings.TrimSuffix(entry.Name(), SNAPSHOT_EXT))
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return fmt.Errorf("ticker %s: %w", ticker, err)
+		}
+		if err := ou.getWorker(ticker).Restore(data); err != nil {
+			return fmt.Errorf("ticker %s: %w", ticker, err)
+		}
+		log.Printf("ticker %s: order book restored from snapshot", ticker)
+	}
+	return nil
+}
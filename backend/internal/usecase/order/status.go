@@ -0,0 +1,112 @@
+package order
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	ledgerRepository "github.com/Yusufzhafir/go-orderbook/backend/internal/repository/ledger"
+	"github.com/Yusufzhafir/go-orderbook/backend/pkg/model"
+)
+
+// StatusHandler is told when an operator changes the status of a ticker.
+type StatusHandler func(model.TickerStatusChange)
+
+func (ou *orderUseCaseImpl) RegisterStatusHandler(handler StatusHandler) {
+	ou.statusHandler = handler
+}
+
+// SetTickerStatus moves ticker to status. The engine holds the status and decides what it
+// admits, the ticker table keeps it for a restart; the row is only committed once the engine
+// took the change. Closing the ticker cancels every open order of it, stops included, and
+// their escrow is released as the engine drops them.
+func (ou *orderUseCaseImpl) SetTickerStatus(ctx context.Context, ticker string, status model.TickerStatus) (*model.TickerStatusChange, error) {
+	tx := ou.db.MustBeginTx(ctx, nil)
+	defer tx.Rollback()
+	if _, err := (*ou.ledgerRepo).GetLedgerByTicker(ctx, tx, ticker); err != nil {
+		return nil, err
+	}
+	if err := (*ou.ledgerRepo).UpdateTradingStatus(ctx, tx, ticker, status.String()); err != nil {
+		return nil, err
+	}
+	if _, err := ou.getWorker(tickerType(ticker)).SetTickerStatus(status); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("ticker %s is %s but storing it failed: %w", ticker, status, err)
+	}
+	change := &model.TickerStatusChange{Ticker: ticker, Status: status, Time: ou.clock.Now()}
+	log.Printf("ticker %s: status %s", ticker, status)
+
+	if ou.statusHandler != nil {
+		ou.statusHandler(*change)
+	}
+	return change, nil
+}
+
+// GetTickerState is what ticker takes right now, as its engine admits it.
+func (ou *orderUseCaseImpl) GetTickerState(ctx context.Context, ticker string) (*model.TickerState, error) {
+	tx := ou.db.MustBeginTx(ctx, nil)
+	defer tx.Rollback()
+	if _, err := (*ou.ledgerRepo).GetLedgerByTicker(ctx, tx, ticker); err != nil {
+		return nil, err
+	}
+	state := ou.getWorker(tickerType(ticker)).GetTickerState()
+	return &state, nil
+}
+
+// RestoreTickerStatuses gives every engine the status stored on its ticker where the engine's
+// snapshot and journal left it with another one, so a restart without them keeps a halted or
+// closed ticker that way. It runs after the journals are replayed and before the open orders
+// are rebuilt, which a closed ticker refuses.
+func (ou *orderUseCaseImpl) RestoreTickerStatuses(ctx context.Context) error {
+	tickers, err := ou.GetTickerList(ctx)
+	if err != nil {
+		return fmt.Errorf("listing tickers: %w", err)
+	}
+	for _, rec := range tickers {
+		if rec.Ticker == model.CASH_TICKER {
+			continue
+		}
+		status := tickerStatus(rec)
+		if status == model.TICKER_STATUS_OPEN && !ou.hasWorker(tickerType(rec.Ticker)) {
+			continue
+		}
+		worker := ou.getWorker(tickerType(rec.Ticker))
+		if worker.GetTickerState().Operator == status {
+			continue
+		}
+		if _, err := worker.SetTickerStatus(status); err != nil {
+			return fmt.Errorf("ticker %s: restoring status %s: %w", rec.Ticker, status, err)
+		}
+		log.Printf("ticker %s: status %s restored from postgres", rec.Ticker, status)
+	}
+	return nil
+}
+
+// checkCancelAllowed refuses a user cancel of orderID when the status of its ticker does. Cancels
+// the engine, expiry or a close make are not checked.
+func (ou *orderUseCaseImpl) checkCancelAllowed(ctx context.Context, orderID model.OrderId) error {
+	tx := ou.db.MustBeginTx(ctx, nil)
+	defer tx.Rollback()
+	ord, err := (*ou.orderRepo).GetOrderByID(ctx, tx, uint64(orderID))
+	if err != nil {
+		return err
+	}
+	tickerRec, err := (*ou.ledgerRepo).GetLedgerByID(ctx, tx, ord.TickerID)
+	if err != nil {
+		return err
+	}
+	return ou.getWorker(tickerType(tickerRec.Ticker)).GetTickerState().Status.CheckCancel(tickerRec.Ticker)
+}
+
+// tickerStatus is the status stored on the ticker. A value that cannot be parsed counts as
+// halted, so a bad write stops the ticker rather than opening it.
+func tickerStatus(ticker *ledgerRepository.Ticker) model.TickerStatus {
+	status, err := model.TickerStatusByName(ticker.TradingStatus)
+	if err != nil {
+		log.Printf("ticker %s: %v, treating it as halted", ticker.Ticker, err)
+		return model.TICKER_STATUS_HALTED
+	}
+	return status
+}
@@ -22,6 +22,7 @@ type UserUseCase interface {
 	GetProfile(ctx context.Context, userID int64) (*UserProfile, error)
 	GetUserLedger(ctx context.Context, userID int64, ledgerID int64) (*ledger.UserLedger, error)
 	TopupMoney(ctx context.Context, userId int64, amount *big.Int) error
+	SetSelfTradePrevention(ctx context.Context, userID int64, mode model.SelfTradePrevention) error
 }
 
 type userUseCaseImpl struct {
@@ -214,3 +215,11 @@ func (uc *userUseCaseImpl) TopupMoney(ctx context.Context, userId int64, amount
 
 	return nil
 }
+
+// SetSelfTradePrevention sets the mode used by the user's orders that do not pick one themselves.
+func (uc *userUseCaseImpl) SetSelfTradePrevention(ctx context.Context, userID int64, mode model.SelfTradePrevention) error {
+	if mode > model.STP_DECREMENT_AND_CANCEL {
+		return fmt.Errorf("unknown self-trade prevention mode %d", mode)
+	}
+	return (*uc.repo).UpdateSTPMode(ctx, userID, uint8(mode))
+}
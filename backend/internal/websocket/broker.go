@@ -34,8 +34,9 @@ type Trade struct {
 }
 
 type publishMsg struct {
-	Topic string
-	Data  []byte
+	Topic   string
+	Data    []byte
+	Control bool // never dropped, a client too slow to take it is evicted instead
 }
 
 type subscription struct {
@@ -53,6 +54,7 @@ type Hub struct {
 
 	clients map[*Client]struct{}
 	topics  map[string]map[*Client]struct{}
+	done    chan struct{} // closed once Run returns
 
 	// Configuration
 	sendBuf int
@@ -87,6 +89,7 @@ func NewHub(logger *log.Logger) *Hub {
 		publish:     make(chan publishMsg, defaultPublishBuf),
 		clients:     make(map[*Client]struct{}),
 		topics:      make(map[string]map[*Client]struct{}),
+		done:        make(chan struct{}),
 		sendBuf:     defaultSendBuf,
 		logger:      logger,
 	}
@@ -96,6 +99,7 @@ func NewHub(logger *log.Logger) *Hub {
 // The hub stops when ctx is cancelled.
 func (h *Hub) Run(ctx context.Context) {
 	h.logger.Println("ws hub started")
+	defer close(h.done)
 	for {
 		select {
 		case c := <-h.register:
@@ -137,56 +141,12 @@ func (h *Hub) Run(ctx context.Context) {
 			if p.Topic == "" {
 				// broadcast to all clients
 				for c := range h.clients {
-					select {
-					case c.send <- p.Data:
-					default:
-						atomic.AddUint64(&h.publishDrops, 1)
-						c.drops++
-						if c.drops > maxConsecutiveDrops {
-							h.logger.Printf(
-								"evicting slow client after %d drops", c.drops,
-							)
-							delete(h.clients, c)
-							for t := range c.subscribed {
-								if s := h.topics[t]; s != nil {
-									delete(s, c)
-									if len(s) == 0 {
-										delete(h.topics, t)
-									}
-								}
-							}
-							close(c.send)
-							_ = c.conn.Close()
-						}
-					}
+					h.deliver(c, p)
 				}
 			} else {
 				// publish to a topic (symbol)
-				if subs := h.topics[p.Topic]; subs != nil {
-					for c := range subs {
-						select {
-						case c.send <- p.Data:
-						default:
-							atomic.AddUint64(&h.publishDrops, 1)
-							c.drops++
-							if c.drops > maxConsecutiveDrops {
-								h.logger.Printf(
-									"evicting slow client after %d drops", c.drops,
-								)
-								delete(h.clients, c)
-								for t := range c.subscribed {
-									if s := h.topics[t]; s != nil {
-										delete(s, c)
-										if len(s) == 0 {
-											delete(h.topics, t)
-										}
-									}
-								}
-								close(c.send)
-								_ = c.conn.Close()
-							}
-						}
-					}
+				for c := range h.topics[p.Topic] {
+					h.deliver(c, p)
 				}
 			}
 
@@ -203,6 +163,37 @@ func (h *Hub) Run(ctx context.Context) {
 	}
 }
 
+// deliver queues p for c. A client whose buffer is full misses market data, and is evicted
+// after too many misses in a row or at once for a control message it cannot take.
+func (h *Hub) deliver(c *Client, p publishMsg) {
+	select {
+	case c.send <- p.Data:
+		return
+	default:
+	}
+	atomic.AddUint64(&h.publishDrops, 1)
+	c.drops++
+	if p.Control || c.drops > maxConsecutiveDrops {
+		h.logger.Printf("evicting slow client after %d drops", c.drops)
+		h.evict(c)
+	}
+}
+
+// evict drops c from the hub and closes its connection.
+func (h *Hub) evict(c *Client) {
+	delete(h.clients, c)
+	for t := range c.subscribed {
+		if s := h.topics[t]; s != nil {
+			delete(s, c)
+			if len(s) == 0 {
+				delete(h.topics, t)
+			}
+		}
+	}
+	close(c.send)
+	_ = c.conn.Close()
+}
+
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
@@ -369,13 +360,61 @@ func (h *Hub) PublishTrade(t Trade) {
 		h.logger.Printf("marshal trade: %v", err)
 		return
 	}
+	h.send(publishMsg{Topic: t.Symbol, Data: b})
+}
+
+// PublishAuction publishes the indicative price and volume of a running auction to subscribers
+// of its ticker. Dropped like trades when the hub is backed up.
+func (h *Hub) PublishAuction(a model.AuctionIndication) {
+	h.publishMessage(a.Ticker, "auction", a, false)
+}
+
+// PublishHalt tells subscribers of the ticker that a circuit breaker halted it. It is never dropped.
+func (h *Hub) PublishHalt(halt model.Halt) {
+	h.publishMessage(halt.Ticker, "halt", halt, true)
+}
+
+// PublishStatus tells subscribers of the ticker that an operator changed its status. It is
+// never dropped.
+func (h *Hub) PublishStatus(change model.TickerStatusChange) {
+	h.publishMessage(change.Ticker, "status", change, true)
+}
+
+// PublishEvent publishes an engine event to subscribers of its ticker, stripped of order IDs.
+// The event keeps the engine's own sequence, the message is numbered like every other message
+// of the ticker.
+func (h *Hub) PublishEvent(event model.Event) {
+	h.publishMessage(event.Ticker, "event", event.Public(), false)
+}
+
+// publishMessage sends body to the subscribers of topic as {"type": kind, kind: body, "seq": n},
+// numbered by the topic's one sequence, so a gap in seq means a message was missed. Control
+// messages are never dropped, see send.
+func (h *Hub) publishMessage(topic, kind string, body any, control bool) {
+	b, err := json.Marshal(map[string]any{"type": kind, kind: body, "seq": nextSeq(topic)})
+	if err != nil {
+		h.logger.Printf("marshal %s: %v", kind, err)
+		return
+	}
+	h.send(publishMsg{Topic: topic, Data: b, Control: control})
+}
 
+// send hands p to the hub. Market data is dropped when the hub is backed up, a control message
+// waits for it unless the hub has stopped.
+func (h *Hub) send(p publishMsg) {
+	if p.Control {
+		select {
+		case h.publish <- p:
+		case <-h.done:
+		}
+		return
+	}
 	select {
-	case h.publish <- publishMsg{Topic: t.Symbol, Data: b}:
+	case h.publish <- p:
 	default:
 		// avoid blocking producers; track drops
 		atomic.AddUint64(&h.publishDrops, 1)
-		h.logger.Println("publish channel full, dropping trade")
+		h.logger.Printf("publish channel full, dropping message for %s", p.Topic)
 	}
 }
 
@@ -0,0 +1,84 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+// EventType is what happened to an order or the book.
+type EventType uint8
+
+const (
+	EVENT_ORDER_ACCEPTED         EventType = iota // an order or an amendment to it was taken by the engine
+	EVENT_ORDER_REJECTED                          // a new order was refused, nothing of it reached the book
+	EVENT_ORDER_FILLED                            // an order traded its last open quantity
+	EVENT_ORDER_PARTIALLY_FILLED                  // an order traded and still has quantity open
+	EVENT_ORDER_CANCELLED                         // an order left the book or the trigger book with quantity open
+	EVENT_TRADE                                   // a trade printed
+	EVENT_BOOK_LEVEL_CHANGED                      // the displayed volume or order count of a price level changed
+	EVENT_ORDER_REDUCED                           // self-trade prevention took quantity off an order
+	EVENT_ORDER_TRIGGERED                         // a trade crossed a stop's price and released it from the trigger book
+)
+
+var eventTypeNames = map[EventType]string{
+	EVENT_ORDER_ACCEPTED:         "ORDER_ACCEPTED",
+	EVENT_ORDER_REJECTED:         "ORDER_REJECTED",
+	EVENT_ORDER_FILLED:           "ORDER_FILLED",
+	EVENT_ORDER_PARTIALLY_FILLED: "ORDER_PARTIALLY_FILLED",
+	EVENT_ORDER_CANCELLED:        "ORDER_CANCELLED",
+	EVENT_TRADE:                  "TRADE",
+	EVENT_BOOK_LEVEL_CHANGED:     "BOOK_LEVEL_CHANGED",
+	EVENT_ORDER_REDUCED:          "ORDER_REDUCED",
+	EVENT_ORDER_TRIGGERED:        "ORDER_TRIGGERED",
+}
+
+func (t EventType) String() string {
+	if name, ok := eventTypeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("EventType(%d)", uint8(t))
+}
+
+// MarshalText writes the event type by name in JSON.
+func (t EventType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// Event is one entry of the ordered stream an engine emits while it applies commands. Sequence
+// counts the events of a ticker without gaps, Time is when the command that caused it ran.
+//
+// Quantity is the order size for ORDER_ACCEPTED, ORDER_REJECTED and ORDER_TRIGGERED, what
+// traded for fills and trades, what was taken off for ORDER_REDUCED and the displayed volume
+// for BOOK_LEVEL_CHANGED. Remaining is what an order still has open after the event.
+type Event struct {
+	Type      EventType `json:"type"`
+	Ticker    string    `json:"ticker"`
+	Sequence  uint64    `json:"seq"`
+	Time      time.Time `json:"time"`
+	OrderID   OrderId   `json:"orderId,omitempty"`
+	Owner     int64     `json:"-"`
+	Side      Side      `json:"side"`
+	Price     Price     `json:"price"`
+	Quantity  Quantity  `json:"quantity"`
+	Remaining Quantity  `json:"remaining"`
+	Orders    int       `json:"orders,omitempty"` // BOOK_LEVEL_CHANGED only: orders resting at the level
+	Trade     *Trade    `json:"trade,omitempty"`  // TRADE only
+	Reason    string    `json:"reason,omitempty"` // ORDER_REJECTED and engine cancels only
+}
+
+// Public is the event without anything that identifies orders, for market data feeds.
+func (e Event) Public() Event {
+	e.OrderID, e.Owner, e.Trade, e.Reason = 0, 0, nil, ""
+	return e
+}
+
+// TradesOf returns the trades among events, in the order they printed.
+func TradesOf(events []Event) []*Trade {
+	trades := make([]*Trade, 0)
+	for _, event := range events {
+		if event.Type == EVENT_TRADE {
+			trades = append(trades, event.Trade)
+		}
+	}
+	return trades
+}
@@ -0,0 +1,12 @@
+package model
+
+import "time"
+
+// Halt is a circuit breaker stopping a ticker until Until. Price is the trade that tripped it,
+// Reference the price it moved too far from.
+type Halt struct {
+	Ticker    string    `json:"ticker"`
+	Price     Price     `json:"price"`
+	Reference Price     `json:"reference"`
+	Until     time.Time `json:"until"`
+}
@@ -0,0 +1,93 @@
+package model
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// Rules an order can break, reported as the reason it was rejected.
+const (
+	RULE_PRICE        = "PRICE"
+	RULE_TICK_SIZE    = "TICK_SIZE"
+	RULE_LOT_SIZE     = "LOT_SIZE"
+	RULE_MIN_QUANTITY = "MIN_QUANTITY"
+	RULE_MAX_QUANTITY = "MAX_QUANTITY"
+	RULE_MIN_NOTIONAL = "MIN_NOTIONAL"
+)
+
+// InstrumentRules are the order sizes and prices a ticker accepts. Zero turns a rule off, a
+// zero tick or lot size means any step.
+type InstrumentRules struct {
+	TickSize    Price    `json:"tickSize"`
+	LotSize     Quantity `json:"lotSize"`
+	MinQuantity Quantity `json:"minQuantity"`
+	MaxQuantity Quantity `json:"maxQuantity"`
+	MinNotional uint64   `json:"minNotional"`
+}
+
+// RuleViolation is why an order breaks the instrument rules.
+type RuleViolation struct {
+	Rule    string // one of the RULE_ names
+	Message string
+}
+
+func (v *RuleViolation) Error() string {
+	return v.Message
+}
+
+func violation(rule, format string, args ...any) error {
+	return &RuleViolation{Rule: rule, Message: fmt.Sprintf(format, args...)}
+}
+
+// InstrumentOrder is what Check looks at of an order. Price is 0 for market orders, MaxNotional
+// is the cash budget of a market buy.
+type InstrumentOrder struct {
+	Side        Side
+	Type        OrderType
+	Price       Price
+	StopPrice   Price
+	Quantity    Quantity
+	PeakSize    Quantity
+	MaxNotional uint64
+}
+
+// Check returns a *RuleViolation for the first rule order breaks, nil when it breaks none.
+func (r InstrumentRules) Check(order InstrumentOrder) error {
+	isMarket := order.Type == ORDER_MARKET || order.Type == ORDER_STOP_MARKET
+	if !isMarket && order.Price == 0 {
+		return violation(RULE_PRICE, "price must be above 0")
+	}
+	if r.TickSize > 0 {
+		if order.Price%r.TickSize != 0 {
+			return violation(RULE_TICK_SIZE, "price %d is not a multiple of the tick size %d", order.Price, r.TickSize)
+		}
+		if order.StopPrice%r.TickSize != 0 {
+			return violation(RULE_TICK_SIZE, "stop price %d is not a multiple of the tick size %d", order.StopPrice, r.TickSize)
+		}
+	}
+	if r.LotSize > 0 {
+		if order.Quantity%r.LotSize != 0 {
+			return violation(RULE_LOT_SIZE, "quantity %d is not a multiple of the lot size %d", order.Quantity, r.LotSize)
+		}
+		if order.PeakSize%r.LotSize != 0 {
+			return violation(RULE_LOT_SIZE, "peak size %d is not a multiple of the lot size %d", order.PeakSize, r.LotSize)
+		}
+	}
+	if order.Quantity < r.MinQuantity {
+		return violation(RULE_MIN_QUANTITY, "quantity %d is below the minimum of %d", order.Quantity, r.MinQuantity)
+	}
+	if r.MaxQuantity > 0 && order.Quantity > r.MaxQuantity {
+		return violation(RULE_MAX_QUANTITY, "quantity %d is above the maximum of %d", order.Quantity, r.MaxQuantity)
+	}
+	if r.MinNotional > 0 {
+		// a market sell has no price to value it at until it trades
+		notional := new(big.Int).Mul(new(big.Int).SetUint64(uint64(order.Price)), new(big.Int).SetUint64(uint64(order.Quantity)))
+		if isMarket {
+			notional.SetUint64(order.MaxNotional)
+		}
+		if (!isMarket || order.Side == BID) && notional.Cmp(new(big.Int).SetUint64(r.MinNotional)) < 0 {
+			return violation(RULE_MIN_NOTIONAL, "order value %s is below the minimum notional of %d", notional, r.MinNotional)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package model
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestInstrumentRulesCheck(t *testing.T) {
+	rules := InstrumentRules{TickSize: 5, LotSize: 10, MinQuantity: 10, MaxQuantity: 1000, MinNotional: 5000}
+	tests := []struct {
+		name  string
+		rules InstrumentRules
+		order InstrumentOrder
+		rule  string // the rule the order breaks, empty when it breaks none
+	}{
+		{
+			name:  "limit order inside every rule",
+			rules: rules,
+			order: InstrumentOrder{Side: BID, Type: ORDER_GOOD_TILL_CANCEL, Price: 500, Quantity: 10},
+		},
+		{
+			name:  "limit order without a price",
+			rules: rules,
+			order: InstrumentOrder{Side: BID, Type: ORDER_GOOD_TILL_CANCEL, Quantity: 10},
+			rule:  RULE_PRICE,
+		},
+		{
+			name:  "price off the tick",
+			rules: rules,
+			order: InstrumentOrder{Side: BID, Type: ORDER_GOOD_TILL_CANCEL, Price: 502, Quantity: 10},
+			rule:  RULE_TICK_SIZE,
+		},
+		{
+			name:  "stop price off the tick",
+			rules: rules,
+			order: InstrumentOrder{Side: BID, Type: ORDER_STOP_LIMIT, Price: 500, StopPrice: 497, Quantity: 10},
+			rule:  RULE_TICK_SIZE,
+		},
+		{
+			name:  "quantity off the lot",
+			rules: rules,
+			order: InstrumentOrder{Side: ASK, Type: ORDER_GOOD_TILL_CANCEL, Price: 500, Quantity: 15},
+			rule:  RULE_LOT_SIZE,
+		},
+		{
+			name:  "iceberg peak off the lot",
+			rules: rules,
+			order: InstrumentOrder{Side: ASK, Type: ORDER_GOOD_TILL_CANCEL, Price: 500, Quantity: 100, PeakSize: 25},
+			rule:  RULE_LOT_SIZE,
+		},
+		{
+			name:  "quantity below the minimum",
+			rules: InstrumentRules{MinQuantity: 10},
+			order: InstrumentOrder{Side: ASK, Type: ORDER_GOOD_TILL_CANCEL, Price: 500, Quantity: 9},
+			rule:  RULE_MIN_QUANTITY,
+		},
+		{
+			name:  "quantity above the maximum",
+			rules: rules,
+			order: InstrumentOrder{Side: ASK, Type: ORDER_GOOD_TILL_CANCEL, Price: 500, Quantity: 1010},
+			rule:  RULE_MAX_QUANTITY,
+		},
+		{
+			name:  "value below the minimum notional",
+			rules: rules,
+			order: InstrumentOrder{Side: BID, Type: ORDER_GOOD_TILL_CANCEL, Price: 495, Quantity: 10},
+			rule:  RULE_MIN_NOTIONAL,
+		},
+		{
+			name:  "value too large for 64 bits clears the minimum notional",
+			rules: InstrumentRules{MinNotional: 5000},
+			order: InstrumentOrder{Side: BID, Type: ORDER_GOOD_TILL_CANCEL, Price: math.MaxUint64 / 2, Quantity: 4},
+		},
+		{
+			name:  "market buy is valued at its notional cap",
+			rules: rules,
+			order: InstrumentOrder{Side: BID, Type: ORDER_MARKET, Quantity: 10, MaxNotional: 4999},
+			rule:  RULE_MIN_NOTIONAL,
+		},
+		{
+			name:  "market sell has no value to check",
+			rules: rules,
+			order: InstrumentOrder{Side: ASK, Type: ORDER_MARKET, Quantity: 10},
+		},
+		{
+			name:  "zero rules accept any step and size",
+			order: InstrumentOrder{Side: BID, Type: ORDER_GOOD_TILL_CANCEL, Price: 7, Quantity: 3},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.rules.Check(test.order)
+			if test.rule == "" {
+				if err != nil {
+					t.Fatalf("Check returned %v", err)
+				}
+				return
+			}
+			var broken *RuleViolation
+			if !errors.As(err, &broken) || broken.Rule != test.rule {
+				t.Fatalf("Check returned %v, want a %s violation", err, test.rule)
+			}
+		})
+	}
+}
@@ -1,9 +1,13 @@
 package model
 
+import "time"
+
 type MarketDepthLevel struct {
 	Price      Price    `json:"price"`
 	Volume     Quantity `json:"volume"`
 	OrderCount int      `json:"orderCount"`
+	// CumulativeVolume is the volume of this level and every better one on its side
+	CumulativeVolume Quantity `json:"cumulativeVolume"`
 }
 
 // MarketDepth represents the full order book depth
@@ -19,3 +23,25 @@ type TopOfBook struct {
 	BestAsk *MarketDepthLevel `json:"bestAsk"`
 	Spread  Price             `json:"spread"`
 }
+
+// OrderBookL3Entry is one resting order in the order-by-order view. Quantity is what the order
+// shows, an iceberg's hidden reserve stays hidden.
+type OrderBookL3Entry struct {
+	OrderID   OrderId   `json:"orderId,omitempty"`
+	Token     string    `json:"token"` // stands in for the order id of other users' orders
+	Owner     int64     `json:"-"`
+	Price     Price     `json:"price"`
+	Quantity  Quantity  `json:"quantity"`
+	EnteredAt time.Time `json:"enteredAt"`
+}
+
+// OrderBookL3 is a page of one side of the book order by order, best price first and in queue
+// order within a price. Pages read at different Sequence values come from a book that changed
+// in between.
+type OrderBookL3 struct {
+	Side     Side               `json:"side"`
+	Sequence uint64             `json:"sequence"`
+	Offset   int                `json:"offset"`
+	Total    int                `json:"total"` // resting orders on the side
+	Orders   []OrderBookL3Entry `json:"orders"`
+}
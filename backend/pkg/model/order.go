@@ -2,6 +2,8 @@ package model
 
 import (
 	"fmt"
+	"math"
+	"time"
 )
 
 type Order struct {
@@ -11,6 +13,19 @@ type Order struct {
 	initialQuantity   Quantity
 	remainingQuantity Quantity
 	orderType         OrderType
+	maxNotional       uint64 // market buys only: cash budget, 0 means uncapped
+	spentNotional     uint64
+	postOnly          PostOnly
+	stopPrice         Price    // stop types only: trade price that releases the order into the book
+	peakSize          Quantity // icebergs only: size of each displayed slice, 0 shows everything
+	displayedQuantity Quantity // icebergs only: what is left of the current slice
+	owner             int64    // user id, 0 when unknown
+	selfTrade         SelfTradePrevention
+	enteredAt         time.Time // when the order joined the back of its price level, zero until it rests
+
+	prev, next *Order // links in the queue of the price level the order rests in
+	queue      *OrderQueue
+	level      any
 }
 
 func NewOrder(id OrderId, side Side, price Price, quantity Quantity, orderType OrderType) Order {
@@ -23,6 +38,28 @@ func NewOrder(id OrderId, side Side, price Price, quantity Quantity, orderType O
 		orderType:         orderType,
 	}
 }
+
+// NewMarketOrder builds an order without a limit price. The price is pinned to the
+// far end of the book so the order can sweep every opposite level it reaches.
+func NewMarketOrder(id OrderId, side Side, quantity Quantity, maxNotional uint64) Order {
+	price := Price(0)
+	if side == BID {
+		price = Price(math.MaxUint64)
+	}
+	order := NewOrder(id, side, price, quantity, ORDER_MARKET)
+	order.maxNotional = maxNotional
+	return order
+}
+
+// NewStopOrder builds an order that waits in the trigger book until a trade reaches
+// stopPrice. A stop-limit then rests at price, a stop-market sweeps like NewMarketOrder.
+func NewStopOrder(id OrderId, side Side, stopPrice Price, price Price, quantity Quantity, orderType OrderType, maxNotional uint64) Order {
+	order := NewOrder(id, side, price, quantity, orderType)
+	order.stopPrice = stopPrice
+	order.maxNotional = maxNotional
+	return order
+}
+
 func NewEmptyOrder(id OrderId, side Side, price Price, quantity Quantity, orderType OrderType) Order {
 	return Order{}
 }
@@ -36,9 +73,38 @@ func (o *Order) Fill(quantity Quantity) error {
 		return fmt.Errorf("order cannot be filled for more than its remaining quantity %d", o.id)
 	}
 	o.remainingQuantity -= quantity
+	o.displayedQuantity -= min(quantity, o.displayedQuantity)
+	return nil
+}
+
+// FillAt fills the order like Fill and also charges the notional budget of market buys.
+func (o *Order) FillAt(quantity Quantity, price Price) error {
+	if err := o.Fill(quantity); err != nil {
+		return err
+	}
+	o.spentNotional += uint64(price) * uint64(quantity)
 	return nil
 }
 
+// AffordableQuantity caps quantity to what the remaining notional budget can pay for at price.
+func (o *Order) AffordableQuantity(price Price, quantity Quantity) Quantity {
+	if o.maxNotional == 0 || price == 0 {
+		return quantity
+	}
+	if o.spentNotional >= o.maxNotional {
+		return 0
+	}
+	return min(quantity, Quantity((o.maxNotional-o.spentNotional)/uint64(price)))
+}
+
+func (o *Order) GetMaxNotional() uint64 {
+	return o.maxNotional
+}
+
+func (o *Order) GetSpentNotional() uint64 {
+	return o.spentNotional
+}
+
 func (o *Order) IsFilled() bool {
 	return o.remainingQuantity == 0
 }
@@ -67,6 +133,125 @@ func (o *Order) GetInitialQuantity() Quantity {
 	return o.initialQuantity
 }
 
+func (o *Order) SetPostOnly(postOnly PostOnly) {
+	o.postOnly = postOnly
+}
+
+func (o *Order) GetPostOnly() PostOnly {
+	return o.postOnly
+}
+
+// SetPeakSize turns the order into an iceberg that only shows peak of its remaining quantity at a time.
+func (o *Order) SetPeakSize(peak Quantity) {
+	o.peakSize = peak
+	o.displayedQuantity = min(peak, o.remainingQuantity)
+}
+
+func (o *Order) GetPeakSize() Quantity {
+	return o.peakSize
+}
+
+// GetDisplayedQuantity is the part of the remaining quantity visible on the book.
+func (o *Order) GetDisplayedQuantity() Quantity {
+	if o.peakSize == 0 {
+		return o.remainingQuantity
+	}
+	return o.displayedQuantity
+}
+
+func (o *Order) GetHiddenQuantity() Quantity {
+	return o.remainingQuantity - o.GetDisplayedQuantity()
+}
+
+// RefreshPeak loads the next slice of an iceberg from its hidden reserve once the
+// displayed slice is used up and returns how much was moved out of hiding.
+func (o *Order) RefreshPeak() Quantity {
+	if o.peakSize == 0 || o.displayedQuantity > 0 {
+		return 0
+	}
+	o.displayedQuantity = min(o.peakSize, o.remainingQuantity)
+	return o.displayedQuantity
+}
+
+func (o *Order) GetStopPrice() Price {
+	return o.stopPrice
+}
+
+// Trigger turns a stop order into the order it releases into the book:
+// a stop-market becomes a market order, a stop-limit a good-till-cancel limit.
+func (o *Order) Trigger() {
+	switch o.orderType {
+	case ORDER_STOP_MARKET:
+		o.orderType = ORDER_MARKET
+		o.price = 0
+		if o.side == BID {
+			o.price = Price(math.MaxUint64)
+		}
+	case ORDER_STOP_LIMIT:
+		o.orderType = ORDER_GOOD_TILL_CANCEL
+	}
+}
+
+// SetOwner records the user behind the order so the engine can spot self trades.
+func (o *Order) SetOwner(owner int64) {
+	o.owner = owner
+}
+
+func (o *Order) GetOwner() int64 {
+	return o.owner
+}
+
+func (o *Order) SetSelfTradePrevention(mode SelfTradePrevention) {
+	o.selfTrade = mode
+}
+
+func (o *Order) GetSelfTradePrevention() SelfTradePrevention {
+	return o.selfTrade
+}
+
+// Reduce takes quantity off the order without trading it, hidden iceberg reserve first.
+// The order shrinks as a whole, so its filled quantity stays the same.
+func (o *Order) Reduce(quantity Quantity) error {
+	if quantity > o.remainingQuantity {
+		return fmt.Errorf("order cannot be reduced by more than its remaining quantity %d", o.id)
+	}
+	hidden := o.GetHiddenQuantity()
+	o.initialQuantity -= quantity
+	o.remainingQuantity -= quantity
+	if quantity > hidden {
+		o.displayedQuantity -= min(quantity-hidden, o.displayedQuantity)
+	}
+	return nil
+}
+
+func (o *Order) SetEnteredAt(at time.Time) {
+	o.enteredAt = at
+}
+
+func (o *Order) GetEnteredAt() time.Time {
+	return o.enteredAt
+}
+
+// Resize sets the total quantity of an order that is off the book, keeping what it filled. An
+// iceberg starts a fresh slice.
+func (o *Order) Resize(quantity Quantity) error {
+	filled := o.GetFilledQuantity()
+	if quantity <= filled {
+		return fmt.Errorf("order %d cannot be resized to %d, it filled %d already", o.id, quantity, filled)
+	}
+	o.initialQuantity = quantity
+	o.remainingQuantity = quantity - filled
+	if o.peakSize > 0 {
+		o.displayedQuantity = min(o.peakSize, o.remainingQuantity)
+	}
+	return nil
+}
+
+// Reprice moves a not yet resting order to another limit price.
+func (o *Order) Reprice(price Price) {
+	o.price = price
+}
+
 type OrderModify struct {
 	ID       OrderId
 	Price    Price
@@ -90,6 +275,62 @@ type OrderId uint64
 type OrderType uint8
 
 const (
-	ORDER_FILL_AND_KILL OrderType = iota
+	ORDER_IMMEDIATE_OR_CANCEL OrderType = iota // fills what it can right away, the rest is cancelled
 	ORDER_GOOD_TILL_CANCEL
+	ORDER_MARKET
+	ORDER_FILL_OR_KILL   // fills completely right away or is rejected without trading
+	ORDER_STOP_MARKET    // waits for its stop price, then trades as ORDER_MARKET
+	ORDER_STOP_LIMIT     // waits for its stop price, then rests as ORDER_GOOD_TILL_CANCEL
+	ORDER_GOOD_TILL_DATE // rests like ORDER_GOOD_TILL_CANCEL until an explicit expiry time
+	ORDER_DAY            // rests like ORDER_GOOD_TILL_CANCEL until the session closes
 )
+
+// RestsOnBook reports whether this type is a plain limit order that waits on the book.
+func (t OrderType) RestsOnBook() bool {
+	return t == ORDER_GOOD_TILL_CANCEL || t == ORDER_GOOD_TILL_DATE || t == ORDER_DAY
+}
+
+// OrderStatus is the lifecycle state persisted with an order.
+type OrderStatus string
+
+const (
+	ORDER_STATUS_OPEN      OrderStatus = "OPEN"
+	ORDER_STATUS_FILLED    OrderStatus = "FILLED"
+	ORDER_STATUS_CANCELLED OrderStatus = "CANCELLED" // by the user, or the engine dropped the remainder
+	ORDER_STATUS_EXPIRED   OrderStatus = "EXPIRED"   // time in force ran out
+)
+
+// IsStop reports whether this type waits in the trigger book before reaching the order book.
+func (t OrderType) IsStop() bool {
+	return t == ORDER_STOP_MARKET || t == ORDER_STOP_LIMIT
+}
+
+// PostOnly controls what happens to a limit order that would take liquidity on entry.
+type PostOnly uint8
+
+const (
+	POST_ONLY_NONE    PostOnly = iota
+	POST_ONLY_REJECT           // reject instead of trading
+	POST_ONLY_REPRICE          // rest one tick away from the opposite best instead of trading
+)
+
+// SelfTradePrevention decides what happens when an order would trade against another order of the same owner.
+type SelfTradePrevention uint8
+
+const (
+	STP_NONE                 SelfTradePrevention = iota
+	STP_CANCEL_NEWEST                            // cancel the incoming order, the resting one keeps its place
+	STP_CANCEL_OLDEST                            // cancel the resting order, the incoming one keeps matching
+	STP_CANCEL_BOTH                              // cancel both orders
+	STP_DECREMENT_AND_CANCEL                     // cancel the smaller order and take its size off the larger one
+)
+
+// IsImmediate reports whether the unfilled remainder of this type is cancelled
+// instead of resting on the book.
+func (t OrderType) IsImmediate() bool {
+	switch t {
+	case ORDER_IMMEDIATE_OR_CANCEL, ORDER_FILL_OR_KILL, ORDER_MARKET:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+package model
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// ORDER_BINARY_SIZE is the length of an order encoded by MarshalBinary.
+const ORDER_BINARY_SIZE = 92
+
+// MarshalBinary encodes the order's trading state in a fixed little-endian layout.
+// The queue links are not part of it, they belong to whatever book holds the order. The entry
+// time is in unix nanoseconds, 0 when the order has not rested yet.
+func (o *Order) MarshalBinary() ([]byte, error) {
+	return o.AppendBinary(make([]byte, 0, ORDER_BINARY_SIZE))
+}
+
+// AppendBinary appends the encoding of MarshalBinary to buf.
+func (o *Order) AppendBinary(buf []byte) ([]byte, error) {
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(o.id))
+	buf = append(buf, byte(o.side))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(o.price))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(o.initialQuantity))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(o.remainingQuantity))
+	buf = append(buf, byte(o.orderType))
+	buf = binary.LittleEndian.AppendUint64(buf, o.maxNotional)
+	buf = binary.LittleEndian.AppendUint64(buf, o.spentNotional)
+	buf = append(buf, byte(o.postOnly))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(o.stopPrice))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(o.peakSize))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(o.displayedQuantity))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(o.owner))
+	buf = append(buf, byte(o.selfTrade))
+	var enteredAt int64
+	if !o.enteredAt.IsZero() {
+		enteredAt = o.enteredAt.UnixNano()
+	}
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(enteredAt))
+	return buf, nil
+}
+
+// UnmarshalBinary decodes an order written by MarshalBinary. The order comes back unlinked.
+func (o *Order) UnmarshalBinary(data []byte) error {
+	if len(data) != ORDER_BINARY_SIZE {
+		return fmt.Errorf("order encoding must be %d bytes, got %d", ORDER_BINARY_SIZE, len(data))
+	}
+	u64 := func() uint64 {
+		value := binary.LittleEndian.Uint64(data)
+		data = data[8:]
+		return value
+	}
+	u8 := func() byte {
+		value := data[0]
+		data = data[1:]
+		return value
+	}
+	*o = Order{
+		id:                OrderId(u64()),
+		side:              Side(u8()),
+		price:             Price(u64()),
+		initialQuantity:   Quantity(u64()),
+		remainingQuantity: Quantity(u64()),
+		orderType:         OrderType(u8()),
+		maxNotional:       u64(),
+		spentNotional:     u64(),
+		postOnly:          PostOnly(u8()),
+		stopPrice:         Price(u64()),
+		peakSize:          Quantity(u64()),
+		displayedQuantity: Quantity(u64()),
+		owner:             int64(u64()),
+		selfTrade:         SelfTradePrevention(u8()),
+	}
+	if enteredAt := int64(u64()); enteredAt != 0 {
+		o.enteredAt = time.Unix(0, enteredAt)
+	}
+	return nil
+}
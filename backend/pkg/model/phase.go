@@ -0,0 +1,70 @@
+package model
+
+import "fmt"
+
+// TradingPhase is where a ticker is in its trading day. The zero value is continuous trading,
+// so a book nobody schedules behaves as it always has.
+type TradingPhase uint8
+
+const (
+	PHASE_CONTINUOUS      TradingPhase = iota // orders match as they arrive
+	PHASE_PRE_OPEN                            // orders are collected for the opening auction, nothing matches
+	PHASE_OPENING_AUCTION                     // call period of the opening auction, uncrossed when continuous trading starts
+	PHASE_CLOSING_AUCTION                     // call period of the closing auction, uncrossed when the ticker closes
+	PHASE_CLOSED                              // no new orders, resting orders can still be cancelled
+)
+
+var tradingPhaseNames = map[TradingPhase]string{
+	PHASE_CONTINUOUS:      "CONTINUOUS",
+	PHASE_PRE_OPEN:        "PRE_OPEN",
+	PHASE_OPENING_AUCTION: "OPENING_AUCTION",
+	PHASE_CLOSING_AUCTION: "CLOSING_AUCTION",
+	PHASE_CLOSED:          "CLOSED",
+}
+
+func (p TradingPhase) String() string {
+	if name, ok := tradingPhaseNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("TradingPhase(%d)", uint8(p))
+}
+
+// TradingPhaseByName parses the names String returns.
+func TradingPhaseByName(name string) (TradingPhase, error) {
+	for phase, phaseName := range tradingPhaseNames {
+		if phaseName == name {
+			return phase, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown trading phase %q", name)
+}
+
+// MarshalText writes the phase by name in JSON.
+func (p TradingPhase) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+func (p *TradingPhase) UnmarshalText(text []byte) error {
+	phase, err := TradingPhaseByName(string(text))
+	if err != nil {
+		return err
+	}
+	*p = phase
+	return nil
+}
+
+// IsAuction reports whether orders are collected without matching.
+func (p TradingPhase) IsAuction() bool {
+	return p == PHASE_PRE_OPEN || p == PHASE_OPENING_AUCTION || p == PHASE_CLOSING_AUCTION
+}
+
+// AuctionIndication is what the auction would do if it uncrossed now. Price and Volume are 0
+// while the book does not cross. Imbalance is the volume left over on ImbalanceSide at Price.
+type AuctionIndication struct {
+	Ticker        string       `json:"ticker"`
+	Phase         TradingPhase `json:"phase"`
+	Price         Price        `json:"price"`
+	Volume        Quantity     `json:"volume"`
+	Imbalance     Quantity     `json:"imbalance"`
+	ImbalanceSide Side         `json:"imbalanceSide"`
+}
@@ -0,0 +1,81 @@
+package model
+
+// OrderQueue is an intrusive doubly linked list of orders in time priority. Orders carry
+// their own links, so adding and removing is O(1) and nothing is copied as the queue drains.
+// An order can be in at most one queue at a time.
+type OrderQueue struct {
+	head, tail *Order
+	len        int
+}
+
+func (q *OrderQueue) Len() int {
+	return q.len
+}
+
+// Front is the order with the best time priority, nil when the queue is empty.
+func (q *OrderQueue) Front() *Order {
+	return q.head
+}
+
+func (q *OrderQueue) PushBack(order *Order) {
+	order.queue = q
+	order.prev, order.next = q.tail, nil
+	if q.tail != nil {
+		q.tail.next = order
+	} else {
+		q.head = order
+	}
+	q.tail = order
+	q.len++
+}
+
+// Remove unlinks order and reports whether it was in q.
+func (q *OrderQueue) Remove(order *Order) bool {
+	if order.queue != q {
+		return false
+	}
+	if order.prev != nil {
+		order.prev.next = order.next
+	} else {
+		q.head = order.next
+	}
+	if order.next != nil {
+		order.next.prev = order.prev
+	} else {
+		q.tail = order.prev
+	}
+	order.prev, order.next, order.queue = nil, nil, nil
+	q.len--
+	return true
+}
+
+// MoveToBack sends order to the end of q, losing its time priority.
+func (q *OrderQueue) MoveToBack(order *Order) {
+	if q.Remove(order) {
+		q.PushBack(order)
+	}
+}
+
+// Orders copies the queue into a slice in time priority.
+func (q *OrderQueue) Orders() []*Order {
+	orders := make([]*Order, 0, q.len)
+	for order := q.head; order != nil; order = order.next {
+		orders = append(orders, order)
+	}
+	return orders
+}
+
+// Next is the order queued right behind o, nil at the back of the queue.
+func (o *Order) Next() *Order {
+	return o.next
+}
+
+// SetLevel and GetLevel keep a handle to the price or stop level o waits in, so the engine can
+// reach it without searching the book. The engine owns what the handle points to.
+func (o *Order) SetLevel(level any) {
+	o.level = level
+}
+
+func (o *Order) GetLevel() any {
+	return o.level
+}
@@ -0,0 +1,92 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+// TickerStatus is what an operator allows on a ticker, on top of its trading phase. The zero
+// value is open, so a ticker nobody set a status on trades as it always has.
+type TickerStatus uint8
+
+const (
+	TICKER_STATUS_OPEN        TickerStatus = iota // orders, amends and cancels are taken
+	TICKER_STATUS_HALTED                          // nothing is taken, the book stays as it is
+	TICKER_STATUS_CANCEL_ONLY                     // resting orders can be cancelled, nothing else is taken
+	TICKER_STATUS_CLOSED                          // resting orders were cancelled and nothing is taken
+)
+
+// RULE_TICKER_STATUS is the rule an order, amend or cancel breaks when the ticker's status refuses it.
+const RULE_TICKER_STATUS = "TICKER_STATUS"
+
+var tickerStatusNames = map[TickerStatus]string{
+	TICKER_STATUS_OPEN:        "OPEN",
+	TICKER_STATUS_HALTED:      "HALTED",
+	TICKER_STATUS_CANCEL_ONLY: "CANCEL_ONLY",
+	TICKER_STATUS_CLOSED:      "CLOSED",
+}
+
+func (s TickerStatus) String() string {
+	if name, ok := tickerStatusNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("TickerStatus(%d)", uint8(s))
+}
+
+// TickerStatusByName parses the names String returns.
+func TickerStatusByName(name string) (TickerStatus, error) {
+	for status, statusName := range tickerStatusNames {
+		if statusName == name {
+			return status, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown ticker status %q", name)
+}
+
+// MarshalText writes the status by name in JSON.
+func (s TickerStatus) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *TickerStatus) UnmarshalText(text []byte) error {
+	status, err := TickerStatusByName(string(text))
+	if err != nil {
+		return err
+	}
+	*s = status
+	return nil
+}
+
+// CheckOrder returns a *RuleViolation when the status refuses new orders and amends.
+func (s TickerStatus) CheckOrder(ticker string) error {
+	if s != TICKER_STATUS_OPEN {
+		return violation(RULE_TICKER_STATUS, "ticker %s is %s, it takes no orders or amends", ticker, s)
+	}
+	return nil
+}
+
+// CheckCancel returns a *RuleViolation when the status refuses cancels.
+func (s TickerStatus) CheckCancel(ticker string) error {
+	if s != TICKER_STATUS_OPEN && s != TICKER_STATUS_CANCEL_ONLY {
+		return violation(RULE_TICKER_STATUS, "ticker %s is %s, it takes no cancels", ticker, s)
+	}
+	return nil
+}
+
+// TickerStatusChange is an operator moving Ticker to Status.
+type TickerStatusChange struct {
+	Ticker string       `json:"ticker"`
+	Status TickerStatus `json:"status"`
+	Time   time.Time    `json:"time"`
+}
+
+// TickerState is what a ticker takes right now. Operator is the status an operator set; Status
+// narrows it to cancel-only while the trading phase is closed or a circuit breaker halt runs,
+// which is also what the engine admits.
+type TickerState struct {
+	Ticker   string       `json:"ticker"`
+	Status   TickerStatus `json:"status"`
+	Operator TickerStatus `json:"operator"`
+	Phase    TradingPhase `json:"phase"`
+	Halt     *Halt        `json:"halt,omitempty"`
+}
@@ -2,12 +2,18 @@ package model
 
 import "time"
 
+// Trade is one execution between a maker, the order that was resting, and a taker, the order
+// that arrived last and traded against it. Side is the aggressor's side, the side of the taker.
+// Timestamp is when the command that printed it ran.
 type Trade struct {
-	Side      Side
-	MakerID   OrderId
-	TakerID   OrderId
-	Price     Price
-	Quantity  Quantity
-	Timestamp time.Time
-	Ticker    string
+	ID          uint64
+	Side        Side
+	MakerID     OrderId
+	TakerID     OrderId
+	BuyOrderID  OrderId
+	SellOrderID OrderId
+	Price       Price
+	Quantity    Quantity
+	Timestamp   time.Time
+	Ticker      string
 }
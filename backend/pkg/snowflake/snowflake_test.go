@@ -0,0 +1,155 @@
+package snowflake
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Yusufzhafir/go-orderbook/backend/pkg/clock"
+)
+
+// step moves the clock by advance, then generates count IDs.
+type step struct {
+	advance time.Duration
+	count   int
+}
+
+// id is one generated ID split into its parts.
+type id struct {
+	ms       int64
+	sequence uint64
+}
+
+func TestGeneratorNext(t *testing.T) {
+	start := EPOCH.Add(time.Hour)
+	startMs := time.Hour.Milliseconds()
+	tests := []struct {
+		name  string
+		start time.Time
+		steps []step
+		want  []id // the last ID of every step
+	}{
+		{
+			name:  "one millisecond counts the sequence up",
+			start: start,
+			steps: []step{{count: 3}},
+			want:  []id{{startMs, 2}},
+		},
+		{
+			name:  "a new millisecond starts the sequence over",
+			start: start,
+			steps: []step{{count: 3}, {advance: time.Millisecond, count: 1}},
+			want:  []id{{startMs, 2}, {startMs + 1, 0}},
+		},
+		{
+			name:  "a clock that steps back keeps counting in the last millisecond",
+			start: start,
+			steps: []step{{count: 1}, {advance: -time.Second, count: 2}},
+			want:  []id{{startMs, 0}, {startMs, 2}},
+		},
+		{
+			name:  "a spent sequence borrows the next millisecond",
+			start: start,
+			steps: []step{{count: MAX_SEQUENCE + 1}, {count: 1}, {advance: time.Millisecond, count: 1}},
+			want:  []id{{startMs, MAX_SEQUENCE}, {startMs + 1, 0}, {startMs + 1, 1}},
+		},
+		{
+			name:  "a clock before the epoch counts from 0",
+			start: EPOCH.Add(-time.Hour),
+			steps: []step{{count: 2}},
+			want:  []id{{0, 1}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			now := clock.NewManual(test.start)
+			generator, err := NewGenerator(GeneratorOpts{Node: 7, Clock: now})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var last uint64
+			for i, step := range test.steps {
+				now.Advance(step.advance)
+				for range step.count {
+					next := generator.Next()
+					if next <= last {
+						t.Fatalf("ID %d came after %d", next, last)
+					}
+					last = next
+				}
+				want := uint64(test.want[i].ms)<<(NODE_BITS+SEQUENCE_BITS) | 7<<SEQUENCE_BITS | test.want[i].sequence
+				if last != want {
+					t.Errorf("step %d ended on ID %d, want %d", i, last, want)
+				}
+				if Node(last) != 7 || !Time(last).Equal(EPOCH.Add(time.Duration(test.want[i].ms)*time.Millisecond)) {
+					t.Errorf("ID %d decodes as node %d at %v", last, Node(last), Time(last))
+				}
+			}
+		})
+	}
+}
+
+func TestGeneratorIsDeterministic(t *testing.T) {
+	run := func() []uint64 {
+		now := clock.NewManual(EPOCH.Add(24 * time.Hour))
+		generator, err := NewGenerator(GeneratorOpts{Node: MAX_NODE, Clock: now})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := make([]uint64, 0, 1000)
+		for i := range 1000 {
+			if i%7 == 0 {
+				now.Advance(time.Millisecond)
+			}
+			ids = append(ids, generator.Next())
+		}
+		return ids
+	}
+
+	first, second := run(), run()
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("ID %d was %d on the first run and %d on the second", i, first[i], second[i])
+		}
+	}
+}
+
+func TestGeneratorUnderConcurrency(t *testing.T) {
+	generator, err := NewGenerator(GeneratorOpts{Node: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const WORKERS, PER_WORKER = 8, 2000
+	ids := make([][]uint64, WORKERS)
+	var wg sync.WaitGroup
+	for w := range WORKERS {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range PER_WORKER {
+				ids[w] = append(ids[w], generator.Next())
+			}
+		}()
+	}
+	wg.Wait()
+
+	seen := make(map[uint64]bool, WORKERS*PER_WORKER)
+	for _, worker := range ids {
+		for i, next := range worker {
+			if i > 0 && next <= worker[i-1] {
+				t.Fatalf("ID %d came after %d on the same goroutine", next, worker[i-1])
+			}
+			if seen[next] {
+				t.Fatalf("ID %d was handed out twice", next)
+			}
+			seen[next] = true
+		}
+	}
+}
+
+func TestNewGeneratorRejectsLargeNodes(t *testing.T) {
+	if _, err := NewGenerator(GeneratorOpts{Node: MAX_NODE + 1}); err == nil {
+		t.Error("NewGenerator accepted a node above MAX_NODE")
+	}
+}
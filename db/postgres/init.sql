@@ -2,6 +2,7 @@ CREATE TABLE users (
     id            SERIAL        PRIMARY KEY,
     username      VARCHAR(50)   UNIQUE NOT NULL,
     password_hash TEXT          NOT NULL,
+    stp_mode      SMALLINT      NOT NULL DEFAULT 0,
     created_at    TIMESTAMPTZ   NOT NULL DEFAULT NOW()
 );
 
@@ -10,6 +11,18 @@ CREATE TABLE ticker (
     ticker            VARCHAR(10) UNIQUE NOT NULL,
     tb_ledger_id      BIGINT      UNIQUE NOT NULL,
     escrow_account_id NUMERIC(38,0) UNIQUE NOT NULL,
+    matching_policy   VARCHAR(32) NOT NULL DEFAULT 'FIFO',
+    static_band_bps   INT         NOT NULL DEFAULT 0,
+    dynamic_band_bps  INT         NOT NULL DEFAULT 0,
+    breaker_bps       INT         NOT NULL DEFAULT 0,
+    breaker_window_ms BIGINT      NOT NULL DEFAULT 0,
+    halt_ms           BIGINT      NOT NULL DEFAULT 0,
+    tick_size         BIGINT      NOT NULL DEFAULT 0,
+    lot_size          BIGINT      NOT NULL DEFAULT 0,
+    min_quantity      BIGINT      NOT NULL DEFAULT 0,
+    max_quantity      BIGINT      NOT NULL DEFAULT 0,
+    min_notional      BIGINT      NOT NULL DEFAULT 0,
+    trading_status    VARCHAR(16) NOT NULL DEFAULT 'OPEN',
     created_at        TIMESTAMPTZ NOT NULL DEFAULT NOW()
 );
 
@@ -34,13 +47,21 @@ CREATE TABLE orders (
     quantity    BIGINT      NOT NULL,            
     filled    BIGINT      NOT NULL,            
     price       BIGINT      NOT NULL,            
+    stop_price  BIGINT      NOT NULL DEFAULT 0,
+    max_notional BIGINT     NOT NULL DEFAULT 0,
+    peak_size   BIGINT      NOT NULL DEFAULT 0,
+    triggered   BOOLEAN     NOT NULL DEFAULT FALSE,
     is_active   BOOLEAN     NOT NULL DEFAULT TRUE, 
+    status      VARCHAR(16) NOT NULL DEFAULT 'OPEN',
+    expires_at  TIMESTAMPTZ             DEFAULT NULL,
     created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
     closed_at   TIMESTAMPTZ             DEFAULT NULL
 );
 
+CREATE INDEX orders_active_expiry_idx ON orders (expires_at) WHERE is_active AND expires_at IS NOT NULL;
+
 CREATE TABLE trades (
-    id                BIGSERIAL PRIMARY KEY,
+    id                BIGINT    PRIMARY KEY,
     ticker_id         BIGINT    NOT NULL,      
     order_taker_id    BIGINT    NOT NULL,      
     order_maker_id    BIGINT    NOT NULL,      
@@ -52,3 +73,20 @@ CREATE TABLE trades (
     price    BIGINT   NOT NULL,
     traded_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
 );
+
+CREATE TABLE engine_events (
+    id             BIGSERIAL   PRIMARY KEY,
+    ticker         VARCHAR(10) NOT NULL,
+    seq            BIGINT      NOT NULL,
+    type           SMALLINT    NOT NULL,
+    order_id       BIGINT      NOT NULL DEFAULT 0,
+    maker_order_id BIGINT      NOT NULL DEFAULT 0,
+    side           SMALLINT    NOT NULL,
+    price          BIGINT      NOT NULL,
+    quantity       BIGINT      NOT NULL,
+    remaining      BIGINT      NOT NULL DEFAULT 0,
+    reason         TEXT        NOT NULL DEFAULT '',
+    occurred_at    TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX engine_events_ticker_seq_idx ON engine_events (ticker, seq);
@@ -12,8 +12,14 @@ export enum Side {
 
 export type OrderTypeString = "LIMIT" | "MARKET";
 export enum OrderType {
-  ORDER_FILL_AND_KILL,
+  ORDER_IMMEDIATE_OR_CANCEL,
   ORDER_GOOD_TILL_CANCEL,
+  ORDER_MARKET,
+  ORDER_FILL_OR_KILL,
+  ORDER_STOP_MARKET,
+  ORDER_STOP_LIMIT,
+  ORDER_GOOD_TILL_DATE,
+  ORDER_DAY,
 }
 
 export function MapOrderType(orderType: OrderTypeString) {
@@ -21,9 +27,9 @@ export function MapOrderType(orderType: OrderTypeString) {
     case "LIMIT":
       return OrderType.ORDER_GOOD_TILL_CANCEL;
     case "MARKET":
-      return OrderType.ORDER_FILL_AND_KILL;
+      return OrderType.ORDER_MARKET;
     default:
-      return OrderType.ORDER_FILL_AND_KILL;
+      return OrderType.ORDER_IMMEDIATE_OR_CANCEL;
   }
 }
 
@@ -42,10 +48,30 @@ export interface AddOrderRequest {
   quantity: number; // uint64 server-side
   type: OrderType;
   ticker: string
+  maxNotional?: number; // market buys: most cash the order may spend
+  postOnly?: PostOnly;
+  stopPrice?: number; // stop types only
+  peakSize?: number; // iceberg: quantity shown on the book at a time
+  expiresAt?: string; // good-till-date only, RFC 3339
+  stpMode?: SelfTradePrevention; // omit to use the account setting
+}
+export enum PostOnly {
+  NONE,
+  REJECT,
+  REPRICE,
+}
+export enum SelfTradePrevention {
+  NONE,
+  CANCEL_NEWEST,
+  CANCEL_OLDEST,
+  CANCEL_BOTH,
+  DECREMENT_AND_CANCEL,
 }
 export interface AddOrderResponse {
   orderId: number;
   trades?: MatchorderType[];
+  price?: number;
+  repriced?: boolean; // post-only order was moved off the opposite best
   status: "accepted" | "rejected";
   message?: string;
 }
@@ -73,6 +99,7 @@ export interface OrderBookLevel {
   price: number;
   volume: number;
   orderCount: number;
+  cumulativeVolume: number;
 }
 export interface OrderBookResponse {
   bids: OrderBookLevel[];
@@ -131,6 +158,8 @@ export interface UserOrder {
   Filled: number
   Price: number
   IsActive: boolean
+  Status?: "OPEN" | "FILLED" | "CANCELLED" | "EXPIRED"
+  ExpiresAt?: string | null
   CreatedAt: string
   ClosedAt: string
 }
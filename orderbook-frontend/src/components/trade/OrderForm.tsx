@@ -29,9 +29,10 @@ export function AddOrderForm({ className,ticker }: { className?: string,ticker:s
       type: MapOrderType(type),
       price: Number(price),
       quantity: Number(qty),
-      ticker : ticker
+      ticker : ticker,
+      maxNotional: type == "MARKET" && side == "BID" ? orderCost : undefined,
     });
-  },[ticker,type,price,qty,side,mutate])
+  },[ticker,type,price,qty,side,orderCost,mutate])
 
   return (
     <Card className={cn("p-4 space-y-3",className)}>
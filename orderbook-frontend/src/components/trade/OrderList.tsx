@@ -13,13 +13,26 @@ function typeLabel(t: number) {
   switch (t) {
     case OrderType.ORDER_GOOD_TILL_CANCEL:
       return "LIMIT (GTC)";
-    case OrderType.ORDER_FILL_AND_KILL:
-      return "MARKET (IOC)";
+    case OrderType.ORDER_IMMEDIATE_OR_CANCEL:
+      return "LIMIT (IOC)";
+    case OrderType.ORDER_FILL_OR_KILL:
+      return "LIMIT (FOK)";
+    case OrderType.ORDER_MARKET:
+      return "MARKET";
+    case OrderType.ORDER_STOP_MARKET:
+      return "STOP";
+    case OrderType.ORDER_STOP_LIMIT:
+      return "STOP LIMIT";
+    case OrderType.ORDER_GOOD_TILL_DATE:
+      return "LIMIT (GTD)";
+    case OrderType.ORDER_DAY:
+      return "LIMIT (DAY)";
     default:
       return String(t);
   }
 }
-function statusLabel(active?: boolean, closed_at?: string | null) {
+function statusLabel(active?: boolean, closed_at?: string | null, status?: string) {
+  if (status) return status;
   if (active === false) return "CLOSED";
   if (closed_at) return "CLOSED";
   return "OPEN";
@@ -96,7 +109,7 @@ export default function OrderList({ ticker }: { ticker?: string }) {
                     <td className="py-2 pr-2">{o.Filled}</td>
                     <td className="py-2 pr-2">
                       <span className="text-xs text-gray-600">
-                        {statusLabel(o.IsActive, o.ClosedAt)}
+                        {statusLabel(o.IsActive, o.ClosedAt, o.Status)}
                       </span>
                     </td>
                     <td className="py-2 pr-2">